@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/util"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// runCacheCommand handles `api cache sync [--dry-run] [--collections=bots,users] [--batch-size=500]`
+func runCacheCommand(args []string) int {
+	if len(args) < 1 || args[0] != "sync" {
+		log.Error("Usage: api cache sync [--dry-run] [--collections=bots,users,servers,templates] [--batch-size=500]")
+		return 2
+	}
+	flags := flag.NewFlagSet("cache sync", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report drift without writing to redis")
+	cols := flags.String("collections", "", "comma separated list of collections to sync, defaults to all")
+	batchSize := flags.Int("batch-size", entities.DefaultSyncBatchSize, "amount of documents to write per batch")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	opts := entities.CacheSyncOptions{DryRun: *dryRun, BatchSize: *batchSize}
+	if *cols != "" {
+		opts.Collections = strings.Split(*cols, ",")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	util.Database.OpenRedisConnection(util.Config.Redis)
+	util.Database.OpenMongoConnection(util.Config.Mongo)
+	defer util.Database.Close(context.Background())
+	err, report := entities.SyncCache(ctx, opts)
+	if err != nil {
+		log.Errorf("Cache sync failed: %v", err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "    ")
+	_ = encoder.Encode(report)
+	return 0
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	InvalidationChannel = "cache_invalidate"
+	// All can be published as the id to drop every entry of a cache.
+	All = "*"
+)
+
+type invalidator interface {
+	Invalidate(key string)
+	Purge()
+	Resize(capacity int, ttl time.Duration)
+	Stats() Stats
+}
+
+var (
+	caches      = make(map[string]invalidator)
+	cachesMutex = &sync.RWMutex{}
+)
+
+func register[T any](c *LRU[T]) {
+	cachesMutex.Lock()
+	defer cachesMutex.Unlock()
+	caches[c.Name] = c
+}
+
+// Configure resizes the cache called name, unknown names are ignored.
+func Configure(name string, capacity int, ttl time.Duration) {
+	cachesMutex.RLock()
+	defer cachesMutex.RUnlock()
+	if c, ok := caches[name]; ok {
+		c.Resize(capacity, ttl)
+	}
+}
+
+func AllStats() map[string]Stats {
+	cachesMutex.RLock()
+	defer cachesMutex.RUnlock()
+	stats := make(map[string]Stats, len(caches))
+	for name, c := range caches {
+		stats[name] = c.Stats()
+	}
+	return stats
+}
+
+// Publish tells every replica, including this one, to drop the entry for id from the named cache, and bumps the
+// cache's version.
+func Publish(ctx context.Context, client *redis.Client, name, id string) error {
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, versionKey(name))
+		pipe.Publish(ctx, InvalidationChannel, name+":"+id)
+		return nil
+	})
+	return err
+}
+
+func versionKey(name string) string {
+	return "cache_version:" + name
+}
+
+// Version counts the invalidations published for the named cache, 0 if there were none yet. It changes whenever an
+// entry does, so it can tag a whole collection without reading it.
+func Version(ctx context.Context, client *redis.Client, name string) (error, int64) {
+	version, err := client.Get(ctx, versionKey(name)).Int64()
+	if err == redis.Nil {
+		return nil, 0
+	}
+	return err, version
+}
+
+func invalidate(message string) {
+	name, id, ok := strings.Cut(message, ":")
+	if !ok {
+		log.WithField("channel", InvalidationChannel).Warnf("Ignoring malformed invalidation message: %s", message)
+		return
+	}
+	cachesMutex.RLock()
+	c, ok := caches[name]
+	cachesMutex.RUnlock()
+	if !ok {
+		return
+	}
+	if id == All {
+		c.Purge()
+	} else {
+		c.Invalidate(id)
+	}
+}
+
+func purgeAll() {
+	cachesMutex.RLock()
+	defer cachesMutex.RUnlock()
+	for _, c := range caches {
+		c.Purge()
+	}
+}
+
+// Listen applies invalidation messages until ctx is cancelled, every cache is purged when the subscription
+// is re-established as messages may have been missed in the meantime.
+func Listen(ctx context.Context, client *redis.Client) {
+	sub := client.Subscribe(ctx, InvalidationChannel)
+	defer sub.Close()
+	messages := sub.ChannelWithSubscriptions(ctx, 100)
+	subscribed := false
+	log.WithField("channel", InvalidationChannel).Info("Listening for cache invalidations")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if subscribed {
+					log.WithField("channel", InvalidationChannel).Warn("Resubscribed, purging in-process caches")
+					purgeAll()
+				}
+				subscribed = true
+			case *redis.Message:
+				invalidate(m.Payload)
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"container/list"
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Stats struct {
+	Size      int    `json:"size"`
+	Capacity  int    `json:"capacity"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Coalesced uint64 `json:"coalesced"`
+}
+
+type entry[T any] struct {
+	key     string
+	value   T
+	expires time.Time
+}
+
+// LRU is a bounded, TTL aware cache which coalesces concurrent loads of the same key.
+type LRU[T any] struct {
+	Name      string
+	capacity  int
+	ttl       time.Duration
+	mutex     sync.Mutex
+	items     map[string]*list.Element
+	order     *list.List
+	group     singleflight.Group
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	coalesced uint64
+
+	// generation is bumped by Invalidate and Purge, loads which started before are returned but not cached.
+	generation uint64
+}
+
+func New[T any](name string, capacity int, ttl time.Duration) *LRU[T] {
+	c := &LRU[T]{
+		Name:     name,
+		capacity: capacity,
+		ttl:      ttl,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+	register(c)
+	return c
+}
+
+func (c *LRU[T]) Get(key string) (T, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[T])
+		if time.Now().Before(e.expires) {
+			c.order.MoveToFront(el)
+			atomic.AddUint64(&c.hits, 1)
+			return e.value, true
+		}
+		c.removeElement(el)
+	}
+	atomic.AddUint64(&c.misses, 1)
+	var zero T
+	return zero, false
+}
+
+func (c *LRU[T]) Set(key string, value T) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.set(key, value)
+}
+
+// Generation is to be read before loading values for SetIfGeneration.
+func (c *LRU[T]) Generation() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.generation
+}
+
+// SetIfGeneration stores a value loaded after Generation returned generation, unless an invalidation came in since
+// as the value may predate it. It reports whether the value was stored.
+func (c *LRU[T]) SetIfGeneration(key string, value T, generation uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.generation != generation {
+		return false
+	}
+	c.set(key, value)
+	return true
+}
+
+// set stores value, the caller holds the lock.
+func (c *LRU[T]) set(key string, value T) {
+	if c.capacity < 1 {
+		return
+	}
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[T])
+		e.value = value
+		e.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&entry[T]{key: key, value: value, expires: expires})
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// Fetch returns the cached value for key, or calls load once for all concurrent callers missing the same key.
+func (c *LRU[T]) Fetch(key string, load func() (error, T)) (error, T) {
+	if value, ok := c.Get(key); ok {
+		return nil, value
+	}
+	res, err, shared := c.group.Do(key, func() (interface{}, error) {
+		c.mutex.Lock()
+		generation := c.generation
+		c.mutex.Unlock()
+		err, value := load()
+		if err != nil {
+			return value, err
+		}
+		c.mutex.Lock()
+		// The value may predate an invalidation which came in while it loaded.
+		if c.generation == generation {
+			c.set(key, value)
+		}
+		c.mutex.Unlock()
+		return value, nil
+	})
+	if shared {
+		atomic.AddUint64(&c.coalesced, 1)
+	}
+	return err, res.(T)
+}
+
+func (c *LRU[T]) Invalidate(key string) {
+	c.group.Forget(key)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+func (c *LRU[T]) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.generation++
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// Resize changes the capacity and TTL, evicting the least recently used entries if the cache shrank.
+func (c *LRU[T]) Resize(capacity int, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.capacity = capacity
+	c.ttl = ttl
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+func (c *LRU[T]) Stats() Stats {
+	c.mutex.Lock()
+	size, capacity := c.order.Len(), c.capacity
+	c.mutex.Unlock()
+	return Stats{
+		Size:      size,
+		Capacity:  capacity,
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+		Coalesced: atomic.LoadUint64(&c.coalesced),
+	}
+}
+
+func (c *LRU[T]) removeElement(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[T]).key)
+}
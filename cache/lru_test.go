@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvalidateDuringLoad(t *testing.T) {
+	c := New[string]("test_invalidate", 8, time.Minute)
+	loading, release := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Fetch("key", func() (error, string) {
+			close(loading)
+			<-release
+			return nil, "stale"
+		})
+	}()
+	<-loading
+	c.Invalidate("key")
+	close(release)
+	<-done
+	if value, ok := c.Get("key"); ok {
+		t.Fatalf("a load which started before Invalidate was cached: %q", value)
+	}
+	err, value := c.Fetch("key", func() (error, string) { return nil, "fresh" })
+	if err != nil || value != "fresh" {
+		t.Fatalf("Fetch() = %v, %q, want fresh", err, value)
+	}
+	if value, ok := c.Get("key"); !ok || value != "fresh" {
+		t.Fatalf("Get() = %q, %t, want the fresh value cached", value, ok)
+	}
+}
+
+func TestStatsCapacityAfterResize(t *testing.T) {
+	c := New[int]("test_resize", 4, time.Minute)
+	for i := 0; i < 4; i++ {
+		c.Set(string(rune('a'+i)), i)
+	}
+	c.Resize(2, time.Minute)
+	if stats := c.Stats(); stats.Capacity != 2 || stats.Size != 2 || stats.Evictions != 2 {
+		t.Fatalf("Stats() = %+v, want capacity 2, size 2 and 2 evictions", stats)
+	}
+}
+
+func TestSetIfGeneration(t *testing.T) {
+	c := New[string]("test_generation", 8, time.Minute)
+	generation := c.Generation()
+	c.Invalidate("other")
+	if c.SetIfGeneration("key", "stale", generation) {
+		t.Fatal("a value loaded before an invalidation was stored")
+	}
+	if _, ok := c.Get("key"); ok {
+		t.Fatal("a value loaded before an invalidation was cached")
+	}
+	if !c.SetIfGeneration("key", "fresh", c.Generation()) {
+		t.Fatal("a value loaded after the invalidation wasn't stored")
+	}
+}
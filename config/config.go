@@ -0,0 +1,518 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Duration wraps time.Duration so it can be written as "10s" or "24h" in config files.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+type Bucket struct {
+	Limit         int      `yaml:"limit" toml:"limit" env:"LIMIT"`
+	Reset         Duration `yaml:"reset" toml:"reset" env:"RESET"`
+	TempBanLength Duration `yaml:"temp_ban_length" toml:"temp_ban_length" env:"TEMP_BAN_LENGTH"`
+	TempBanAfter  int      `yaml:"temp_ban_after" toml:"temp_ban_after" env:"TEMP_BAN_AFTER"`
+	PermBanAfter  int      `yaml:"perm_ban_after" toml:"perm_ban_after" env:"PERM_BAN_AFTER"`
+}
+
+type CacheOptions struct {
+	Capacity int      `yaml:"capacity" toml:"capacity" env:"CAPACITY"`
+	TTL      Duration `yaml:"ttl" toml:"ttl" env:"TTL"`
+}
+
+type Timeouts struct {
+	ReadHeader Duration `yaml:"read_header" toml:"read_header" env:"TIMEOUT_READ_HEADER"`
+	Read       Duration `yaml:"read" toml:"read" env:"TIMEOUT_READ"`
+	Write      Duration `yaml:"write" toml:"write" env:"TIMEOUT_WRITE"`
+	Idle       Duration `yaml:"idle" toml:"idle" env:"TIMEOUT_IDLE"`
+	Shutdown   Duration `yaml:"shutdown" toml:"shutdown" env:"TIMEOUT_SHUTDOWN" flag:"shutdown-timeout"`
+	Workers    Duration `yaml:"workers" toml:"workers" env:"TIMEOUT_WORKERS"`
+}
+
+type Redis struct {
+	IP           string   `yaml:"ip" toml:"ip" env:"REDIS_IP"`
+	Port         int      `yaml:"port" toml:"port" env:"REDIS_PORT"`
+	Password     string   `yaml:"password" toml:"password" env:"REDIS_PASSWORD"`
+	DB           int      `yaml:"db" toml:"db" env:"REDIS_DB"`
+	Sentinels    []string `yaml:"sentinels" toml:"sentinels" env:"REDIS_SENTINELS"`
+	Master       string   `yaml:"master" toml:"master" env:"REDIS_MASTER"`
+	DialTimeout  Duration `yaml:"dial_timeout" toml:"dial_timeout" env:"REDIS_DIAL_TIMEOUT"`
+	ReadTimeout  Duration `yaml:"read_timeout" toml:"read_timeout" env:"REDIS_READ_TIMEOUT"`
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout" env:"REDIS_WRITE_TIMEOUT"`
+}
+
+type Mongo struct {
+	URL            string   `yaml:"url" toml:"url" env:"MONGO_URL"`
+	DB             string   `yaml:"db" toml:"db" env:"MONGO_DB"`
+	ConnectTimeout Duration `yaml:"connect_timeout" toml:"connect_timeout" env:"MONGO_CONNECT_TIMEOUT"`
+}
+
+type Sentry struct {
+	// DSN of the sentry project, the integration is disabled when empty.
+	DSN string `yaml:"dsn" toml:"dsn" env:"SENTRY"`
+	// Environment events are reported under, defaults to development with --dev and production otherwise.
+	Environment string `yaml:"environment" toml:"environment" env:"SENTRY_ENVIRONMENT"`
+	// SampleRate is the fraction of error events sent, between 0 and 1.
+	SampleRate float64 `yaml:"sample_rate" toml:"sample_rate" env:"SENTRY_SAMPLE_RATE"`
+}
+
+type Logging struct {
+	// Format of application logs, json or text. Access logs are always json.
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+	// AccessSample maps a route pattern without its /v1 or /v2 prefix to the fraction of its access logs to keep,
+	// routes not listed keep all. Server errors are always logged.
+	AccessSample map[string]float64 `yaml:"access_sample" toml:"access_sample"`
+}
+
+type Tracing struct {
+	// Exporter is one of none, otlp, stdout or memory.
+	Exporter    string  `yaml:"exporter" toml:"exporter" env:"TRACING_EXPORTER"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint" env:"TRACING_ENDPOINT"`
+	Protocol    string  `yaml:"protocol" toml:"protocol" env:"TRACING_PROTOCOL"`
+	Insecure    bool    `yaml:"insecure" toml:"insecure" env:"TRACING_INSECURE"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+	ServiceName string  `yaml:"service_name" toml:"service_name" env:"TRACING_SERVICE_NAME"`
+}
+
+type Probes struct {
+	// Timeout for each individual probe check.
+	Timeout Duration `yaml:"timeout" toml:"timeout" env:"PROBE_TIMEOUT"`
+	// MaxRedisLatency and MaxMongoLatency fail readiness when a ping takes longer, 0 disables the limit.
+	MaxRedisLatency Duration `yaml:"max_redis_latency" toml:"max_redis_latency" env:"PROBE_MAX_REDIS_LATENCY"`
+	MaxMongoLatency Duration `yaml:"max_mongo_latency" toml:"max_mongo_latency" env:"PROBE_MAX_MONGO_LATENCY"`
+	// WarmCollections need at least MinCacheEntries entities cached in redis before the API is ready.
+	WarmCollections []string `yaml:"warm_collections" toml:"warm_collections" env:"PROBE_WARM_COLLECTIONS"`
+	MinCacheEntries int      `yaml:"min_cache_entries" toml:"min_cache_entries" env:"PROBE_MIN_CACHE_ENTRIES"`
+}
+
+type Kubernetes struct {
+	// Namespace the pod is looked up in when POD_NAMESPACE isn't set, defaults to the service account's namespace.
+	Namespace string `yaml:"namespace" toml:"namespace" env:"KUBERNETES_NAMESPACE"`
+}
+
+type Compression struct {
+	// Encodings in order of preference when the client accepts several equally, any of zstd, br and gzip.
+	Encodings []string `yaml:"encodings" toml:"encodings" env:"COMPRESSION_ENCODINGS"`
+	// MinBytes is the size below which responses aren't worth compressing.
+	MinBytes int `yaml:"min_bytes" toml:"min_bytes" env:"COMPRESSION_MIN_BYTES"`
+}
+
+type GraphQL struct {
+	// MaxCost is the most entities a single query may resolve, lists count at their ids or first argument.
+	MaxCost int `yaml:"max_cost" toml:"max_cost" env:"GRAPHQL_MAX_COST"`
+	// MaxDepth is how deeply a query's fields may be nested.
+	MaxDepth int `yaml:"max_depth" toml:"max_depth" env:"GRAPHQL_MAX_DEPTH"`
+	// ScanCost is what a user's bots cost on top of the bots themselves, finding them scans every bot.
+	ScanCost int `yaml:"scan_cost" toml:"scan_cost" env:"GRAPHQL_SCAN_COST"`
+}
+
+type Events struct {
+	// Heartbeat is how often idle streams are pinged, so proxies don't close them.
+	Heartbeat Duration `yaml:"heartbeat" toml:"heartbeat" env:"EVENTS_HEARTBEAT"`
+	// Buffer is how many events a subscriber may fall behind before it is disconnected.
+	Buffer int `yaml:"buffer" toml:"buffer" env:"EVENTS_BUFFER"`
+}
+
+type Webhooks struct {
+	// Timeout is how long a receiver has to answer a delivery.
+	Timeout Duration `yaml:"timeout" toml:"timeout" env:"WEBHOOKS_TIMEOUT"`
+	// MaxAttempts is how often a delivery is tried before it is dead-lettered.
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts" env:"WEBHOOKS_MAX_ATTEMPTS"`
+	// Backoff is the wait before the first retry, it doubles with every attempt up to MaxBackoff.
+	Backoff    Duration `yaml:"backoff" toml:"backoff" env:"WEBHOOKS_BACKOFF"`
+	MaxBackoff Duration `yaml:"max_backoff" toml:"max_backoff" env:"WEBHOOKS_MAX_BACKOFF"`
+	// Workers is how many deliveries each replica sends at once.
+	Workers int `yaml:"workers" toml:"workers" env:"WEBHOOKS_WORKERS"`
+	// MaxPerOwner is how many webhooks a bot may register.
+	MaxPerOwner int `yaml:"max_per_owner" toml:"max_per_owner" env:"WEBHOOKS_MAX_PER_OWNER"`
+	// LogSize is how many delivery attempts and dead letters are kept per webhook.
+	LogSize int `yaml:"log_size" toml:"log_size" env:"WEBHOOKS_LOG_SIZE"`
+	// AllowPrivateNetworks lets webhooks point at loopback and private addresses, only meant for development.
+	AllowPrivateNetworks bool `yaml:"allow_private_networks" toml:"allow_private_networks" env:"WEBHOOKS_ALLOW_PRIVATE_NETWORKS"`
+}
+
+type Docs struct {
+	// Redoc is the script /docs renders the OpenAPI document with, either the path of a vendored redoc.standalone.js,
+	// which is served from /docs/redoc.standalone.js, or a URL.
+	Redoc string `yaml:"redoc" toml:"redoc" env:"DOCS_REDOC"`
+	// RedocIntegrity is the subresource integrity of the script at the URL, e.g. sha384-<base64 digest>. It is
+	// required outside development so a compromised CDN can't run its own scripts on the API's origin.
+	RedocIntegrity string `yaml:"redoc_integrity" toml:"redoc_integrity" env:"DOCS_REDOC_INTEGRITY"`
+}
+
+// RemoteRedoc is true when Redoc is a URL rather than a vendored file.
+func (d Docs) RemoteRedoc() bool {
+	return strings.HasPrefix(d.Redoc, "https://") || strings.HasPrefix(d.Redoc, "http://")
+}
+
+type Features struct {
+	Kubernetes        bool `yaml:"kubernetes" toml:"kubernetes" env:"FEATURE_KUBERNETES"`
+	CacheInvalidation bool `yaml:"cache_invalidation" toml:"cache_invalidation" env:"FEATURE_CACHE_INVALIDATION"`
+	CacheSyncEndpoint bool `yaml:"cache_sync_endpoint" toml:"cache_sync_endpoint" env:"FEATURE_CACHE_SYNC_ENDPOINT"`
+	Metrics           bool `yaml:"metrics" toml:"metrics" env:"FEATURE_METRICS"`
+	Compression       bool `yaml:"compression" toml:"compression" env:"FEATURE_COMPRESSION"`
+	// ReplicaHeaders adds X-Served-By, X-Node, X-Zone and X-Region to every response.
+	ReplicaHeaders bool `yaml:"replica_headers" toml:"replica_headers" env:"FEATURE_REPLICA_HEADERS"`
+	Events         bool `yaml:"events" toml:"events" env:"FEATURE_EVENTS"`
+	// ChangeStreams invalidates caches and publishes events for changes made to MongoDB, which has to be a replica set.
+	ChangeStreams bool `yaml:"change_streams" toml:"change_streams" env:"FEATURE_CHANGE_STREAMS"`
+	Webhooks      bool `yaml:"webhooks" toml:"webhooks" env:"FEATURE_WEBHOOKS"`
+}
+
+// PublishEvents is true when anything consumes events, i.e. /events or webhooks.
+func (f Features) PublishEvents() bool {
+	return f.Events || f.Webhooks
+}
+
+type Config struct {
+	Dev         bool                    `yaml:"dev" toml:"dev" env:"DEV" flag:"dev"`
+	Addr        string                  `yaml:"addr" toml:"addr" env:"ADDR" flag:"addr"`
+	Port        int                     `yaml:"port" toml:"port" env:"PORT" flag:"port"`
+	LogLevel    string                  `yaml:"log_level" toml:"log_level" env:"LOG_LEVEL" flag:"log-level"`
+	Logging     Logging                 `yaml:"logging" toml:"logging"`
+	Timeouts    Timeouts                `yaml:"timeouts" toml:"timeouts"`
+	Redis       Redis                   `yaml:"redis" toml:"redis"`
+	Mongo       Mongo                   `yaml:"mongo" toml:"mongo"`
+	Sentry      Sentry                  `yaml:"sentry" toml:"sentry"`
+	Tracing     Tracing                 `yaml:"tracing" toml:"tracing"`
+	Probes      Probes                  `yaml:"probes" toml:"probes"`
+	Kubernetes  Kubernetes              `yaml:"kubernetes" toml:"kubernetes"`
+	Compression Compression             `yaml:"compression" toml:"compression"`
+	GraphQL     GraphQL                 `yaml:"graphql" toml:"graphql"`
+	Events      Events                  `yaml:"events" toml:"events"`
+	Webhooks    Webhooks                `yaml:"webhooks" toml:"webhooks"`
+	Docs        Docs                    `yaml:"docs" toml:"docs"`
+	Features    Features                `yaml:"features" toml:"features"`
+	Cache       map[string]CacheOptions `yaml:"cache" toml:"cache" env:"CACHE"`
+	Ratelimits  map[string]Bucket       `yaml:"ratelimits" toml:"ratelimits" env:"RATELIMIT"`
+	// CacheControl maps a route pattern, without its version prefix, to the Cache-Control header of its successful
+	// reads. Routes not listed are sent with no-cache, so clients revalidate them with their ETag.
+	CacheControl map[string]string `yaml:"cache_control" toml:"cache_control"`
+	// MaxBodyBytes is the largest request body write routes accept.
+	MaxBodyBytes int `yaml:"max_body_bytes" toml:"max_body_bytes" env:"MAX_BODY_BYTES"`
+	// MaxBatchSize is the most ids the batch lookup routes resolve at once.
+	MaxBatchSize int `yaml:"max_batch_size" toml:"max_batch_size" env:"MAX_BATCH_SIZE"`
+	// WebsiteToken authorises the website's requests to routes only it may use, like recording template uses. They
+	// are refused when it is empty, except with --dev.
+	WebsiteToken string `yaml:"website_token" toml:"website_token" env:"WEBSITE_TOKEN"`
+	// Args holds the positional arguments left over after flags were parsed, i.e. subcommands.
+	Args []string `yaml:"-" toml:"-"`
+}
+
+func duration(d time.Duration) Duration {
+	return Duration{Duration: d}
+}
+
+func Defaults() *Config {
+	return &Config{
+		Addr:         "0.0.0.0",
+		Port:         3000,
+		LogLevel:     "debug",
+		MaxBodyBytes: 64 << 10,
+		MaxBatchSize: 100,
+		Logging: Logging{
+			Format:       "json",
+			AccessSample: map[string]float64{"/health": 0.01, "/livez": 0.01, "/readyz": 0.01, "/startupz": 0.01},
+		},
+		Timeouts: Timeouts{
+			ReadHeader: duration(10 * time.Second),
+			Read:       duration(30 * time.Second),
+			Write:      duration(60 * time.Second),
+			Idle:       duration(120 * time.Second),
+			Shutdown:   duration(25 * time.Second),
+			Workers:    duration(5 * time.Second),
+		},
+		Redis: Redis{
+			IP:           "127.0.0.1",
+			Port:         6379,
+			DialTimeout:  duration(5 * time.Second),
+			ReadTimeout:  duration(5 * time.Second),
+			WriteTimeout: duration(5 * time.Second),
+		},
+		Mongo: Mongo{
+			ConnectTimeout: duration(10 * time.Second),
+		},
+		Sentry: Sentry{
+			SampleRate: 1,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			Protocol:    "grpc",
+			SampleRatio: 1,
+			ServiceName: "del-api",
+		},
+		Probes: Probes{
+			Timeout:         duration(2 * time.Second),
+			MaxRedisLatency: duration(500 * time.Millisecond),
+			MaxMongoLatency: duration(1 * time.Second),
+			WarmCollections: []string{"bots", "users"},
+			MinCacheEntries: 1,
+		},
+		Compression: Compression{
+			Encodings: []string{"zstd", "br", "gzip"},
+			MinBytes:  1024,
+		},
+		GraphQL: GraphQL{
+			MaxCost:  200,
+			MaxDepth: 10,
+			ScanCost: 50,
+		},
+		Events: Events{
+			Heartbeat: duration(30 * time.Second),
+			Buffer:    64,
+		},
+		Webhooks: Webhooks{
+			Timeout:     duration(10 * time.Second),
+			MaxAttempts: 8,
+			Backoff:     duration(10 * time.Second),
+			MaxBackoff:  duration(1 * time.Hour),
+			Workers:     4,
+			MaxPerOwner: 10,
+			LogSize:     100,
+		},
+		Docs: Docs{
+			Redoc: "https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js",
+		},
+		Features: Features{
+			Kubernetes:        true,
+			CacheInvalidation: true,
+			CacheSyncEndpoint: true,
+			Metrics:           true,
+			Compression:       true,
+			ReplicaHeaders:    true,
+			Events:            true,
+			ChangeStreams:     true,
+			Webhooks:          true,
+		},
+		Cache: map[string]CacheOptions{
+			"bots":      {Capacity: 4096, TTL: duration(1 * time.Minute)},
+			"users":     {Capacity: 4096, TTL: duration(1 * time.Minute)},
+			"servers":   {Capacity: 4096, TTL: duration(1 * time.Minute)},
+			"templates": {Capacity: 1024, TTL: duration(1 * time.Minute)},
+		},
+		CacheControl: map[string]string{
+			"/health":                     "no-store",
+			"/stats":                      "public, max-age=300",
+			"/bots":                       "public, max-age=60, stale-while-revalidate=60",
+			"/bot/{id}":                   "public, max-age=30",
+			"/user/{id}":                  "public, max-age=30",
+			"/server/{id}":                "public, max-age=30",
+			"/template/{id}":              "public, max-age=30",
+			"/template/{id}/export":       "public, max-age=30",
+			"/template/{id}/diff/{other}": "public, max-age=30",
+			"/template/{id}/structure":    "public, max-age=30",
+			"/templates/trending":         "public, max-age=60",
+			"/templates/top":              "public, max-age=300",
+			"/bots/trending":              "public, max-age=60",
+		},
+		Ratelimits: map[string]Bucket{
+			"general":      {Limit: 5, Reset: duration(5 * time.Second), TempBanLength: duration(1 * time.Hour), TempBanAfter: 5, PermBanAfter: 2},
+			"bots":         {Limit: 10, Reset: duration(60 * time.Second), TempBanLength: duration(24 * time.Hour), TempBanAfter: 3, PermBanAfter: 3},
+			"premium_bots": {Limit: 20, Reset: duration(10 * time.Second), TempBanLength: duration(24 * time.Hour), TempBanAfter: 4, PermBanAfter: 4},
+			"users":        {Limit: 10, Reset: duration(10 * time.Second), TempBanLength: duration(48 * time.Hour), TempBanAfter: 3, PermBanAfter: 2},
+			"servers":      {Limit: 10, Reset: duration(10 * time.Second), TempBanLength: duration(48 * time.Hour), TempBanAfter: 3, PermBanAfter: 2},
+			"templates":    {Limit: 10, Reset: duration(10 * time.Second), TempBanLength: duration(48 * time.Hour), TempBanAfter: 3, PermBanAfter: 2},
+			"graphql":      {Limit: 500, Reset: duration(60 * time.Second), TempBanLength: duration(24 * time.Hour), TempBanAfter: 3, PermBanAfter: 3},
+			"webhooks":     {Limit: 10, Reset: duration(10 * time.Second), TempBanLength: duration(1 * time.Hour), TempBanAfter: 5, PermBanAfter: 3},
+			"events":       {Limit: 10, Reset: duration(60 * time.Second), TempBanLength: duration(1 * time.Hour), TempBanAfter: 5, PermBanAfter: 3},
+		},
+	}
+}
+
+// Bucket returns the ratelimit bucket called name, Validate guarantees every default bucket exists.
+func (c *Config) Bucket(name string) Bucket {
+	return c.Ratelimits[name]
+}
+
+var versioned = regexp.MustCompile(`^/v[0-9]+(/|$)`)
+
+// routeKey is whether route is written like the keys of the settings applying to routes, i.e. the route pattern
+// without its version prefix or a trailing slash. Which routes exist is only known once they are registered.
+func routeKey(route string) error {
+	switch {
+	case !strings.HasPrefix(route, "/"):
+		return errors.New("must start with /")
+	case versioned.MatchString(route):
+		return errors.New("must not have a version prefix, the setting applies to every version")
+	case len(route) > 1 && strings.HasSuffix(route, "/"):
+		return errors.New("must not end with /")
+	}
+	return nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %d", c.Port))
+	}
+	if c.MaxBodyBytes < 1 {
+		errs = append(errs, fmt.Errorf("max_body_bytes must be positive, got %d", c.MaxBodyBytes))
+	}
+	if c.MaxBatchSize < 1 {
+		errs = append(errs, fmt.Errorf("max_batch_size must be positive, got %d", c.MaxBatchSize))
+	}
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+	for name, d := range map[string]Duration{
+		"timeouts.read_header":  c.Timeouts.ReadHeader,
+		"timeouts.shutdown":     c.Timeouts.Shutdown,
+		"timeouts.workers":      c.Timeouts.Workers,
+		"redis.dial_timeout":    c.Redis.DialTimeout,
+		"redis.read_timeout":    c.Redis.ReadTimeout,
+		"redis.write_timeout":   c.Redis.WriteTimeout,
+		"mongo.connect_timeout": c.Mongo.ConnectTimeout,
+		"probes.timeout":        c.Probes.Timeout,
+		"events.heartbeat":      c.Events.Heartbeat,
+		"webhooks.timeout":      c.Webhooks.Timeout,
+		"webhooks.backoff":      c.Webhooks.Backoff,
+		"webhooks.max_backoff":  c.Webhooks.MaxBackoff,
+	} {
+		if d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+	if len(c.Redis.Sentinels) > 0 {
+		if c.Redis.Master == "" {
+			errs = append(errs, errors.New("redis.master is required when redis.sentinels is set"))
+		}
+	} else if c.Redis.IP == "" || c.Redis.Port < 1 || c.Redis.Port > 65535 {
+		errs = append(errs, errors.New("redis.ip and a valid redis.port are required when redis.sentinels isn't set"))
+	}
+	if c.Redis.DB < 0 {
+		errs = append(errs, fmt.Errorf("redis.db must not be negative, got %d", c.Redis.DB))
+	}
+	if c.Mongo.URL == "" {
+		errs = append(errs, errors.New("mongo.url is required"))
+	}
+	if c.Mongo.DB == "" {
+		errs = append(errs, errors.New("mongo.db is required"))
+	}
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		errs = append(errs, fmt.Errorf("logging.format must be json or text, got %q", c.Logging.Format))
+	}
+	for route, rate := range c.Logging.AccessSample {
+		if err := routeKey(route); err != nil {
+			errs = append(errs, fmt.Errorf("logging.access_sample.%s: %w", route, err))
+		}
+		if rate < 0 || rate > 1 {
+			errs = append(errs, fmt.Errorf("logging.access_sample.%s must be between 0 and 1, got %v", route, rate))
+		}
+	}
+	for route, policy := range c.CacheControl {
+		if err := routeKey(route); err != nil {
+			errs = append(errs, fmt.Errorf("cache_control.%s: %w", route, err))
+		}
+		if strings.TrimSpace(policy) == "" || strings.ContainsAny(policy, "\r\n") {
+			errs = append(errs, fmt.Errorf("cache_control.%s must be a single line header value, got %q", route, policy))
+		}
+	}
+	if c.Sentry.SampleRate < 0 || c.Sentry.SampleRate > 1 {
+		errs = append(errs, fmt.Errorf("sentry.sample_rate must be between 0 and 1, got %v", c.Sentry.SampleRate))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "memory":
+	case "otlp":
+		if c.Tracing.Endpoint == "" {
+			errs = append(errs, errors.New("tracing.endpoint is required for the otlp exporter"))
+		}
+		if c.Tracing.Protocol != "grpc" && c.Tracing.Protocol != "http" {
+			errs = append(errs, fmt.Errorf("tracing.protocol must be grpc or http, got %q", c.Tracing.Protocol))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be one of none, otlp, stdout or memory, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio must be between 0 and 1, got %v", c.Tracing.SampleRatio))
+	}
+	for _, col := range c.Probes.WarmCollections {
+		if col != "bots" && col != "users" && col != "servers" && col != "templates" {
+			errs = append(errs, fmt.Errorf("probes.warm_collections must only contain bots, users, servers or templates, got %q", col))
+		}
+	}
+	if c.Probes.MinCacheEntries < 0 {
+		errs = append(errs, fmt.Errorf("probes.min_cache_entries must not be negative, got %d", c.Probes.MinCacheEntries))
+	}
+	for _, encoding := range c.Compression.Encodings {
+		if encoding != "zstd" && encoding != "br" && encoding != "gzip" {
+			errs = append(errs, fmt.Errorf("compression.encodings must only contain zstd, br or gzip, got %q", encoding))
+		}
+	}
+	if c.Compression.MinBytes < 0 {
+		errs = append(errs, fmt.Errorf("compression.min_bytes must not be negative, got %d", c.Compression.MinBytes))
+	}
+	if c.GraphQL.MaxCost < 1 || c.GraphQL.MaxDepth < 1 {
+		errs = append(errs, errors.New("graphql.max_cost and graphql.max_depth must be at least 1"))
+	}
+	if c.GraphQL.ScanCost < 0 {
+		errs = append(errs, fmt.Errorf("graphql.scan_cost must not be negative, got %d", c.GraphQL.ScanCost))
+	}
+	if c.Events.Buffer < 1 {
+		errs = append(errs, fmt.Errorf("events.buffer must be at least 1, got %d", c.Events.Buffer))
+	}
+	for name, n := range map[string]int{
+		"webhooks.max_attempts":  c.Webhooks.MaxAttempts,
+		"webhooks.workers":       c.Webhooks.Workers,
+		"webhooks.max_per_owner": c.Webhooks.MaxPerOwner,
+		"webhooks.log_size":      c.Webhooks.LogSize,
+	} {
+		if n < 1 {
+			errs = append(errs, fmt.Errorf("%s must be at least 1, got %d", name, n))
+		}
+	}
+	if c.Docs.Redoc == "" {
+		errs = append(errs, errors.New("docs.redoc is required"))
+	} else if c.Docs.RemoteRedoc() && c.Docs.RedocIntegrity == "" && !c.Dev {
+		errs = append(errs, errors.New("docs.redoc_integrity is required when docs.redoc is a URL"))
+	} else if c.Docs.RedocIntegrity != "" && !strings.HasPrefix(c.Docs.RedocIntegrity, "sha") {
+		errs = append(errs, fmt.Errorf("docs.redoc_integrity must be a sha256, sha384 or sha512 hash, got %q", c.Docs.RedocIntegrity))
+	}
+	for name, opts := range c.Cache {
+		if opts.Capacity < 0 {
+			errs = append(errs, fmt.Errorf("cache.%s.capacity must not be negative", name))
+		}
+		if opts.TTL.Duration < 0 {
+			errs = append(errs, fmt.Errorf("cache.%s.ttl must not be negative", name))
+		}
+	}
+	for name := range Defaults().Ratelimits {
+		if _, ok := c.Ratelimits[name]; !ok {
+			errs = append(errs, fmt.Errorf("ratelimits.%s is missing", name))
+		}
+	}
+	for name, bucket := range c.Ratelimits {
+		if bucket.Limit < 1 {
+			errs = append(errs, fmt.Errorf("ratelimits.%s.limit must be at least 1", name))
+		}
+		if bucket.Reset.Duration < time.Millisecond {
+			errs = append(errs, fmt.Errorf("ratelimits.%s.reset must be at least 1ms", name))
+		}
+		if bucket.TempBanLength.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("ratelimits.%s.temp_ban_length must be positive", name))
+		}
+		if bucket.TempBanAfter < 1 || bucket.PermBanAfter < 1 {
+			errs = append(errs, fmt.Errorf("ratelimits.%s.temp_ban_after and perm_ban_after must be at least 1", name))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type pendingFlag struct {
+	field  reflect.Value
+	raw    string
+	isBool bool
+	set    bool
+}
+
+func (p *pendingFlag) String() string {
+	return p.raw
+}
+
+func (p *pendingFlag) Set(raw string) error {
+	p.raw = raw
+	p.set = true
+	return nil
+}
+
+func (p *pendingFlag) IsBoolFlag() bool {
+	return p.isBool
+}
+
+// Load builds the configuration from, in order of increasing precedence, the defaults, the file given by
+// --config or CONFIG (YAML or TOML), non-empty environmental variables and flags, which may also follow a subcommand.
+// The result is validated before being returned.
+func Load(args []string) (error, *Config) {
+	cfg := Defaults()
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CONFIG"), "path to a YAML or TOML config file")
+	var pending []*pendingFlag
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("flag")
+		if name == "" {
+			return
+		}
+		p := &pendingFlag{field: value, isBool: value.Kind() == reflect.Bool}
+		pending = append(pending, p)
+		flags.Var(p, name, fmt.Sprintf("overrides %s", field.Tag.Get("yaml")))
+	})
+	if err := flags.Parse(args); err != nil {
+		return err, nil
+	}
+	global, rest := globalFlags(flags, flags.Args())
+	if err := flags.Parse(global); err != nil {
+		return err, nil
+	}
+	cfg.Args = rest
+	if *path != "" {
+		if err := loadFile(*path, cfg); err != nil {
+			return err, nil
+		}
+	}
+	if err := loadEnv(cfg); err != nil {
+		return err, nil
+	}
+	for _, p := range pending {
+		if !p.set {
+			continue
+		}
+		if err := setField(p.field, p.raw); err != nil {
+			return fmt.Errorf("flag: %w", err), nil
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return err, nil
+	}
+	return nil, cfg
+}
+
+// globalFlags picks the flags Load knows out of the arguments left after a subcommand, so `api cache sync --dev` is the
+// same as `api --dev cache sync`. The rest is left for the subcommand to parse.
+func globalFlags(flags *flag.FlagSet, args []string) (global, rest []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return global, append(rest, args[i:]...)
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		known := flags.Lookup(name)
+		if !strings.HasPrefix(arg, "-") || known == nil {
+			rest = append(rest, arg)
+			continue
+		}
+		global = append(global, arg)
+		if boolean, ok := known.Value.(interface{ IsBoolFlag() bool }); !hasValue && !(ok && boolean.IsBoolFlag()) && i+1 < len(args) {
+			i++
+			global = append(global, args[i])
+		}
+	}
+	return global, rest
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	defaults := Defaults()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var entries struct {
+			Cache      map[string]yaml.Node `yaml:"cache"`
+			Ratelimits map[string]yaml.Node `yaml:"ratelimits"`
+		}
+		if err = yaml.Unmarshal(data, cfg); err == nil {
+			err = yaml.Unmarshal(data, &entries)
+		}
+		decode := func(node yaml.Node, v interface{}) error { return node.Decode(v) }
+		if err == nil {
+			err, cfg.Cache = mergeMap(defaults.Cache, entries.Cache, decode)
+		}
+		if err == nil {
+			err, cfg.Ratelimits = mergeMap(defaults.Ratelimits, entries.Ratelimits, decode)
+		}
+	case ".toml":
+		var entries struct {
+			Cache      map[string]toml.Primitive `toml:"cache"`
+			Ratelimits map[string]toml.Primitive `toml:"ratelimits"`
+		}
+		var meta toml.MetaData
+		if err = toml.Unmarshal(data, cfg); err == nil {
+			meta, err = toml.Decode(string(data), &entries)
+		}
+		if err == nil {
+			err, cfg.Cache = mergeMap(defaults.Cache, entries.Cache, meta.PrimitiveDecode)
+		}
+		if err == nil {
+			err, cfg.Ratelimits = mergeMap(defaults.Ratelimits, entries.Ratelimits, meta.PrimitiveDecode)
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// mergeMap decodes every entry the file has over the default entry of the same name, so a file only needs to contain
+// the settings it changes, zeros and false included.
+func mergeMap[T, R any](defaults map[string]T, configured map[string]R, decode func(raw R, v interface{}) error) (error, map[string]T) {
+	merged := make(map[string]T, len(defaults))
+	for name, def := range defaults {
+		merged[name] = def
+	}
+	for name, raw := range configured {
+		entry := merged[name]
+		if err := decode(raw, &entry); err != nil {
+			return fmt.Errorf("%s: %w", name, err), nil
+		}
+		merged[name] = entry
+	}
+	return nil, merged
+}
+
+func loadEnv(cfg *Config) error {
+	var err error
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) {
+		name := field.Tag.Get("env")
+		if name == "" || err != nil || value.Kind() == reflect.Map {
+			return
+		}
+		if raw := os.Getenv(name); raw != "" {
+			if setErr := setField(value, raw); setErr != nil {
+				err = fmt.Errorf("%s: %w", name, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err = loadMapEnv("CACHE", cfg.Cache); err != nil {
+		return err
+	}
+	return loadMapEnv("RATELIMIT", cfg.Ratelimits)
+}
+
+// loadMapEnv applies variables such as RATELIMIT_BOTS_LIMIT or CACHE_TEMPLATES_TTL to existing map entries.
+func loadMapEnv[T any](prefix string, entries map[string]T) error {
+	for name, entry := range entries {
+		value := reflect.ValueOf(&entry).Elem()
+		for i := 0; i < value.NumField(); i++ {
+			key := fmt.Sprintf("%s_%s_%s", prefix, strings.ToUpper(name), value.Type().Field(i).Tag.Get("env"))
+			if raw := os.Getenv(key); raw != "" {
+				if err := setField(value.Field(i), raw); err != nil {
+					return fmt.Errorf("%s: %w", key, err)
+				}
+			}
+		}
+		entries[name] = entry
+	}
+	return nil
+}
+
+func walk(value reflect.Value, visit func(field reflect.StructField, value reflect.Value)) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(Duration{}) {
+			walk(value.Field(i), visit)
+			continue
+		}
+		visit(field, value.Field(i))
+	}
+}
+
+func setField(value reflect.Value, raw string) error {
+	if unmarshaler, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(raw))
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(parsed))
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		var parts []string
+		for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == ';' || r == ',' }) {
+			parts = append(parts, strings.TrimSpace(part))
+		}
+		value.Set(reflect.ValueOf(parts))
+	default:
+		return fmt.Errorf("unsupported config type %s", value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var files = map[string]string{
+	"yaml": `
+mongo: {url: "mongodb://db", db: del}
+docs: {redoc_integrity: sha384-x}
+port: 4000
+log_level: info
+compression: {min_bytes: 0}
+features: {metrics: false}
+cache:
+  bots: {capacity: 0}
+ratelimits:
+  bots: {limit: 3}
+`,
+	"toml": `
+port = 4000
+log_level = "info"
+[mongo]
+url = "mongodb://db"
+db = "del"
+[docs]
+redoc_integrity = "sha384-x"
+[compression]
+min_bytes = 0
+[features]
+metrics = false
+[cache.bots]
+capacity = 0
+[ratelimits.bots]
+limit = 3
+`,
+}
+
+func write(t *testing.T, format string) string {
+	path := filepath.Join(t.TempDir(), "config."+format)
+	if err := os.WriteFile(path, []byte(files[format]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	for format := range files {
+		path := write(t, format)
+		tests := []struct {
+			name     string
+			env      map[string]string
+			args     []string
+			port     int
+			logLevel string
+		}{
+			{"file", nil, nil, 4000, "info"},
+			{"env over file", map[string]string{"PORT": "5000", "LOG_LEVEL": "warn"}, nil, 5000, "warn"},
+			{"flags over env", map[string]string{"PORT": "5000", "LOG_LEVEL": "warn"}, []string{"--port=6000"}, 6000, "warn"},
+			{"empty env is unset", map[string]string{"PORT": ""}, nil, 4000, "info"},
+		}
+		for _, test := range tests {
+			t.Run(format+"/"+test.name, func(t *testing.T) {
+				for name, value := range test.env {
+					t.Setenv(name, value)
+				}
+				err, cfg := Load(append([]string{"--config", path}, test.args...))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if cfg.Port != test.port || cfg.LogLevel != test.logLevel {
+					t.Fatalf("port %d and log level %s, want %d and %s", cfg.Port, cfg.LogLevel, test.port, test.logLevel)
+				}
+			})
+		}
+	}
+}
+
+func TestFileZeros(t *testing.T) {
+	defaults := Defaults()
+	for format := range files {
+		t.Run(format, func(t *testing.T) {
+			err, cfg := Load([]string{"--config", write(t, format)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Compression.MinBytes != 0 || cfg.Features.Metrics || !cfg.Features.Compression {
+				t.Fatalf("compression.min_bytes %d, features %+v", cfg.Compression.MinBytes, cfg.Features)
+			}
+			if bots := cfg.Cache["bots"]; bots.Capacity != 0 || bots.TTL.Duration != time.Minute {
+				t.Fatalf("cache.bots is %+v, want no capacity and the default ttl", bots)
+			}
+			want := defaults.Ratelimits["bots"]
+			want.Limit = 3
+			if bots := cfg.Ratelimits["bots"]; bots != want {
+				t.Fatalf("ratelimits.bots is %+v, want %+v", bots, want)
+			}
+			if !reflect.DeepEqual(cfg.Ratelimits["users"], defaults.Ratelimits["users"]) {
+				t.Fatalf("ratelimits.users is %+v, want the default", cfg.Ratelimits["users"])
+			}
+		})
+	}
+}
+
+func TestSubcommandFlags(t *testing.T) {
+	err, cfg := Load([]string{"--config", write(t, "yaml"), "cache", "sync", "--dev", "--dry-run", "--port", "7000", "--collections=bots", "--", "--addr=x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Dev || cfg.Port != 7000 || cfg.Addr != "0.0.0.0" {
+		t.Fatalf("dev %v, port %d and addr %s after the subcommand", cfg.Dev, cfg.Port, cfg.Addr)
+	}
+	if want := []string{"cache", "sync", "--dry-run", "--collections=bots", "--", "--addr=x"}; !reflect.DeepEqual(cfg.Args, want) {
+		t.Fatalf("args are %q, want %q", cfg.Args, want)
+	}
+}
+
+func TestValidateRouteKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   string
+	}{
+		{"valid", func(*Config) {}, ""},
+		{"unknown collection", func(cfg *Config) { cfg.Probes.WarmCollections = []string{"bots", "bot"} },
+			`probes.warm_collections must only contain bots, users, servers or templates, got "bot"`},
+		{"relative route", func(cfg *Config) { cfg.CacheControl["bots"] = "no-store" },
+			"cache_control.bots: must start with /"},
+		{"versioned route", func(cfg *Config) { cfg.CacheControl["/v2/bots"] = "no-store" },
+			"cache_control./v2/bots: must not have a version prefix"},
+		{"trailing slash", func(cfg *Config) { cfg.Logging.AccessSample["/bots/"] = 1 },
+			"logging.access_sample./bots/: must not end with /"},
+		{"header injection", func(cfg *Config) { cfg.CacheControl["/bots"] = "no-store\r\nX-Evil: 1" },
+			"cache_control./bots must be a single line header value"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Defaults()
+			cfg.Mongo.URL, cfg.Mongo.DB = "mongodb://db", "del"
+			cfg.Docs.RedocIntegrity = "sha384-x"
+			test.change(cfg)
+			err := cfg.Validate()
+			if test.want == "" && err != nil || test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)) {
+				t.Fatalf("Validate() = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -3,15 +3,13 @@ package database
 import (
 	"context"
 	"fmt"
+	"github.com/discordextremelist/api/config"
 	"github.com/getsentry/sentry-go"
 	"github.com/go-redis/redis/v8"
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -93,43 +91,33 @@ func (manager *Manager) retryRedisConnect() {
 	}
 }
 
-func (manager *Manager) OpenRedisConnection() {
-	db, err := strconv.Atoi(os.Getenv("REDIS_DB"))
-	if err != nil {
-		sentry.CaptureException(err)
-		log.WithField("type", "Redis").Fatal("Failed to convert type string to type int")
-	}
-	pass := os.Getenv("REDIS_PASSWORD")
-	if sentinels := os.Getenv("REDIS_SENTINELS"); len(sentinels) > 0 {
-		var splitSentinels = strings.Split(sentinels, ";")
+func (manager *Manager) OpenRedisConnection(cfg config.Redis) {
+	if len(cfg.Sentinels) > 0 {
 		manager.Redis = redis.NewFailoverClient(&redis.FailoverOptions{
-			SentinelAddrs:    splitSentinels,
-			MasterName:       os.Getenv("REDIS_MASTER"),
-			Password:         pass,
-			SentinelPassword: pass,
-			DB:               db,
-			DialTimeout:      5 * time.Second,
-			ReadTimeout:      5 * time.Second,
-			WriteTimeout:     5 * time.Second,
+			SentinelAddrs:    cfg.Sentinels,
+			MasterName:       cfg.Master,
+			Password:         cfg.Password,
+			SentinelPassword: cfg.Password,
+			DB:               cfg.DB,
+			DialTimeout:      cfg.DialTimeout.Duration,
+			ReadTimeout:      cfg.ReadTimeout.Duration,
+			WriteTimeout:     cfg.WriteTimeout.Duration,
 		})
 	} else {
-		ip := os.Getenv("REDIS_IP")
-		port := os.Getenv("REDIS_PORT")
 		manager.Redis = redis.NewClient(&redis.Options{
-			Addr:         fmt.Sprintf("%s:%s", ip, port),
-			Password:     pass,
-			DB:           db,
-			DialTimeout:  5 * time.Second,
-			ReadTimeout:  5 * time.Second,
-			WriteTimeout: 5 * time.Second,
+			Addr:         fmt.Sprintf("%s:%d", cfg.IP, cfg.Port),
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			DialTimeout:  cfg.DialTimeout.Duration,
+			ReadTimeout:  cfg.ReadTimeout.Duration,
+			WriteTimeout: cfg.WriteTimeout.Duration,
 		})
 	}
 	manager.retryRedisConnect()
 }
 
-func (manager *Manager) OpenMongoConnection() {
-	url := os.Getenv("MONGO_URL")
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(url))
+func (manager *Manager) OpenMongoConnection(cfg config.Mongo) {
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.URL).SetConnectTimeout(cfg.ConnectTimeout.Duration))
 	if err != nil {
 		sentry.CaptureException(err)
 		log.WithField("type", "MongoDB").Fatalf("Failed to connect to mongodb instance: %s", err.Error())
@@ -148,9 +136,28 @@ func (manager *Manager) OpenMongoConnection() {
 			sentry.CaptureException(err)
 			log.WithField("type", "MongoDB").Warnf("Retry attempt %d failed!", attempt)
 		} else {
-			manager.Mongo = client.Database(os.Getenv("MONGO_DB"))
+			manager.Mongo = client.Database(cfg.DB)
 			log.WithField("type", "MongoDB").Infof("Connected on attempt %d!", attempt)
 			return
 		}
 	}
 }
+
+func (manager *Manager) Close(ctx context.Context) {
+	if manager.Mongo != nil {
+		if err := manager.Mongo.Client().Disconnect(ctx); err != nil {
+			sentry.CaptureException(err)
+			log.WithField("type", "MongoDB").Errorf("Failed to disconnect: %v", err)
+		} else {
+			log.WithField("type", "MongoDB").Info("Disconnected!")
+		}
+	}
+	if manager.Redis != nil {
+		if err := manager.Redis.Close(); err != nil {
+			sentry.CaptureException(err)
+			log.WithField("type", "Redis").Errorf("Failed to close: %v", err)
+		} else {
+			log.WithField("type", "Redis").Info("Closed!")
+		}
+	}
+}
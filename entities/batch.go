@@ -0,0 +1,225 @@
+package entities
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/metrics"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// entity is implemented by pointers to the entity types, normaliseID moves an id only found in _id to id.
+type entity[T any] interface {
+	*T
+	normaliseID() string
+}
+
+func (b *Bot) normaliseID() string {
+	if b.ID == "" {
+		b.ID = b.MongoID
+	}
+	b.MongoID = ""
+	return b.ID
+}
+
+func (u *User) normaliseID() string {
+	if u.ID == "" {
+		u.ID = u.MongoID
+	}
+	u.MongoID = ""
+	return u.ID
+}
+
+func (s *Server) normaliseID() string {
+	if s.ID == "" {
+		s.ID = s.MongoID
+	}
+	s.MongoID = ""
+	return s.ID
+}
+
+func (t *ServerTemplate) normaliseID() string {
+	if t.ID == "" {
+		t.ID = t.MongoID
+	}
+	t.MongoID = ""
+	return t.ID
+}
+
+// lookupMany resolves ids from the in-process cache, then with one HMGET for the rest and one $in query for those
+// still missing. Ids which don't exist are left out of the returned map.
+func lookupMany[T any, P entity[T]](ctx context.Context, lru *cache.LRU[T], col string, ids []string) (error, map[string]*T) {
+	found := make(map[string]*T, len(ids))
+	var uncached []string
+	for _, id := range ids {
+		if value, ok := lru.Get(id); ok {
+			found[id] = &value
+		} else {
+			uncached = append(uncached, id)
+		}
+	}
+	if len(uncached) == 0 {
+		return nil, found
+	}
+	generation := lru.Generation()
+	redisCtx, span := tracing.StartRedis(ctx, "HMGET", col)
+	values, err := util.Database.Redis.HMGet(redisCtx, col, uncached...).Result()
+	tracing.Error(span, err)
+	span.End()
+	missing := uncached
+	if err == nil {
+		missing = nil
+		for i, value := range values {
+			raw, _ := value.(string)
+			countRedisLookup(col, raw, nil)
+			decoded := new(T)
+			if raw == "" || json.Unmarshal([]byte(raw), decoded) != nil {
+				missing = append(missing, uncached[i])
+				continue
+			}
+			P(decoded).normaliseID()
+			found[uncached[i]] = decoded
+			lru.SetIfGeneration(uncached[i], *decoded, generation)
+		}
+	} else {
+		util.CaptureException(ctx, err)
+	}
+	if len(missing) == 0 {
+		return nil, found
+	}
+	mongoCtx, span := tracing.StartMongo(ctx, "Find", col)
+	defer span.End()
+	span.SetAttributes(attribute.Int("db.mongodb.ids", len(missing)))
+	cursor, err := util.Database.Mongo.Collection(col).Find(mongoCtx, bson.M{"_id": bson.M{"$in": missing}})
+	if err != nil {
+		tracing.Error(span, err)
+		metrics.MongoFallbacks.WithLabelValues(col, "error").Add(float64(len(missing)))
+		return err, nil
+	}
+	var documents []T
+	if err = cursor.All(mongoCtx, &documents); err != nil {
+		tracing.Error(span, err)
+		metrics.MongoFallbacks.WithLabelValues(col, "error").Add(float64(len(missing)))
+		return err, nil
+	}
+	for i := range documents {
+		id := P(&documents[i]).normaliseID()
+		found[id] = &documents[i]
+		lru.SetIfGeneration(id, documents[i], generation)
+	}
+	for _, id := range missing {
+		if _, ok := found[id]; ok {
+			metrics.MongoFallbacks.WithLabelValues(col, "found").Inc()
+		} else {
+			metrics.MongoFallbacks.WithLabelValues(col, "not_found").Inc()
+		}
+	}
+	return nil, found
+}
+
+func LookupBots(ctx context.Context, ids []string, clean bool) (error, map[string]*Bot) {
+	err, bots := lookupMany[Bot](ctx, botCache, "bots", ids)
+	if err == nil && clean {
+		for id, bot := range bots {
+			bots[id] = CleanupBot(fakeRank, bot)
+		}
+	}
+	return err, bots
+}
+
+func LookupUsers(ctx context.Context, ids []string, clean bool) (error, map[string]*User) {
+	err, users := lookupMany[User](ctx, userCache, "users", ids)
+	if err == nil && clean {
+		for id, user := range users {
+			users[id] = CleanupUser(fakeRank, user)
+		}
+	}
+	return err, users
+}
+
+func LookupServers(ctx context.Context, ids []string, clean bool) (error, map[string]*Server) {
+	err, servers := lookupMany[Server](ctx, serverCache, "servers", ids)
+	if err == nil && clean {
+		for id, server := range servers {
+			servers[id] = CleanupServer(fakeRank, server)
+		}
+	}
+	return err, servers
+}
+
+func LookupTemplates(ctx context.Context, ids []string) (error, map[string]*ServerTemplate) {
+	return lookupMany[ServerTemplate](ctx, templateCache, "templates", ids)
+}
+
+// BatchRequest is the body of the batch lookup routes.
+type BatchRequest struct {
+	IDs []string `json:"ids" validate:"min=1"`
+}
+
+// BatchResult is the outcome of one id of a batch lookup, exactly one of Data and Error is set.
+type BatchResult struct {
+	ID    string      `json:"id"`
+	Data  interface{} `json:"data"`
+	Error *APIError   `json:"error"`
+}
+
+type BatchResults []BatchResult
+
+func (b BatchResults) Legacy(status int) interface{} {
+	return map[string]interface{}{"error": false, "status": status, "results": b}
+}
+
+// DecodeBatch reads a BatchRequest, rejecting more ids than Config.MaxBatchSize. Duplicate ids are dropped.
+func DecodeBatch(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var body BatchRequest
+	if !Decode(w, r, &body) {
+		return nil, false
+	}
+	if len(body.IDs) > util.Config.MaxBatchSize {
+		Fail(w, r, ValidationError.WithFields([]FieldError{{Field: "ids", Message: "must have at most " + strconv.Itoa(util.Config.MaxBatchSize) + " elements"}}))
+		return nil, false
+	}
+	seen := make(map[string]bool, len(body.IDs))
+	ids := body.IDs[:0]
+	for _, id := range body.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, true
+}
+
+// RespondBatch answers a batch lookup with a result per id in the order they were asked for, ids which weren't
+// found get a not_found error. Entities are reduced to the fields asked for with ?fields=.
+func RespondBatch[T any](w http.ResponseWriter, r *http.Request, ids []string, found map[string]*T) {
+	var fields Fields
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		var errs []FieldError
+		if fields, errs = ParseFields(raw, reflect.TypeOf((*T)(nil)).Elem()); len(errs) > 0 {
+			Fail(w, r, InvalidFieldsError.WithFields(errs))
+			return
+		}
+	}
+	results := make(BatchResults, len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+		entity, ok := found[id]
+		switch {
+		case !ok:
+			notFound := NotFoundError
+			results[i].Error = &notFound
+		case fields != nil:
+			results[i].Data = fields.Project(reflect.ValueOf(entity))
+		default:
+			results[i].Data = entity
+		}
+	}
+	Respond(w, r, http.StatusOK, results)
+}
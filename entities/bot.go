@@ -3,14 +3,16 @@ package entities
 import (
 	"context"
 	"encoding/json"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/tracing"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
-	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"time"
 )
 
+var botCache = cache.New[Bot]("bots", 4096, 1*time.Minute)
+
 type BotStatus struct {
 	Approved bool `json:"approved"`
 	Premium  bool `json:"premium,omitempty"`
@@ -94,10 +96,12 @@ func CleanupBot(rank UserRank, bot *Bot) *Bot {
 	return &copied
 }
 
-func mongoLookupBot(id string) (error, *Bot) {
+func mongoLookupBot(ctx context.Context, id string) (error, *Bot) {
+	ctx, span := tracing.StartMongo(ctx, "FindOne", "bots")
+	defer span.End()
 	findStart := time.Now()
 	var findEnd int64
-	res := util.Database.Mongo.Collection("bots").FindOne(context.TODO(), bson.M{"_id": id})
+	res := util.Database.Mongo.Collection("bots").FindOne(ctx, bson.M{"_id": id})
 	if res.Err() != nil {
 		AddMongoLookupTime("bots", id, time.Since(findStart).Microseconds(), -1)
 		return res.Err(), nil
@@ -107,7 +111,8 @@ func mongoLookupBot(id string) (error, *Bot) {
 	decodeStart := time.Now()
 	var decodeEnd int64
 	if err := res.Decode(&bot); err != nil {
-		sentry.CaptureException(err)
+		util.CaptureException(ctx, err)
+		tracing.Error(span, err)
 		AddMongoLookupTime("bots", id, findEnd, time.Since(decodeStart).Microseconds())
 		return err, nil
 	}
@@ -116,26 +121,47 @@ func mongoLookupBot(id string) (error, *Bot) {
 	return nil, &bot
 }
 
-func LookupBot(id string, clean bool) (error, *Bot) {
+func LookupBot(ctx context.Context, id string, clean bool) (error, *Bot) {
+	err, bot := botCache.Fetch(id, func() (error, Bot) {
+		err, bot := redisLookupBot(context.WithoutCancel(ctx), id)
+		if err != nil {
+			return err, Bot{}
+		}
+		return nil, *bot
+	})
+	if err != nil {
+		return err, nil
+	}
+	if clean {
+		return nil, CleanupBot(fakeRank, &bot)
+	}
+	return nil, &bot
+}
+
+// FreshBot looks a bot up in redis without the LRU, whose copy may be older than the website's latest write. It isn't
+// cleaned.
+func FreshBot(ctx context.Context, id string) (error, *Bot) {
+	return redisLookupBot(ctx, id)
+}
+
+func redisLookupBot(ctx context.Context, id string) (error, *Bot) {
 	findStart := time.Now()
 	var findEnd int64
-	redisBot, err := util.Database.Redis.HGet(context.TODO(), "bots", id).Result()
+	redisBot, err := hget(ctx, "bots", id)
+	countRedisLookup("bots", redisBot, err)
 	if err == nil {
 		findEnd = time.Since(findStart).Microseconds()
 		if redisBot == "" {
-			err, bot := mongoLookupBot(id)
+			err, bot := fallback(ctx, "bots", id, mongoLookupBot)
 			if err != nil {
 				if err == mongo.ErrNoDocuments {
 					return err, nil
 				}
-				sentry.CaptureException(err)
-				log.Errorf("Fallback for MongoDB failed for LookupBot(%s): %v", id, err.Error())
+				util.CaptureException(ctx, err)
+				util.Log(ctx).Errorf("Fallback for MongoDB failed for LookupBot(%s): %v", id, err.Error())
 				return LookupError, nil
 			} else {
 				bot.MongoID = ""
-				if clean {
-					bot = CleanupBot(fakeRank, bot)
-				}
 				return nil, bot
 			}
 		}
@@ -143,9 +169,9 @@ func LookupBot(id string, clean bool) (error, *Bot) {
 		decodeStart := time.Now()
 		err = json.Unmarshal([]byte(redisBot), &bot)
 		if err != nil {
-			sentry.CaptureException(err)
+			util.CaptureException(ctx, err)
 			AddRedisLookupTime("bots", id, findEnd, time.Since(decodeStart).Microseconds())
-			log.Errorf("Json parsing failed for LookupBot(%s): %v", id, err.Error())
+			util.Log(ctx).Errorf("Json parsing failed for LookupBot(%s): %v", id, err.Error())
 			return LookupError, nil
 		} else {
 			if bot.ID == "" {
@@ -154,33 +180,30 @@ func LookupBot(id string, clean bool) (error, *Bot) {
 			} else {
 				bot.MongoID = ""
 			}
-			if clean {
-				bot = CleanupBot(fakeRank, bot)
-			}
 			AddRedisLookupTime("bots", id, findEnd, time.Since(decodeStart).Microseconds())
 			return nil, bot
 		}
 	} else {
-		err, bot := mongoLookupBot(id)
+		err, bot := fallback(ctx, "bots", id, mongoLookupBot)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return err, nil
 			}
-			sentry.CaptureException(err)
-			log.Errorf("Fallback for MongoDB failed for LookupBot(%s): %v", id, err.Error())
+			util.CaptureException(ctx, err)
+			util.Log(ctx).Errorf("Fallback for MongoDB failed for LookupBot(%s): %v", id, err.Error())
 			return LookupError, nil
 		} else {
 			bot.MongoID = ""
-			if clean {
-				bot = CleanupBot(fakeRank, bot)
-			}
 			return nil, bot
 		}
 	}
 }
 
-func GetAllBots(clean bool) (error, []Bot) {
-	redisBots := util.Scan[Bot]("bots")
+func GetAllBots(ctx context.Context, clean bool) (error, []Bot) {
+	err, redisBots := util.Scan[Bot](ctx, "bots")
+	if err != nil {
+		return err, nil
+	}
 	var actual []Bot
 	for _, bot := range redisBots {
 		if bot.ID == "" {
@@ -196,3 +219,21 @@ func GetAllBots(clean bool) (error, []Bot) {
 	}
 	return nil, actual
 }
+
+// EachBot calls fn with every cached bot as it is scanned from redis, entries which fail to decode are skipped.
+func EachBot(ctx context.Context, clean bool, fn func(bot *Bot) error) error {
+	return util.ScanEach(ctx, "bots", func(_, value string) error {
+		bot := Bot{}
+		if err := json.Unmarshal([]byte(value), &bot); err != nil {
+			return nil
+		}
+		if bot.ID == "" {
+			bot.ID = bot.MongoID
+		}
+		bot.MongoID = ""
+		if clean {
+			return fn(CleanupBot(fakeRank, &bot))
+		}
+		return fn(&bot)
+	})
+}
@@ -2,53 +2,484 @@ package entities
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"github.com/discordextremelist/api/cache"
 	"github.com/discordextremelist/api/util"
 	"github.com/getsentry/sentry-go"
+	"github.com/go-redis/redis/v8"
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
-var collections = []string{"bots", "users", "servers", "templates"}
+const (
+	DefaultSyncBatchSize = 500
+	syncLockKey          = "cache_sync_lock"
+	syncLockTTL          = 15 * time.Minute
+	shadowSuffix         = "_shadow"
+)
+
+var (
+	collections       = []string{"bots", "users", "servers", "templates"}
+	SyncInProgress    = errors.New("a cache sync is already in progress")
+	SyncLockLost      = errors.New("the cache sync lock was lost, another sync may have taken over")
+	UnknownCollection = errors.New("unknown collection")
+	NothingDecoded    = errors.New("no entities could be decoded, refusing to replace the cache")
+)
+
+type CacheSyncOptions struct {
+	Collections []string
+	BatchSize   int
+	DryRun      bool
+}
+
+type CacheDrift struct {
+	Collection   string              `json:"collection"`
+	DryRun       bool                `json:"dry_run"`
+	Synced       int                 `json:"synced"`
+	DecodeErrors int                 `json:"decode_errors"`
+	Missing      []string            `json:"missing"`
+	Extra        []string            `json:"extra"`
+	Stale        map[string][]string `json:"stale"`
+	// Refreshed are the entities changed while the sync ran, copied again once it replaced the cache.
+	Refreshed []string `json:"refreshed"`
+	Took      int64    `json:"took"`
+}
+
+func (d *CacheDrift) HasDrift() bool {
+	return len(d.Missing) > 0 || len(d.Extra) > 0 || len(d.Stale) > 0
+}
+
+type cacheEntry struct {
+	id    string
+	value string
+	score float64
+}
+
+// ranking is a sorted set rebuilt along with a collection's hash, scoring its entities by a numeric field.
+type ranking struct {
+	key   string
+	field string
+}
+
+var rankings = map[string]ranking{"templates": {key: TemplatesByUsage, field: "usageCount"}}
+
+func score(value interface{}) float64 {
+	switch value := value.(type) {
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case float64:
+		return value
+	}
+	return 0
+}
 
 func PopulateDevCache() {
 	logrus.Info("Populating redis cache for development use...")
-	for _, col := range collections {
-		_ = util.Database.Redis.Del(context.TODO(), col)
-		start := time.Now()
-		logrus.Infof("Populating redis cache for collection %s...", col)
-		var mongoEntities []bson.M
-		cursor, err := util.Database.Mongo.Collection(col).Find(context.TODO(), bson.M{})
+	err, _ := SyncCache(context.Background(), CacheSyncOptions{})
+	if err != nil {
+		logrus.Errorf("Failed to populate cache: %v", err)
+	}
+}
+
+// releaseLockScript deletes the sync lock only while it is still ours, a sync outliving syncLockTTL mustn't release
+// the lock of the one which took over.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// syncLockRenewal is how often a running sync renews its lock.
+var syncLockRenewal = syncLockTTL / 3
+
+// renewLockScript extends the sync lock while it is still ours.
+var renewLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// replaceScript moves shadow keys over the live ones, KEYS[2:] being pairs of both, while the sync lock in KEYS[1] is
+// still held by ARGV[1]. The live keys are deleted instead when ARGV[2] is 0, i.e. nothing was synced. Shadows expire
+// in case a sync dies, which RENAME would carry over.
+var replaceScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+for i = 2, #KEYS, 2 do
+	if ARGV[2] == '0' then
+		redis.call('DEL', KEYS[i + 1])
+	else
+		redis.call('RENAME', KEYS[i], KEYS[i + 1])
+		redis.call('PERSIST', KEYS[i + 1])
+	end
+end
+return 1
+`)
+
+// holdLock renews the sync lock until ctx is done, cancelling it with SyncLockLost when the lock isn't ours anymore.
+func holdLock(ctx context.Context, owner string, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(syncLockRenewal)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		renewed, err := renewLockScript.Run(ctx, util.Database.Redis, []string{syncLockKey}, owner, syncLockTTL.Milliseconds()).Int()
+		if err != nil {
+			// Retried on the next tick, the lock outlives two of them.
+			logrus.Warnf("Failed to renew the cache sync lock: %v", err)
+			continue
+		}
+		if renewed == 0 {
+			cancel(SyncLockLost)
+			return
+		}
+	}
+}
+
+func SyncCache(ctx context.Context, opts CacheSyncOptions) (error, []*CacheDrift) {
+	if len(opts.Collections) == 0 {
+		opts.Collections = collections
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultSyncBatchSize
+	}
+	for _, col := range opts.Collections {
+		if !isCollection(col) {
+			return UnknownCollection, nil
+		}
+	}
+	owner := ""
+	if !opts.DryRun {
+		hostname, _ := os.Hostname()
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		owner = hostname + "-" + hex.EncodeToString(b)
+		acquired, err := util.Database.Redis.SetNX(ctx, syncLockKey, owner, syncLockTTL).Result()
+		if err != nil {
+			return err, nil
+		}
+		if !acquired {
+			return SyncInProgress, nil
+		}
+		defer releaseLockScript.Run(context.Background(), util.Database.Redis, []string{syncLockKey}, owner)
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		go holdLock(ctx, owner, cancel)
+	}
+	var report []*CacheDrift
+	for _, col := range opts.Collections {
+		err, drift := syncCollection(ctx, col, owner, opts)
+		if errors.Is(context.Cause(ctx), SyncLockLost) {
+			err = SyncLockLost
+		}
 		if err != nil {
 			sentry.CaptureException(err)
-			logrus.Errorf("Failed querying database for collection %s: %s", col, err.Error())
+			logrus.WithField("collection", col).Errorf("Cache sync failed: %v", err)
+			return err, report
+		}
+		logrus.WithField("collection", col).Infof(
+			"Took %s to sync %d entities (missing: %d, extra: %d, stale: %d, decode errors: %d, dry run: %t)",
+			time.Duration(drift.Took)*time.Millisecond, drift.Synced, len(drift.Missing), len(drift.Extra), len(drift.Stale), drift.DecodeErrors, drift.DryRun,
+		)
+		report = append(report, drift)
+	}
+	return nil, report
+}
+
+func isCollection(col string) bool {
+	for _, c := range collections {
+		if c == col {
+			return true
+		}
+	}
+	return false
+}
+
+// syncCollection copies col from MongoDB into redis. Every sync writes to shadows of its own, named after the owner
+// of the lock, so a sync which lost its lock can't mix its entities into those of the one which took over.
+func syncCollection(ctx context.Context, col, owner string, opts CacheSyncOptions) (error, *CacheDrift) {
+	start := time.Now()
+	drift := &CacheDrift{
+		Collection: col,
+		DryRun:     opts.DryRun,
+		Missing:    []string{},
+		Extra:      []string{},
+		Stale:      map[string][]string{},
+		Refreshed:  []string{},
+	}
+	suffix := shadowSuffix + ":" + owner
+	shadow := col + suffix
+	rank, ranked := rankings[col]
+	var changed func() []string
+	if !opts.DryRun {
+		// Entities changed after they were copied would be reverted by the RENAME, they are copied again after it.
+		var err error
+		if err, changed = invalidations(ctx, col); err != nil {
+			return err, nil
+		}
+		defer changed()
+	}
+	cursor, err := util.Database.Mongo.Collection(col).Find(ctx, bson.M{}, options.Find().SetBatchSize(int32(opts.BatchSize)))
+	if err != nil {
+		return err, nil
+	}
+	defer cursor.Close(context.Background())
+	seen := make(map[string]struct{})
+	batch := make([]cacheEntry, 0, opts.BatchSize)
+	for cursor.Next(ctx) {
+		var entity bson.M
+		if err := cursor.Decode(&entity); err != nil {
+			sentry.CaptureException(err)
+			logrus.WithField("collection", col).Errorf("Failed to decode an entity: %v", err)
+			drift.DecodeErrors++
 			continue
 		}
-		for cursor.Next(context.TODO()) {
-			var entity bson.M
-			err = cursor.Decode(&entity)
-			mongoEntities = append(mongoEntities, entity)
-		}
-		_ = cursor.Close(context.TODO())
-		var toSet []string
-		for _, entity := range mongoEntities {
-			id := entity["_id"].(string)
-			marshaled, err := json.Marshal(&entity)
-			if err != nil {
-				sentry.CaptureException(err)
-				logrus.Errorf("Failed to marshal an entity for cache %s (col: %s, err: %s)", id, col, err.Error())
-				continue
+		id, ok := entity["_id"].(string)
+		if !ok {
+			logrus.WithField("collection", col).Errorf("Entity has a non-string _id: %v", entity["_id"])
+			drift.DecodeErrors++
+			continue
+		}
+		marshaled, err := json.Marshal(&entity)
+		if err != nil {
+			sentry.CaptureException(err)
+			logrus.WithField("collection", col).Errorf("Failed to marshal entity %s: %v", id, err)
+			drift.DecodeErrors++
+			continue
+		}
+		seen[id] = struct{}{}
+		entry := cacheEntry{id: id, value: string(marshaled)}
+		if ranked {
+			entry.score = score(entity[rank.field])
+		}
+		batch = append(batch, entry)
+		if len(batch) >= opts.BatchSize {
+			if err := flushBatch(ctx, col, suffix, batch, drift); err != nil {
+				return err, nil
 			}
-			toSet = append(toSet, id)
-			toSet = append(toSet, string(marshaled))
+			batch = batch[:0]
 		}
-		err = util.Database.Redis.HMSet(context.TODO(), col, toSet).Err()
+	}
+	if err := cursor.Err(); err != nil {
+		return err, nil
+	}
+	if err := flushBatch(ctx, col, suffix, batch, drift); err != nil {
+		return err, nil
+	}
+	if err := findExtra(ctx, col, seen, drift); err != nil {
+		return err, nil
+	}
+	if drift.Synced == 0 && drift.DecodeErrors > 0 {
+		return NothingDecoded, nil
+	}
+	if !opts.DryRun {
+		keys := []string{syncLockKey, shadow, col}
+		if ranked {
+			keys = append(keys, rank.key+suffix, rank.key)
+		}
+		replaced, err := replaceScript.Run(ctx, util.Database.Redis, keys, owner, drift.Synced).Int()
 		if err != nil {
+			return err, nil
+		}
+		if replaced == 0 {
+			return SyncLockLost, nil
+		}
+		drift.Refreshed = changed()
+		if err = refresh(ctx, col, drift.Refreshed); err != nil {
+			return err, nil
+		}
+		if err = cache.Publish(ctx, util.Database.Redis, col, cache.All); err != nil {
 			sentry.CaptureException(err)
-			logrus.Errorf("Failed to populate cache for redis map %s, %v", col, err.Error())
+		}
+	}
+	drift.Took = time.Since(start).Milliseconds()
+	return nil, drift
+}
+
+// flushBatch compares a batch with the cache and writes it to the shadows with suffix.
+func flushBatch(ctx context.Context, col, suffix string, batch []cacheEntry, drift *CacheDrift) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	ids := make([]string, len(batch))
+	toSet := make([]interface{}, 0, len(batch)*2)
+	for i, entry := range batch {
+		ids[i] = entry.id
+		toSet = append(toSet, entry.id, entry.value)
+	}
+	live, err := util.Database.Redis.HMGet(ctx, col, ids...).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	for i, entry := range batch {
+		current, ok := live[i].(string)
+		if !ok {
+			drift.Missing = append(drift.Missing, entry.id)
 			continue
 		}
-		logrus.Infof("Took %s to populate cache!", time.Now().Sub(start))
+		if fields := staleFields(current, entry.value); len(fields) > 0 {
+			drift.Stale[entry.id] = fields
+		}
+	}
+	if !drift.DryRun {
+		_, err := util.Database.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, col+suffix, toSet...)
+			pipe.Expire(ctx, col+suffix, syncLockTTL)
+			if rank, ok := rankings[col]; ok {
+				scores := make([]*redis.Z, len(batch))
+				for i, entry := range batch {
+					scores[i] = &redis.Z{Score: entry.score, Member: entry.id}
+				}
+				pipe.ZAdd(ctx, rank.key+suffix, scores...)
+				pipe.Expire(ctx, rank.key+suffix, syncLockTTL)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	drift.Synced += len(batch)
+	return nil
+}
+
+// invalidations collects the ids of col invalidated from now on, which the returned function stops and returns.
+func invalidations(ctx context.Context, col string) (error, func() []string) {
+	sub := util.Database.Redis.Subscribe(ctx, cache.InvalidationChannel)
+	// Waits for the subscription, invalidations before it are covered by the scan.
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return err, nil
+	}
+	var mutex sync.Mutex
+	changed := map[string]struct{}{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range sub.Channel() {
+			name, id, ok := strings.Cut(msg.Payload, ":")
+			if ok && name == col && id != cache.All {
+				mutex.Lock()
+				changed[id] = struct{}{}
+				mutex.Unlock()
+			}
+		}
+	}()
+	var once sync.Once
+	ids := []string{}
+	return nil, func() []string {
+		once.Do(func() {
+			sub.Close()
+			<-done
+			for id := range changed {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+		})
+		return ids
+	}
+}
+
+// refresh copies the entities called ids from MongoDB into the cache again, removing those which were deleted.
+func refresh(ctx context.Context, col string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	cursor, err := util.Database.Mongo.Collection(col).Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	var documents []bson.M
+	if err = cursor.All(ctx, &documents); err != nil {
+		return err
+	}
+	rank, ranked := rankings[col]
+	_, err = util.Database.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		found := map[string]bool{}
+		for _, document := range documents {
+			id, _ := document["_id"].(string)
+			marshaled, err := json.Marshal(&document)
+			if id == "" || err != nil {
+				continue
+			}
+			found[id] = true
+			pipe.HSet(ctx, col, id, string(marshaled))
+			if ranked {
+				pipe.ZAdd(ctx, rank.key, &redis.Z{Score: score(document[rank.field]), Member: id})
+			}
+		}
+		for _, id := range ids {
+			if !found[id] {
+				pipe.HDel(ctx, col, id)
+				if ranked {
+					pipe.ZRem(ctx, rank.key, id)
+				}
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func findExtra(ctx context.Context, col string, seen map[string]struct{}, drift *CacheDrift) error {
+	var cursor uint64 = 0
+	for {
+		keys, next, err := util.Database.Redis.HScan(ctx, col, cursor, "", int64(DefaultSyncBatchSize)).Result()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(keys); i += 2 {
+			if _, ok := seen[keys[i]]; !ok {
+				drift.Extra = append(drift.Extra, keys[i])
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// staleFields compares the cached and freshly marshaled entity by top level
+// field, "*" is returned when the cached value isn't valid json.
+func staleFields(cached, fresh string) []string {
+	var old, updated map[string]interface{}
+	if err := json.Unmarshal([]byte(cached), &old); err != nil {
+		return []string{"*"}
+	}
+	if err := json.Unmarshal([]byte(fresh), &updated); err != nil {
+		return []string{"*"}
+	}
+	var fields []string
+	for k, v := range updated {
+		if ov, ok := old[k]; !ok || !reflect.DeepEqual(ov, v) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range old {
+		if _, ok := updated[k]; !ok {
+			fields = append(fields, k)
+		}
 	}
+	sort.Strings(fields)
+	return fields
 }
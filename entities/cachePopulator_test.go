@@ -0,0 +1,89 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-redis/redis/v8"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	util.Database.Redis = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	return server
+}
+
+func TestReplaceNeedsTheLock(t *testing.T) {
+	server := testRedis(t)
+	ctx := context.Background()
+	server.HSet("bots", "1", "live")
+	server.HSet("bots_shadow:mine", "1", "synced")
+	server.SetTTL("bots_shadow:mine", time.Minute)
+	keys := []string{syncLockKey, "bots_shadow:mine", "bots"}
+	server.Set(syncLockKey, "theirs")
+	if replaced, err := replaceScript.Run(ctx, util.Database.Redis, keys, "mine", 1).Int(); err != nil || replaced != 0 {
+		t.Fatalf("replaced = %d, %v without holding the lock", replaced, err)
+	}
+	if server.HGet("bots", "1") != "live" {
+		t.Fatal("the live hash was replaced without holding the lock")
+	}
+	server.Set(syncLockKey, "mine")
+	if replaced, err := replaceScript.Run(ctx, util.Database.Redis, keys, "mine", 1).Int(); err != nil || replaced != 1 {
+		t.Fatalf("replaced = %d, %v holding the lock", replaced, err)
+	}
+	if server.HGet("bots", "1") != "synced" || server.TTL("bots") != 0 {
+		t.Fatalf("live hash = %q with TTL %s, want the shadow without its expiry", server.HGet("bots", "1"), server.TTL("bots"))
+	}
+}
+
+func TestLostLockCancelsSync(t *testing.T) {
+	server := testRedis(t)
+	defer func(renewal time.Duration) { syncLockRenewal = renewal }(syncLockRenewal)
+	syncLockRenewal = 10 * time.Millisecond
+	server.Set(syncLockKey, "mine")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go holdLock(ctx, "mine", cancel)
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("the sync was cancelled while it held the lock")
+	}
+	if server.TTL(syncLockKey) == 0 {
+		t.Fatal("the lock wasn't renewed")
+	}
+	// It expired and another sync took over.
+	server.Set(syncLockKey, "theirs")
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the sync kept running without its lock")
+	}
+	if !errors.Is(context.Cause(ctx), SyncLockLost) {
+		t.Fatalf("cause = %v, want SyncLockLost", context.Cause(ctx))
+	}
+}
+
+func TestInvalidationsDuringSync(t *testing.T) {
+	testRedis(t)
+	ctx := context.Background()
+	err, changed := invalidations(ctx, "bots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range [][2]string{{"bots", "2"}, {"users", "3"}, {"bots", cache.All}, {"bots", "1"}} {
+		if err := cache.Publish(ctx, util.Database.Redis, message[0], message[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Messages arrive asynchronously.
+	time.Sleep(50 * time.Millisecond)
+	if ids := changed(); !slices.Equal(ids, []string{"1", "2"}) {
+		t.Fatalf("changed = %v, want the bots invalidated by id", ids)
+	}
+}
@@ -0,0 +1,128 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/discordextremelist/api/util"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes responses and decodes request bodies in one wire format. Every format uses the json struct tags.
+type Codec struct {
+	ContentType string
+	Marshal     func(v interface{}) ([]byte, error)
+	// Unmarshal rejects unknown fields and trailing data.
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+var (
+	JSONCodec = Codec{
+		ContentType: "application/json",
+		Marshal: func(v interface{}) ([]byte, error) {
+			encoded, err := json.Marshal(v)
+			return append(encoded, '\n'), err
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(v); err != nil {
+				return err
+			}
+			if _, err := decoder.Token(); err != io.EOF {
+				return errors.New("unexpected data after the JSON body")
+			}
+			return nil
+		},
+	}
+	MsgpackCodec = Codec{
+		ContentType: "application/msgpack",
+		Marshal: func(v interface{}) ([]byte, error) {
+			var buffer bytes.Buffer
+			encoder := msgpack.NewEncoder(&buffer)
+			encoder.SetCustomStructTag("json")
+			encoder.UseCompactInts(true)
+			err := encoder.Encode(v)
+			return buffer.Bytes(), err
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			reader := bytes.NewReader(data)
+			decoder := msgpack.NewDecoder(reader)
+			decoder.SetCustomStructTag("json")
+			decoder.DisallowUnknownFields(true)
+			if err := decoder.Decode(v); err != nil {
+				return err
+			}
+			if reader.Len() > 0 {
+				return errors.New("unexpected data after the msgpack body")
+			}
+			return nil
+		},
+	}
+	CBORCodec = Codec{
+		ContentType: "application/cbor",
+		Marshal:     cbor.Marshal,
+		Unmarshal:   cborDecoding.Unmarshal,
+	}
+)
+
+var cborDecoding, _ = cbor.DecOptions{ExtraReturnErrors: cbor.ExtraDecErrorUnknownField}.DecMode()
+
+// Codecs are the formats clients can choose between with Accept and Content-Type, the first is the default.
+var Codecs = []Codec{JSONCodec, MsgpackCodec, CBORCodec}
+
+// CodecFor returns the codec of a Content-Type header.
+func CodecFor(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Codec{}, false
+	}
+	for _, codec := range Codecs {
+		if codec.ContentType == mediaType {
+			return codec, true
+		}
+	}
+	return Codec{}, false
+}
+
+// Negotiate picks the codec with the highest q-value in the Accept header, JSON when none of them is accepted.
+func Negotiate(r *http.Request) Codec {
+	best, bestQ := JSONCodec, 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		for _, codec := range Codecs {
+			if codec.ContentType == mediaType && q > bestQ {
+				best, bestQ = codec, q
+			}
+		}
+	}
+	return best
+}
+
+// write encodes v with codec, encoding failures are answered with InternalError as JSON.
+func write(w http.ResponseWriter, r *http.Request, codec Codec, status int, v interface{}) {
+	body, err := codec.Marshal(v)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		failWith(w, r, JSONCodec, InternalError)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
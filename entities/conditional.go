@@ -0,0 +1,68 @@
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/discordextremelist/api/util"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// apiRoute is the pattern of the route serving r without its version prefix, as written in the Route blocks.
+func apiRoute(r *http.Request) string {
+	route := versionPrefix.ReplaceAllString(routePattern(r), "/")
+	if len(route) > 1 {
+		route = strings.TrimSuffix(route, "/")
+	}
+	return route
+}
+
+func cacheControl(r *http.Request) string {
+	if policy, ok := util.Config.CacheControl[apiRoute(r)]; ok {
+		return policy
+	}
+	return "no-cache"
+}
+
+// ETag returns a strong entity tag for a representation's canonical encoding.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified evaluates If-None-Match as described in RFC 9110 section 13.2.2. There is no Last-Modified to evaluate
+// If-Modified-Since against, the entities don't carry modification times and replicas can't agree on one.
+func notModified(r *http.Request, tag string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	match := r.Header.Get("If-None-Match")
+	return match != "" && etagMatches(match, tag)
+}
+
+// Precondition sets the validators of a successful GET response and writes 304 Not Modified when the client's copy
+// is still current, in which case it returns true. key is the canonical encoding the ETag is computed from.
+func Precondition(w http.ResponseWriter, r *http.Request, key []byte) bool {
+	tag := ETag(key)
+	header := w.Header()
+	header.Set("ETag", tag)
+	header.Set("Cache-Control", cacheControl(r))
+	if notModified(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
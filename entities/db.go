@@ -0,0 +1,33 @@
+package entities
+
+import (
+	"context"
+	"errors"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func hget(ctx context.Context, key, field string) (string, error) {
+	ctx, span := tracing.StartRedis(ctx, "HGET", key)
+	defer span.End()
+	res, err := util.Database.Redis.HGet(ctx, key, field).Result()
+	if err != redis.Nil {
+		tracing.Error(span, err)
+	}
+	return res, err
+}
+
+// fallback looks an entity missing from redis up in MongoDB within its own span.
+func fallback[T any](ctx context.Context, col, id string, lookup func(ctx context.Context, id string) (error, *T)) (error, *T) {
+	ctx, span := tracing.Start(ctx, "cache.fallback", attribute.String("db.collection.name", col), attribute.String("entity.id", id))
+	defer span.End()
+	err, entity := lookup(ctx, id)
+	countMongoFallback(col, err)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		tracing.Error(span, err)
+	}
+	return err, entity
+}
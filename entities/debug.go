@@ -1,99 +1,122 @@
 package entities
 
 import (
+	"errors"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/metrics"
+	"go.mongodb.org/mongo-driver/mongo"
 	"sync"
+	"time"
 )
 
+const recentSamples = 100
+
 type ResponseTime struct {
 	Path                 string `json:"path,omitempty"`
+	Collection           string `json:"collection,omitempty"`
+	ID                   string `json:"id,omitempty"`
 	TimeTakenToLookup    int64  `json:"time_taken_to_lookup"`
 	TimeSpentDecoding    int64  `json:"time_spent_decoding"`
 	TimeSpentWritingBody int64  `json:"time_spent_writing_body"`
 }
 
 type LookupTimes struct {
-	Mongo map[string]map[string][]ResponseTime `json:"mongo"`
-	Redis map[string]map[string][]ResponseTime `json:"redis"`
+	Mongo []ResponseTime `json:"mongo"`
+	Redis []ResponseTime `json:"redis"`
 }
 
 type DebugStatistics struct {
-	MongoPing     int64          `json:"mongo_ping"`
-	RedisPing     int64          `json:"redis_ping"`
-	Node          string         `json:"node"`
-	LookupTimes   LookupTimes    `json:"lookup_times"`
-	ResponseTimes []ResponseTime `json:"response_times"`
-	Hostname      string         `json:"hostname"`
+	MongoPing     int64                  `json:"mongo_ping"`
+	RedisPing     int64                  `json:"redis_ping"`
+	Node          string                 `json:"node"`
+	Pod           string                 `json:"pod,omitempty"`
+	Namespace     string                 `json:"namespace,omitempty"`
+	Zone          string                 `json:"zone,omitempty"`
+	Region        string                 `json:"region,omitempty"`
+	LookupTimes   LookupTimes            `json:"lookup_times"`
+	ResponseTimes []ResponseTime         `json:"response_times"`
+	Hostname      string                 `json:"hostname"`
+	Cache         map[string]cache.Stats `json:"cache"`
+}
+
+// samples keeps the most recent ResponseTime entries, overwriting the oldest once full.
+type samples struct {
+	mutex   sync.Mutex
+	entries []ResponseTime
+	next    int
+}
+
+func (s *samples) add(entry ResponseTime) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.entries) < recentSamples {
+		s.entries = append(s.entries, entry)
+		return
+	}
+	s.entries[s.next] = entry
+	s.next = (s.next + 1) % recentSamples
+}
+
+// Recent returns a copy of the samples, oldest first.
+func (s *samples) Recent() []ResponseTime {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	recent := make([]ResponseTime, 0, len(s.entries))
+	recent = append(recent, s.entries[s.next:]...)
+	return append(recent, s.entries[:s.next]...)
 }
 
 var (
-	MongoLookupTimes = make(map[string]map[string][]ResponseTime)
-	RedisLookupTimes = make(map[string]map[string][]ResponseTime)
-	ResponseTimes    []ResponseTime
-	mutex            = &sync.Mutex{}
+	MongoLookupTimes = &samples{}
+	RedisLookupTimes = &samples{}
+	ResponseTimes    = &samples{}
 )
 
-func AddMongoLookupTime(col, id string, lookup int64, unmarshal int64) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	if _, ok := MongoLookupTimes[col]; ok {
-		if itemEntry, ok := MongoLookupTimes[col][id]; ok {
-			itemEntry = append(itemEntry, ResponseTime{
-				TimeTakenToLookup:    lookup,
-				TimeSpentDecoding:    unmarshal,
-				TimeSpentWritingBody: 0,
-			})
-			MongoLookupTimes[col][id] = itemEntry
-		} else {
-			MongoLookupTimes[col][id] = []ResponseTime{
-				{
-					TimeTakenToLookup:    lookup,
-					TimeSpentDecoding:    unmarshal,
-					TimeSpentWritingBody: 0,
-				},
-			}
-		}
-	} else {
-		MongoLookupTimes[col] = map[string][]ResponseTime{
-			id: {
-				{
-					TimeTakenToLookup:    lookup,
-					TimeSpentDecoding:    unmarshal,
-					TimeSpentWritingBody: 0,
-				},
-			},
-		}
+func observeLookup(source, col string, lookup int64, unmarshal int64) {
+	total := lookup
+	if unmarshal > 0 {
+		total += unmarshal
 	}
+	metrics.LookupDuration.WithLabelValues(source, col).Observe((time.Duration(total) * time.Microsecond).Seconds())
+}
+
+func AddMongoLookupTime(col, id string, lookup int64, unmarshal int64) {
+	observeLookup("mongo", col, lookup, unmarshal)
+	MongoLookupTimes.add(ResponseTime{
+		Collection:           col,
+		ID:                   id,
+		TimeTakenToLookup:    lookup,
+		TimeSpentDecoding:    unmarshal,
+		TimeSpentWritingBody: 0,
+	})
 }
 
 func AddRedisLookupTime(col, id string, lookup int64, unmarshal int64) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	if _, ok := RedisLookupTimes[col]; ok {
-		if itemEntry, ok := RedisLookupTimes[col][id]; ok {
-			itemEntry = append(itemEntry, ResponseTime{
-				TimeTakenToLookup:    lookup,
-				TimeSpentDecoding:    unmarshal,
-				TimeSpentWritingBody: -1,
-			})
-			RedisLookupTimes[col][id] = itemEntry
-		} else {
-			RedisLookupTimes[col][id] = []ResponseTime{
-				{
-					TimeTakenToLookup:    lookup,
-					TimeSpentDecoding:    unmarshal,
-					TimeSpentWritingBody: -1,
-				},
-			}
-		}
+	observeLookup("redis", col, lookup, unmarshal)
+	RedisLookupTimes.add(ResponseTime{
+		Collection:           col,
+		ID:                   id,
+		TimeTakenToLookup:    lookup,
+		TimeSpentDecoding:    unmarshal,
+		TimeSpentWritingBody: -1,
+	})
+}
+
+func countRedisLookup(col, value string, err error) {
+	if err == nil && value != "" {
+		metrics.RedisLookups.WithLabelValues(col, "hit").Inc()
 	} else {
-		RedisLookupTimes[col] = map[string][]ResponseTime{
-			id: {
-				{
-					TimeTakenToLookup:    lookup,
-					TimeSpentDecoding:    unmarshal,
-					TimeSpentWritingBody: -1,
-				},
-			},
-		}
+		metrics.RedisLookups.WithLabelValues(col, "miss").Inc()
+	}
+}
+
+func countMongoFallback(col string, err error) {
+	switch {
+	case err == nil:
+		metrics.MongoFallbacks.WithLabelValues(col, "found").Inc()
+	case errors.Is(err, mongo.ErrNoDocuments):
+		metrics.MongoFallbacks.WithLabelValues(col, "not_found").Inc()
+	default:
+		metrics.MongoFallbacks.WithLabelValues(col, "error").Inc()
 	}
 }
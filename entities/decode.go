@@ -0,0 +1,102 @@
+package entities
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/discordextremelist/api/util"
+	"github.com/fxamacker/cbor/v2"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Decode reads the body of r into v, a pointer to a struct, in the format named by its Content-Type and validates it.
+// Bodies over the configured size, unknown fields and trailing data are rejected. When it returns false the error has
+// already been written.
+func Decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	codec, ok := CodecFor(r.Header.Get(util.ContentType))
+	if !ok {
+		Fail(w, r, BadContentType)
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(util.Config.MaxBodyBytes)))
+	if err == nil {
+		err = codec.Unmarshal(body, v)
+	}
+	if err != nil {
+		Fail(w, r, decodeError(codec, err))
+		return false
+	}
+	return Check(w, r, v)
+}
+
+// Check validates v like Decode does, for bodies built from somewhere else such as the query string. When it returns
+// false the error has already been written.
+func Check(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err, fields := Validate(v)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		util.Log(r.Context()).Errorf("Validating a %T failed: %v", v, err)
+		Fail(w, r, InternalError)
+		return false
+	}
+	if len(fields) > 0 {
+		Fail(w, r, ValidationError.WithFields(fields))
+		return false
+	}
+	return true
+}
+
+func decodeError(codec Codec, err error) APIError {
+	var tooLarge *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var cborTypeErr *cbor.UnmarshalTypeError
+	var cborUnknown *cbor.UnknownFieldError
+	switch {
+	case errors.As(err, &tooLarge):
+		return BodyTooLargeError.With(fmt.Sprintf("The request body is larger than %d bytes!", tooLarge.Limit))
+	case errors.Is(err, io.EOF):
+		return badBody(codec, "The request body is empty!")
+	case errors.As(err, &syntaxErr):
+		return BadJSONError.With(fmt.Sprintf("The request body isn't valid JSON: %s at offset %d", syntaxErr.Error(), syntaxErr.Offset))
+	case errors.As(err, &typeErr):
+		return ValidationError.WithFields([]FieldError{{Field: typeErr.Field, Message: "must be a " + jsonType(typeErr.Type.Kind().String())}})
+	case errors.As(err, &cborTypeErr) && cborTypeErr.StructFieldName != "":
+		// The field is reported as the go type followed by the name, e.g. routes.StatsRequest.guildCount.
+		field := cborTypeErr.StructFieldName[strings.LastIndex(cborTypeErr.StructFieldName, ".")+1:]
+		return ValidationError.WithFields([]FieldError{{Field: field, Message: "must be a " + jsonType(cborTypeErr.GoType)}})
+	case errors.As(err, &cborUnknown):
+		return ValidationError.With(fmt.Sprintf("The request body has an unknown field at map element %d!", cborUnknown.Index))
+	}
+	for _, prefix := range []string{"json: unknown field ", "msgpack: unknown field "} {
+		if strings.HasPrefix(err.Error(), prefix) {
+			field := strings.Trim(strings.TrimPrefix(err.Error(), prefix), `"`)
+			return ValidationError.WithFields([]FieldError{{Field: field, Message: "is not a known field"}})
+		}
+	}
+	return badBody(codec, fmt.Sprintf("The request body isn't valid %s: %s", codec.ContentType, err.Error()))
+}
+
+// badBody keeps reporting undecodable JSON as bad_json, the code clients knew before other formats were accepted.
+func badBody(codec Codec, message string) APIError {
+	if codec.ContentType == JSONCodec.ContentType {
+		return BadJSONError.With(message)
+	}
+	return BadBodyError.With(message)
+}
+
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice", kind == "array", strings.HasPrefix(kind, "[]"):
+		return "list"
+	case kind == "map", kind == "struct", strings.HasPrefix(kind, "map["):
+		return "object"
+	}
+	return kind
+}
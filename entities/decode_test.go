@@ -0,0 +1,91 @@
+package entities
+
+import (
+	"encoding/json"
+	"github.com/discordextremelist/api/config"
+	"github.com/discordextremelist/api/util"
+	"github.com/fxamacker/cbor/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type decoded struct {
+	Name  string `json:"name" validate:"required"`
+	Count int    `json:"count" validate:"min=0"`
+}
+
+func TestDecode(t *testing.T) {
+	util.Config = config.Defaults()
+	util.Config.MaxBodyBytes = 64
+	valid, _ := cbor.Marshal(map[string]interface{}{"name": "a", "count": 1})
+	unknown, _ := cbor.Marshal(map[string]interface{}{"name": "a", "extra": 1})
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		fields      []FieldError
+	}{
+		{"json", "application/json; charset=utf-8", `{"name":"a","count":1}`, 200, "", nil},
+		{"cbor", CBORCodec.ContentType, string(valid), 200, "", nil},
+		{"no content type", "", `{"name":"a"}`, 415, "bad_content_type", nil},
+		{"unsupported content type", "text/plain", `{"name":"a"}`, 415, "bad_content_type", nil},
+		{"too large", "application/json", `{"name":"` + strings.Repeat("a", 64) + `"}`, 413, "body_too_large", nil},
+		{"empty", "application/json", "", 400, "bad_json", nil},
+		{"syntax", "application/json", `{"name":`, 400, "bad_json", nil},
+		{"trailing data", "application/json", `{"name":"a"} {}`, 400, "bad_json", nil},
+		{"unknown json field", "application/json", `{"name":"a","extra":1}`, 422, "validation_failed",
+			[]FieldError{{Field: "extra", Message: "is not a known field"}}},
+		{"unknown cbor field", CBORCodec.ContentType, string(unknown), 422, "validation_failed", nil},
+		{"wrong type", "application/json", `{"name":"a","count":"1"}`, 422, "validation_failed",
+			[]FieldError{{Field: "count", Message: "must be a number"}}},
+		{"every failure", "application/json", `{"count":-1}`, 422, "validation_failed",
+			[]FieldError{{Field: "name", Message: "is required"}, {Field: "count", Message: "must be at least 0"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			if test.contentType != "" {
+				r.Header.Set(util.ContentType, test.contentType)
+			}
+			w := httptest.NewRecorder()
+			var body decoded
+			if ok := Decode(w, r, &body); ok != (test.status == 200) {
+				t.Fatalf("Decode() = %v, answered %d %s", ok, w.Code, w.Body)
+			}
+			if test.status == 200 {
+				if body != (decoded{Name: "a", Count: 1}) {
+					t.Fatalf("decoded %+v", body)
+				}
+				return
+			}
+			var response APIResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != test.status || response.Code != test.code {
+				t.Fatalf("answered %d %s, want %d %s", w.Code, response.Code, test.status, test.code)
+			}
+			if test.fields != nil && !reflect.DeepEqual(response.Fields, test.fields) {
+				t.Fatalf("fields are %v, want %v", response.Fields, test.fields)
+			}
+		})
+	}
+}
+
+func TestDecodeBadRule(t *testing.T) {
+	util.Config = config.Defaults()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name":"a"}`))
+	r.Header.Set(util.ContentType, "application/json")
+	w := httptest.NewRecorder()
+	var body struct {
+		Name string `json:"name" validate:"email"`
+	}
+	if Decode(w, r, &body) || w.Code != 500 {
+		t.Fatalf("answered %d %s, want an internal error", w.Code, w.Body)
+	}
+}
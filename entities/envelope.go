@@ -0,0 +1,156 @@
+package entities
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/discordextremelist/api/util"
+	"net/http"
+	"reflect"
+)
+
+type APIVersion int
+
+const (
+	V1 APIVersion = 1
+	V2 APIVersion = 2
+)
+
+type versionKey struct{}
+
+// Version answers every request routed through the router it's used on in the given API version's shape.
+func Version(version APIVersion) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, version)))
+		})
+	}
+}
+
+// VersionFrom returns the API version of the request, unversioned routes answer like /v1.
+func VersionFrom(ctx context.Context) APIVersion {
+	if version, ok := ctx.Value(versionKey{}).(APIVersion); ok {
+		return version
+	}
+	return V1
+}
+
+type Meta struct {
+	RequestID string `json:"request_id,omitempty"`
+	// Count is the amount of entities in data when it is a list.
+	Count *int `json:"count,omitempty"`
+}
+
+// Envelope is the body of every /v2 response, exactly one of Data and Error is set.
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Error *APIError   `json:"error"`
+	Meta  Meta        `json:"meta"`
+}
+
+// LegacyShape is implemented by data whose /v1 body isn't one of the shapes known to Legacy.
+type LegacyShape interface {
+	Legacy(status int) interface{}
+}
+
+// Legacy returns the /v1 body of a response with data, the shape /v1 clients already depend on.
+func Legacy(status int, data interface{}) interface{} {
+	switch v := data.(type) {
+	case LegacyShape:
+		return v.Legacy(status)
+	case *Bot:
+		return buildInternal(false, status, "", v, nil, nil, nil)
+	case *Server:
+		return buildInternal(false, status, "", nil, v, nil, nil)
+	case *User:
+		return buildInternal(false, status, "", nil, nil, v, nil)
+	case *ServerTemplate:
+		return buildInternal(false, status, "", nil, nil, nil, v)
+	case []Bot:
+		return APIResponseBots{Error: false, Status: status, Bots: v}
+	}
+	return data
+}
+
+func meta(r *http.Request, data interface{}) Meta {
+	m := Meta{RequestID: util.RequestIDFrom(r.Context())}
+	if value := reflect.ValueOf(data); value.Kind() == reflect.Slice {
+		count := value.Len()
+		m.Count = &count
+	}
+	return m
+}
+
+// shape returns the body of a response with data in the shape of the request's API version.
+func shape(r *http.Request, status int, data interface{}) interface{} {
+	if VersionFrom(r.Context()) == V1 {
+		return Legacy(status, data)
+	}
+	return Envelope{Data: data, Meta: meta(r, data)}
+}
+
+// Respond writes data in the shape of the request's API version and the format negotiated with Accept, reduced to
+// the fields asked for with ?fields= when it is an entity. Successful reads are sent with an ETag computed from data,
+// so a client revalidating an unchanged entity gets 304 Not Modified.
+func Respond(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	codec := Negotiate(r)
+	w.Header().Add("Vary", "Accept")
+	data, ok := project(w, r, data)
+	if !ok {
+		return
+	}
+	if status != http.StatusOK || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		write(w, r, codec, status, shape(r, status, data))
+		return
+	}
+	// The tag is computed from the canonical JSON of the body, without the meta as it differs between requests.
+	var key, body []byte
+	var err error
+	if VersionFrom(r.Context()) == V1 {
+		key, err = json.Marshal(Legacy(status, data))
+	} else {
+		key, err = json.Marshal(data)
+	}
+	if err == nil {
+		switch {
+		case codec.ContentType != JSONCodec.ContentType:
+			body, err = codec.Marshal(shape(r, status, data))
+		case VersionFrom(r.Context()) == V1:
+			body = append(key, '\n')
+		default:
+			body, err = JSONCodec.Marshal(Envelope{Data: json.RawMessage(key), Meta: meta(r, data)})
+		}
+	}
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		Fail(w, r, InternalError)
+		return
+	}
+	if Precondition(w, r, append(key[:len(key):len(key)], codec.ContentType...)) {
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// Fail writes err as problem details when asked for, otherwise in the shape of the request's API version and the
+// format negotiated with Accept.
+func Fail(w http.ResponseWriter, r *http.Request, err APIError) {
+	if WantsProblem(r) {
+		WriteProblem(w, r, err)
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	failWith(w, r, Negotiate(r), err)
+}
+
+func failWith(w http.ResponseWriter, r *http.Request, codec Codec, err APIError) {
+	if VersionFrom(r.Context()) == V1 {
+		response := buildInternal(true, err.Status, err.Message, nil, nil, nil, nil)
+		response.Code = err.Code
+		response.Fields = err.Fields
+		write(w, r, codec, err.Status, response)
+		return
+	}
+	write(w, r, codec, err.Status, Envelope{Error: &err, Meta: meta(r, nil)})
+}
@@ -0,0 +1,129 @@
+package entities
+
+import (
+	"encoding/json"
+	"github.com/discordextremelist/api/util"
+	"net/http"
+	"strings"
+)
+
+// APIError is an error response, Code is stable and meant for clients to branch on while Message may change.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields lists what is wrong with each field of the request body, for validation errors.
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+func (e APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// With returns a copy of e with a more specific message, the code stays the same.
+func (e APIError) With(message string) APIError {
+	e.Message = message
+	return e
+}
+
+func (e APIError) WithFields(fields []FieldError) APIError {
+	e.Fields = fields
+	return e
+}
+
+// Type is the problem type URI of the error, documented at /errors/<code>.
+func (e APIError) Type() string {
+	return "/errors/" + e.Code
+}
+
+func newError(status int, code, message string) APIError {
+	err := APIError{Status: status, Code: code, Message: message}
+	catalog = append(catalog, err)
+	return err
+}
+
+// catalog lists every error the API can respond with, in declaration order.
+var catalog []APIError
+
+var (
+	BadJSONError           = newError(400, "bad_json", "The request body isn't valid JSON!")
+	BadBodyError           = newError(400, "bad_body", "The request body couldn't be decoded!")
+	InvalidFieldsError     = newError(400, "invalid_fields", "The fields parameter names fields which don't exist!")
+	UnknownCollectionError = newError(400, "unknown_collection", "Unknown collection, expected one of bots, users, servers or templates!")
+	QueryTooComplexError   = newError(400, "query_too_complex", "The query resolves too many entities or is nested too deeply!")
+	UnknownFormatError     = newError(400, "unknown_format", "Unknown export format, expected discord, yaml or terraform!")
+	UnknownEventTypeError  = newError(400, "unknown_event_type", "Unknown event type, expected an entity or one of its events, e.g. bot or bot.approved!")
+	InvalidQueryError      = newError(400, "invalid_query", "A query parameter has an invalid value!")
+	UnknownWindowError     = newError(400, "unknown_window", "Unknown window, expected 24h, 7d or 30d!")
+	InvalidLimitError      = newError(400, "invalid_limit", "The limit parameter must be a number between 1 and the maximum batch size!")
+	NoAuthError            = newError(403, "bad_auth", `No "Authorization" header specified, or it was invalid!`)
+	TempBannedError        = newError(403, "temp_banned", "You've been temporarily API banned!")
+	PermBannedError        = newError(403, "perm_banned", "You've been permanently API banned!")
+	ForbiddenError         = newError(403, "forbidden", "You aren't allowed to access this resource!")
+	NotFoundError          = newError(404, "not_found", "Not Found")
+	SyncInProgressError    = newError(409, "sync_in_progress", "A cache sync is already in progress, try again later!")
+	WebhookLimitError      = newError(409, "webhook_limit_reached", "This bot has as many webhooks as it may have, delete one first!")
+	BodyTooLargeError      = newError(413, "body_too_large", "The request body is too large!")
+	BadContentType         = newError(415, "bad_content_type", "Unsupported Content Type, or non was provided!")
+	ValidationError        = newError(422, "validation_failed", "The request body failed validation!")
+	RatelimitedError       = newError(429, "ratelimited", "Too Many Requests")
+	InternalError          = newError(500, "internal_error", "Internal Server Error")
+	GetServersFailed       = newError(500, "get_servers_failed", "An error occurred when getting all servers, try again later!")
+	GetBotsFailed          = newError(500, "get_bots_failed", "An error occurred when getting all bots, try again later!")
+	GetUsersFailed         = newError(500, "get_users_failed", "An error occurred when getting all users, try again later!")
+	GetTemplatesFailed     = newError(500, "get_templates_failed", "An error occurred when getting all templates, try again later!")
+	NotImplementedError    = newError(501, "not_implemented", "Not implemented")
+)
+
+// Catalog returns every error the API can respond with.
+func Catalog() []APIError {
+	return append([]APIError(nil), catalog...)
+}
+
+func LookupAPIError(code string) (APIError, bool) {
+	for _, err := range catalog {
+		if err.Code == code {
+			return err, true
+		}
+	}
+	return APIError{}, false
+}
+
+// Problem is an RFC 7807 problem details body, sent instead of the versioned error body when the client accepts
+// application/problem+json.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+const ProblemContentType = "application/problem+json"
+
+func NewProblem(r *http.Request, err APIError) Problem {
+	return Problem{
+		Type:      err.Type(),
+		Title:     http.StatusText(err.Status),
+		Status:    err.Status,
+		Detail:    err.Message,
+		Instance:  r.URL.Path,
+		Code:      err.Code,
+		RequestID: util.RequestIDFrom(r.Context()),
+		Fields:    err.Fields,
+	}
+}
+
+// WantsProblem reports whether the client asked for problem details, which works on every API version.
+func WantsProblem(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), ProblemContentType)
+}
+
+func WriteProblem(w http.ResponseWriter, r *http.Request, err APIError) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(err.Status)
+	json.NewEncoder(w).Encode(NewProblem(r, err))
+}
@@ -0,0 +1,178 @@
+package entities
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Fields is a parsed ?fields= parameter, each json name maps to the fields selected below it, nil selecting all.
+type Fields map[string]Fields
+
+// entityNames are what entities are called in /v1 bodies, lists of them add an s.
+var entityNames = map[reflect.Type]string{
+	reflect.TypeOf(Bot{}):            "bot",
+	reflect.TypeOf(User{}):           "user",
+	reflect.TypeOf(Server{}):         "server",
+	reflect.TypeOf(ServerTemplate{}): "template",
+}
+
+func (f Fields) add(path []string) {
+	sub, ok := f[path[0]]
+	if len(path) == 1 {
+		f[path[0]] = nil
+		return
+	}
+	if ok && sub == nil {
+		return
+	}
+	if !ok {
+		sub = Fields{}
+		f[path[0]] = sub
+	}
+	sub.add(path[1:])
+}
+
+func element(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	return t
+}
+
+func pathExists(t reflect.Type, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	t = element(t)
+	if t.Kind() == reflect.Map {
+		return true
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.IsExported() && field.Tag.Get("json") != "-" && jsonName(field) == path[0] {
+			return pathExists(field.Type, path[1:])
+		}
+	}
+	return false
+}
+
+// ParseFields parses a comma separated list of dotted json paths, e.g. id,name,status.approved, and reports every
+// path which doesn't exist on t.
+func ParseFields(raw string, t reflect.Type) (Fields, []FieldError) {
+	fields := Fields{}
+	var errs []FieldError
+	for _, path := range strings.Split(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		parts := strings.Split(path, ".")
+		if !pathExists(t, parts) {
+			errs = append(errs, FieldError{Field: path, Message: "doesn't exist on " + entityNames[element(t)]})
+			continue
+		}
+		fields.add(parts)
+	}
+	return fields, errs
+}
+
+// Project returns the selected fields of value, a struct or a list of them, keyed by their json names. Fields which
+// would be omitted from the json are left out, so hidden fields stay hidden.
+func (f Fields) Project(value reflect.Value) interface{} {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+		projected := make([]interface{}, value.Len())
+		for i := range projected {
+			projected[i] = f.Project(value.Index(i))
+		}
+		return projected
+	case reflect.Struct:
+		projected := map[string]interface{}{}
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			sub, ok := f[jsonName(field)]
+			if !ok || !field.IsExported() || field.Tag.Get("json") == "-" {
+				continue
+			}
+			if strings.Contains(field.Tag.Get("json"), ",omitempty") && value.Field(i).IsZero() {
+				continue
+			}
+			if sub == nil {
+				projected[jsonName(field)] = value.Field(i).Interface()
+			} else {
+				projected[jsonName(field)] = sub.Project(value.Field(i))
+			}
+		}
+		return projected
+	}
+	return value.Interface()
+}
+
+// listType returns the entity type of a list called name in /v1 bodies.
+func listType(name string) reflect.Type {
+	for t, entity := range entityNames {
+		if entity+"s" == name {
+			return t
+		}
+	}
+	panic("entities: no entity is listed as " + name)
+}
+
+func (f Fields) projectEach(each func(yield Yield) error) func(yield Yield) error {
+	return func(yield Yield) error {
+		return each(func(item interface{}) error {
+			return yield(f.Project(reflect.ValueOf(item)))
+		})
+	}
+}
+
+// projection is an entity or list reduced to the fields asked for, legacy is its name in /v1 bodies.
+type projection struct {
+	legacy string
+	value  interface{}
+}
+
+func (p projection) Legacy(status int) interface{} {
+	return map[string]interface{}{"error": false, "status": status, p.legacy: p.value}
+}
+
+// project applies the request's ?fields= to data when it is an entity or a list of them, data is returned as it
+// is otherwise. ok is false when an error about the parameter was written.
+func project(w http.ResponseWriter, r *http.Request, data interface{}) (interface{}, bool) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" || data == nil {
+		return data, true
+	}
+	t := reflect.TypeOf(data)
+	name, isEntity := entityNames[element(t)]
+	if !isEntity {
+		return data, true
+	}
+	if t.Kind() == reflect.Slice {
+		name += "s"
+	}
+	fields, errs := ParseFields(raw, t)
+	if len(errs) > 0 {
+		Fail(w, r, InvalidFieldsError.WithFields(errs))
+		return nil, false
+	}
+	projected := fields.Project(reflect.ValueOf(data))
+	if VersionFrom(r.Context()) == V1 {
+		return projection{legacy: name, value: projected}, true
+	}
+	return projected, true
+}
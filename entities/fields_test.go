@@ -0,0 +1,150 @@
+package entities
+
+import (
+	"encoding/json"
+	"github.com/discordextremelist/api/config"
+	"github.com/discordextremelist/api/util"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		raw  string
+		t    reflect.Type
+		want Fields
+		errs []FieldError
+	}{
+		{"id,name", reflect.TypeOf(Bot{}), Fields{"id": nil, "name": nil}, nil},
+		{" id , ,owner.id", reflect.TypeOf(&Bot{}), Fields{"id": nil, "owner": {"id": nil}}, nil},
+		{"status.approved,status.siteBot", reflect.TypeOf([]Bot{}), Fields{"status": {"approved": nil, "siteBot": nil}}, nil},
+		// A parent selects everything below it, whichever comes first.
+		{"status.approved,status", reflect.TypeOf(Bot{}), Fields{"status": nil}, nil},
+		{"status,status.approved", reflect.TypeOf(Bot{}), Fields{"status": nil}, nil},
+		{"votes.positive", reflect.TypeOf(Bot{}), Fields{"votes": {"positive": nil}}, nil},
+		{"id,nope,status.nope,name.length", reflect.TypeOf([]Bot{}), Fields{"id": nil}, []FieldError{
+			{Field: "nope", Message: "doesn't exist on bot"},
+			{Field: "status.nope", Message: "doesn't exist on bot"},
+			{Field: "name.length", Message: "doesn't exist on bot"},
+		}},
+		{"ModNotes", reflect.TypeOf(Bot{}), Fields{}, []FieldError{{Field: "ModNotes", Message: "doesn't exist on bot"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			fields, errs := ParseFields(test.raw, test.t)
+			if !reflect.DeepEqual(fields, test.want) || !reflect.DeepEqual(errs, test.errs) {
+				t.Fatalf("ParseFields() = %v, %v, want %v, %v", fields, errs, test.want, test.errs)
+			}
+		})
+	}
+}
+
+func TestProjectNested(t *testing.T) {
+	bot := &Bot{ID: "1", Name: "bot", Owner: Owner{ID: "2"}, Status: BotStatus{Approved: true}}
+	fields, _ := ParseFields("id,owner.id,status.approved", reflect.TypeOf(bot))
+	got := fields.Project(reflect.ValueOf([]*Bot{bot}))
+	want := []interface{}{map[string]interface{}{
+		"id":     "1",
+		"owner":  map[string]interface{}{"id": "2"},
+		"status": map[string]interface{}{"approved": true},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Project() = %v, want %v", got, want)
+	}
+}
+
+// subset fails unless every key of projected is also in the json encoding, recursively.
+func subset(t *testing.T, path string, projected interface{}, encoded interface{}) {
+	switch projected := projected.(type) {
+	case map[string]interface{}:
+		object, ok := encoded.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s is an object only when projected", path)
+		}
+		for key, value := range projected {
+			if _, ok := object[key]; !ok {
+				t.Fatalf("%s.%s is projected but isn't in the json", path, key)
+			}
+			subset(t, path+"."+key, value, object[key])
+		}
+	case []interface{}:
+		list, _ := encoded.([]interface{})
+		for i, value := range projected {
+			subset(t, path, value, list[i])
+		}
+	}
+}
+
+// every selects every json path of t.
+func every(t reflect.Type, prefix string, paths *[]string) {
+	t = element(t)
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		*paths = append(*paths, prefix+jsonName(field))
+		every(field.Type, prefix+jsonName(field)+".", paths)
+	}
+}
+
+func TestProjectHidesRedacted(t *testing.T) {
+	premium := true
+	bot := CleanupBot(UserRank{}, &Bot{
+		ID:        "1",
+		Token:     "DELAPI_secret",
+		ModNotes:  "notes",
+		Votes:     &BotVotes{Positive: []string{"2"}},
+		Theme:     &BotTheme{},
+		WidgetBot: &WidgetBot{},
+		Status:    BotStatus{Premium: premium},
+	})
+	user := CleanupUser(UserRank{}, &User{
+		ID:            "2",
+		Token:         "secret",
+		Locale:        "en",
+		Preferences:   &UserPreferences{},
+		StaffTracking: &StaffTracking{},
+	})
+	for _, entity := range []interface{}{bot, user} {
+		var paths []string
+		every(reflect.TypeOf(entity), "", &paths)
+		fields, errs := ParseFields(strings.Join(paths, ","), reflect.TypeOf(entity))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var encoded interface{}
+		raw, _ := json.Marshal(entity)
+		_ = json.Unmarshal(raw, &encoded)
+		projected, _ := json.Marshal(fields.Project(reflect.ValueOf(entity)))
+		var decoded interface{}
+		_ = json.Unmarshal(projected, &decoded)
+		subset(t, reflect.TypeOf(entity).Elem().Name(), decoded, encoded)
+		for _, secret := range []string{"secret", "notes", "premium", "preferences", "staffTracking", "locale"} {
+			if strings.Contains(string(projected), secret) {
+				t.Fatalf("projection of %T reveals %s: %s", entity, secret, projected)
+			}
+		}
+	}
+}
+
+func TestInvalidFields(t *testing.T) {
+	util.Config = config.Defaults()
+	r := httptest.NewRequest(http.MethodGet, "/bot/1?fields=id,token.x,nope", nil)
+	w := httptest.NewRecorder()
+	if _, ok := project(w, r, &Bot{ID: "1"}); ok {
+		t.Fatal("project() accepted unknown fields")
+	}
+	var response APIResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	want := []FieldError{{Field: "token.x", Message: "doesn't exist on bot"}, {Field: "nope", Message: "doesn't exist on bot"}}
+	if w.Code != 400 || response.Code != "invalid_fields" || !reflect.DeepEqual(response.Fields, want) {
+		t.Fatalf("answered %d %s %v, want 400 invalid_fields %v", w.Code, response.Code, response.Fields, want)
+	}
+}
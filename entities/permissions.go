@@ -0,0 +1,133 @@
+package entities
+
+import (
+	"strconv"
+)
+
+// PermissionNames names discord's permission bits, by bit.
+var PermissionNames = map[int]string{
+	0:  "CREATE_INSTANT_INVITE",
+	1:  "KICK_MEMBERS",
+	2:  "BAN_MEMBERS",
+	3:  "ADMINISTRATOR",
+	4:  "MANAGE_CHANNELS",
+	5:  "MANAGE_GUILD",
+	6:  "ADD_REACTIONS",
+	7:  "VIEW_AUDIT_LOG",
+	8:  "PRIORITY_SPEAKER",
+	9:  "STREAM",
+	10: "VIEW_CHANNEL",
+	11: "SEND_MESSAGES",
+	12: "SEND_TTS_MESSAGES",
+	13: "MANAGE_MESSAGES",
+	14: "EMBED_LINKS",
+	15: "ATTACH_FILES",
+	16: "READ_MESSAGE_HISTORY",
+	17: "MENTION_EVERYONE",
+	18: "USE_EXTERNAL_EMOJIS",
+	19: "VIEW_GUILD_INSIGHTS",
+	20: "CONNECT",
+	21: "SPEAK",
+	22: "MUTE_MEMBERS",
+	23: "DEAFEN_MEMBERS",
+	24: "MOVE_MEMBERS",
+	25: "USE_VAD",
+	26: "CHANGE_NICKNAME",
+	27: "MANAGE_NICKNAMES",
+	28: "MANAGE_ROLES",
+	29: "MANAGE_WEBHOOKS",
+	30: "MANAGE_GUILD_EXPRESSIONS",
+	31: "USE_APPLICATION_COMMANDS",
+	32: "REQUEST_TO_SPEAK",
+	33: "MANAGE_EVENTS",
+	34: "MANAGE_THREADS",
+	35: "CREATE_PUBLIC_THREADS",
+	36: "CREATE_PRIVATE_THREADS",
+	37: "USE_EXTERNAL_STICKERS",
+	38: "SEND_MESSAGES_IN_THREADS",
+	39: "USE_EMBEDDED_ACTIVITIES",
+	40: "MODERATE_MEMBERS",
+	41: "VIEW_CREATOR_MONETIZATION_ANALYTICS",
+	42: "USE_SOUNDBOARD",
+	43: "CREATE_GUILD_EXPRESSIONS",
+	44: "CREATE_EVENTS",
+	45: "USE_EXTERNAL_SOUNDS",
+	46: "SEND_VOICE_MESSAGES",
+	49: "SEND_POLLS",
+	50: "USE_EXTERNAL_APPS",
+}
+
+const (
+	administrator = 1 << 3
+	viewChannel   = 1 << 10
+	sendMessages  = 1 << 11
+	// needsSend are the permissions discord ignores without SEND_MESSAGES.
+	needsSend = 1<<12 | 1<<14 | 1<<15 | 1<<17
+)
+
+// allPermissions has every named bit set, it is what administrators get.
+var allPermissions = func() int {
+	all := 0
+	for bit := range PermissionNames {
+		all |= 1 << bit
+	}
+	return all
+}()
+
+// Permissions are permission bits sent with their names.
+type Permissions struct {
+	Bits  string   `json:"bits"`
+	Names []string `json:"names"`
+}
+
+// NewPermissions decodes bits into names in bit order, unknown bits are named by their number.
+func NewPermissions(bits int) Permissions {
+	permissions := Permissions{Bits: strconv.Itoa(bits), Names: []string{}}
+	for bit := 0; bit < 63; bit++ {
+		if bits&(1<<bit) == 0 {
+			continue
+		}
+		name, ok := PermissionNames[bit]
+		if !ok {
+			name = "UNKNOWN_" + strconv.Itoa(bit)
+		}
+		permissions.Names = append(permissions.Names, name)
+	}
+	return permissions
+}
+
+// overwriteFor returns the role overwrite of a channel for the role with the placeholder id.
+func overwriteFor(channel GuildChannel, id string) (PermissionsOverwrite, bool) {
+	for _, overwrite := range channel.PermissionsOverwrites {
+		if overwriteType(overwrite.Type) == 0 && overwrite.ID == id {
+			return overwrite, true
+		}
+	}
+	return PermissionsOverwrite{}, false
+}
+
+// EffectivePermissions are the permissions a member with only @everyone and the role at index role has in channel,
+// worked out like discord does: the roles' permissions, then @everyone's overwrite and then the role's, denies before
+// allows. Administrators get every permission, and without VIEW_CHANNEL or SEND_MESSAGES the permissions depending on
+// them are dropped.
+func EffectivePermissions(template *ServerTemplate, role int, channel GuildChannel) int {
+	if len(template.Roles) == 0 {
+		return 0
+	}
+	permissions := template.Roles[0].Permissions | template.Roles[role].Permissions
+	if permissions&administrator != 0 {
+		return allPermissions
+	}
+	for _, id := range []int{0, role} {
+		if overwrite, ok := overwriteFor(channel, strconv.Itoa(id)); ok {
+			permissions = permissions&^overwrite.Deny | overwrite.Allow
+		}
+	}
+	if permissions&viewChannel == 0 {
+		return 0
+	}
+	if permissions&sendMessages == 0 {
+		permissions &^= needsSend
+	}
+	return permissions
+}
@@ -0,0 +1,100 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEffectivePermissions(t *testing.T) {
+	const (
+		view  = viewChannel
+		send  = sendMessages
+		embed = 1 << 14
+		kick  = 1 << 1
+	)
+	roles := func(everyone, role int) []Role {
+		return []Role{{Name: "@everyone", Permissions: everyone}, {Name: "member", Permissions: role}}
+	}
+	overwrites := func(list ...PermissionsOverwrite) GuildChannel {
+		return GuildChannel{Type: TextChannel, Name: "general", PermissionsOverwrites: list}
+	}
+	tests := []struct {
+		name    string
+		roles   []Role
+		role    int
+		channel GuildChannel
+		want    int
+	}{
+		{"no roles", nil, 0, overwrites(), 0},
+		{"roles add up", roles(view, send), 1, overwrites(), view | send},
+		{"administrator gets everything", roles(view, administrator), 1,
+			overwrites(PermissionsOverwrite{ID: "1", Type: "role", Deny: view}), allPermissions},
+		{"everyone's overwrite comes before the role's", roles(view, 0), 1, overwrites(
+			PermissionsOverwrite{ID: "1", Type: "role", Allow: send},
+			PermissionsOverwrite{ID: "0", Type: "role", Deny: send},
+		), view | send},
+		{"deny comes before allow", roles(view|send, 0), 1,
+			overwrites(PermissionsOverwrite{ID: "1", Type: "role", Allow: send, Deny: send}), view | send},
+		{"member overwrites are ignored", roles(view|send, 0), 1,
+			overwrites(PermissionsOverwrite{ID: "1", Type: "member", Deny: send}), view | send},
+		{"denied view drops everything", roles(view|send|kick, 0), 1,
+			overwrites(PermissionsOverwrite{ID: "0", Type: "role", Deny: view}), 0},
+		{"denied send drops what needs it", roles(view|send|embed|kick, 0), 0,
+			overwrites(PermissionsOverwrite{ID: "0", Type: "role", Deny: send}), view | kick},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &ServerTemplate{Roles: test.roles}
+			if got := EffectivePermissions(template, test.role, test.channel); got != test.want {
+				t.Fatalf("got %v, want %v", NewPermissions(got).Names, NewPermissions(test.want).Names)
+			}
+		})
+	}
+}
+
+func TestTemplateStructureOrder(t *testing.T) {
+	parent := func(id Snowflake) *Snowflake { return &id }
+	template := &ServerTemplate{
+		Roles: []Role{
+			{Name: "@everyone", Position: 5},
+			{Name: "low", Position: 1},
+			{Name: "high", Position: 3},
+		},
+		Channels: []GuildChannel{
+			{ID: "10", Type: CategoryChannel, Name: "second", Position: 2},
+			{ID: "11", Type: CategoryChannel, Name: "first", Position: 1},
+			{ID: "12", Type: VoiceChannel, Name: "voice", Position: 0, ParentID: parent("11")},
+			{ID: "13", Type: TextChannel, Name: "text", Position: 5, ParentID: parent("11")},
+			{ID: "14", Type: StageChannel, Name: "stage", Position: 1, ParentID: parent("11")},
+			{ID: "15", Type: TextChannel, Name: "orphan", Position: 9, ParentID: parent("99")},
+			{ID: "16", Type: VoiceChannel, Name: "lobby", Position: 0},
+			{ID: "17", Type: TextChannel, Name: "rules", Position: 3},
+			{ID: "3", Type: TextChannel, Name: "tie", Position: 3},
+		},
+	}
+	structure := NewTemplateStructure(template)
+	var roles []string
+	for _, role := range structure.Roles {
+		roles = append(roles, role.Name)
+	}
+	if want := []string{"high", "low", "@everyone"}; !reflect.DeepEqual(roles, want) {
+		t.Fatalf("roles are %v, want %v", roles, want)
+	}
+	names := func(channels []StructureChannel) []string {
+		var list []string
+		for _, channel := range channels {
+			list = append(list, channel.Name)
+		}
+		return list
+	}
+	// Loose channels, including those of a missing category, come first, voice after text.
+	if got, want := names(structure.Channels), []string{"tie", "rules", "orphan", "lobby", "first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("channels are %v, want %v", got, want)
+	}
+	if got, want := names(structure.Channels[4].Channels), []string{"text", "voice", "stage"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("channels of first are %v, want %v", got, want)
+	}
+	if len(structure.Channels[5].Channels) != 0 {
+		t.Fatalf("second has channels %v", names(structure.Channels[5].Channels))
+	}
+}
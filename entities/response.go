@@ -1,13 +1,21 @@
 package entities
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"github.com/discordextremelist/api/metrics"
 	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -52,10 +60,49 @@ type APIStatsResponse struct {
 	Templates int                     `json:"templates"`
 }
 
+// Health and Stats are the data of the health and stats routes, their /v1 shapes are the API*Response types above.
+type Health struct {
+	RedisOK   bool  `json:"redis_ok"`
+	MongoOK   bool  `json:"mongo_ok"`
+	RedisPing int64 `json:"redis_ping"`
+	MongoPing int64 `json:"mongo_ping"`
+}
+
+func (h Health) Legacy(status int) interface{} {
+	return APIHealthResponse{
+		Error:     status != 200,
+		Status:    status,
+		RedisOK:   h.RedisOK,
+		MongoOK:   h.MongoOK,
+		RedisPing: h.RedisPing,
+		MongoPing: h.MongoPing,
+	}
+}
+
+type Stats struct {
+	Servers   APIStatsResponseServers `json:"servers"`
+	Bots      APIStatsResponseBots    `json:"bots"`
+	Users     APIStatsResponseUsers   `json:"users"`
+	Templates int                     `json:"templates"`
+}
+
+func (s Stats) Legacy(status int) interface{} {
+	return APIStatsResponse{
+		Status:    status,
+		Error:     status != 200,
+		Servers:   s.Servers,
+		Bots:      s.Bots,
+		Users:     s.Users,
+		Templates: s.Templates,
+	}
+}
+
 type APIResponse struct {
 	Error    bool            `json:"error"`
 	Status   int             `json:"status"`
 	Message  *string         `json:"message,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Fields   []FieldError    `json:"fields,omitempty"`
 	Bot      *Bot            `json:"bot,omitempty"`
 	Server   *Server         `json:"server,omitempty"`
 	User     *User           `json:"user,omitempty"`
@@ -85,36 +132,83 @@ func buildInternal(error bool, status int, message string, bot *Bot, server *Ser
 }
 
 var (
-	RatelimitedError   = buildInternal(true, 429, "Too Many Requests", nil, nil, nil, nil)
-	TempBannedError    = buildInternal(true, 403, "You've been temporarily API banned!", nil, nil, nil, nil)
-	PermBannedError    = buildInternal(true, 403, "You've been permanently API banned!", nil, nil, nil, nil)
-	NotFoundError      = buildInternal(true, 404, "Not Found", nil, nil, nil, nil)
-	NoAuthError        = buildInternal(true, 403, `No "Authorization" header specified, or it was invalid!`, nil, nil, nil, nil)
-	LookupError        = errors.New("an error occurred when looking up this resource")
-	ReadFailed         = errors.New("failed to read request body")
-	notImplemented     = buildInternal(true, 501, "Not implemented", nil, nil, nil, nil)
-	GetServersFailed   = buildInternal(true, 500, "An error occurred when getting all servers, try again later!", nil, nil, nil, nil)
-	GetBotsFailed      = buildInternal(true, 500, "An error occurred when getting all bots, try again later!", nil, nil, nil, nil)
-	GetUsersFailed     = buildInternal(true, 500, "An error occurred when getting all users, try again later!", nil, nil, nil, nil)
-	GetTemplatesFailed = buildInternal(true, 500, "An error occurred when getting all templates, try again later!", nil, nil, nil, nil)
-	BadContentType     = buildInternal(true, 415, "Unsupported Content Type, or non was provided!", nil, nil, nil, nil)
+	LookupError = errors.New("an error occurred when looking up this resource")
+	ReadFailed  = errors.New("failed to read request body")
 )
 
+var accessLog = newAccessLogger()
+
+func newAccessLogger() *log.Logger {
+	logger := log.New()
+	logger.SetOutput(os.Stdout)
+	logger.SetFormatter(&log.JSONFormatter{})
+	return logger
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return "not_found"
+}
+
+// sampled decides whether to log a request, routes are sampled alike on every API version.
+func sampled(r *http.Request, status int) bool {
+	if status >= 500 {
+		return true
+	}
+	rate, ok := util.Config.Logging.AccessSample[apiRoute(r)]
+	return !ok || rand.Float64() < rate
+}
+
+// redactedQuery is the query of u with the admin ?token= of the debug routes masked.
+func redactedQuery(u *url.URL) string {
+	query := u.Query()
+	if !query.Has("token") {
+		return u.RawQuery
+	}
+	query.Set("token", "REDACTED")
+	return query.Encode()
+}
+
 func doLog(start time.Time, w middleware.WrapResponseWriter, r *http.Request) {
-	ResponseTimes = append(ResponseTimes, ResponseTime{
-		Path:                 r.URL.String(),
-		TimeSpentWritingBody: time.Since(start).Microseconds(),
+	took := time.Since(start)
+	route := routePattern(r)
+	ResponseTimes.add(ResponseTime{
+		Path:                 (&url.URL{Path: r.URL.Path, RawQuery: redactedQuery(r.URL)}).String(),
+		TimeSpentWritingBody: took.Microseconds(),
 	})
-	log.Info(fmt.Sprintf(
-		`%s - "%s %s %s" %d %d %s`,
-		r.RemoteAddr,
-		r.Method,
-		r.URL,
-		r.Proto,
-		w.BytesWritten(),
-		w.Status(),
-		time.Since(start),
-	))
+	metrics.RequestDuration.WithLabelValues(route, r.Method, strconv.Itoa(w.Status())).Observe(took.Seconds())
+	if !sampled(r, w.Status()) {
+		return
+	}
+	fields := log.Fields{
+		"remote_addr": r.RemoteAddr,
+		"method":      r.Method,
+		"path":        r.URL.Path,
+		"query":       redactedQuery(r.URL),
+		"route":       route,
+		"proto":       r.Proto,
+		"status":      w.Status(),
+		"bytes":       w.BytesWritten(),
+		"duration_ms": float64(took.Microseconds()) / 1000,
+		"user_agent":  r.UserAgent(),
+	}
+	if id := util.RequestIDFrom(r.Context()); id != "" {
+		fields["request_id"] = id
+	}
+	if span := trace.SpanContextFromContext(r.Context()); span.HasTraceID() {
+		fields["trace_id"] = span.TraceID().String()
+	}
+	if strings.Contains(route, "/bot/{id}") {
+		fields["bot_id"] = chi.URLParam(r, "id")
+	}
+	if bucket := w.Header().Get("X-RateLimit-Bucket"); bucket != "" {
+		fields["ratelimit_bucket"] = bucket
+	}
+	accessLog.WithFields(fields).Info("request")
 }
 
 func RequestLogger(handler http.Handler) http.Handler {
@@ -140,51 +234,55 @@ func WritePrettyJson[T any](status int, writer http.ResponseWriter, v T) {
 	encoder.Encode(v)
 }
 
-func WriteErrorResponse(w http.ResponseWriter) {
-	WriteJson(500, w, buildInternal(true, 500, "Internal Server Error", nil, nil, nil, nil))
+func WriteErrorResponse(w http.ResponseWriter, r *http.Request) {
+	Fail(w, r, InternalError)
 }
 
-func WriteBotResponse(w http.ResponseWriter, bot *Bot) {
-	WriteJson(200, w, buildInternal(false, 200, "", bot, nil, nil, nil))
+func WriteBotResponse(w http.ResponseWriter, r *http.Request, bot *Bot) {
+	Respond(w, r, 200, bot)
 }
 
-func WriteUserResponse(w http.ResponseWriter, user *User) {
-	WriteJson(200, w, buildInternal(false, 200, "", nil, nil, user, nil))
+func WriteUserResponse(w http.ResponseWriter, r *http.Request, user *User) {
+	Respond(w, r, 200, user)
 }
 
-func WriteServerResponse(w http.ResponseWriter, server *Server) {
-	WriteJson(200, w, buildInternal(false, 200, "", nil, server, nil, nil))
+func WriteServerResponse(w http.ResponseWriter, r *http.Request, server *Server) {
+	Respond(w, r, 200, server)
 }
 
-func WriteTemplateResponse(w http.ResponseWriter, template *ServerTemplate) {
-	WriteJson(200, w, buildInternal(false, 200, "", nil, nil, nil, template))
+func WriteTemplateResponse(w http.ResponseWriter, r *http.Request, template *ServerTemplate) {
+	Respond(w, r, 200, template)
 }
 
-func WriteNotImplementedResponse(w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(501)
-	json.NewEncoder(w).Encode(notImplemented)
+func WriteNotImplementedResponse(w http.ResponseWriter, r *http.Request) {
+	Fail(w, r, NotImplementedError)
+}
+
+// TokenBot returns the bot a token belongs to, tokens look like DELAPI_xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx-000000000000000000
+// with the bot's id at the end.
+func TokenBot(ctx context.Context, auth string) (error, *Bot) {
+	matches := util.TokenPattern.FindStringSubmatch(auth)
+	if len(matches) < 2 {
+		return NoAuthError, nil
+	}
+	// Tokens are checked against redis, a copy in the LRU may still hold one the website just regenerated.
+	err, bot := FreshBot(ctx, matches[1])
+	if err != nil {
+		return err, nil
+	}
+	if bot.Token != auth {
+		return NoAuthError, nil
+	}
+	return nil, bot
 }
 
-// DELAPI_xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx-000000000000000000
 func TokenValidator(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "POST" {
-			auth := r.Header.Get(util.Authorization)
-			matches := util.TokenPattern.FindStringSubmatch(auth)
-			if len(matches) < 2 {
-				BadAuth(w, r)
-				return
-			}
-			err, bot := LookupBot(matches[1], false)
-			if err != nil {
+			if err, _ := TokenBot(r.Context(), r.Header.Get(util.Authorization)); err != nil {
 				BadAuth(w, r)
 			} else {
-				if bot.Token != auth {
-					BadAuth(w, r)
-				} else {
-					next.ServeHTTP(w, r)
-				}
+				next.ServeHTTP(w, r)
 			}
 		} else {
 			next.ServeHTTP(w, r)
@@ -192,12 +290,10 @@ func TokenValidator(next http.Handler) http.Handler {
 	})
 }
 
-func NotFound(w http.ResponseWriter, _ *http.Request) {
-	WriteJson(http.StatusNotFound, w, NotFoundError)
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Fail(w, r, NotFoundError)
 }
 
-func BadAuth(w http.ResponseWriter, _ *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(403)
-	json.NewEncoder(w).Encode(NoAuthError)
+func BadAuth(w http.ResponseWriter, r *http.Request) {
+	Fail(w, r, NoAuthError)
 }
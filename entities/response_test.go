@@ -0,0 +1,50 @@
+package entities
+
+import (
+	"context"
+	"github.com/discordextremelist/api/config"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRedactedQuery(t *testing.T) {
+	for raw, want := range map[string]string{
+		"/debug?token=secret":                 "token=REDACTED",
+		"/debug/cache/sync?dryRun=1&token=ab": "dryRun=1&token=REDACTED",
+		"/bots?fields=id,name":                "fields=id,name",
+		"/bots":                               "",
+	} {
+		u, _ := url.Parse(raw)
+		if got := redactedQuery(u); got != want {
+			t.Errorf("redactedQuery(%s) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestSampledOnEveryVersion(t *testing.T) {
+	util.Config = config.Defaults()
+	util.Config.Logging.AccessSample = map[string]float64{"/health": 0}
+	for pattern, want := range map[string]bool{
+		"/health":        false,
+		"/v1/health":     false,
+		"/v2/health":     false,
+		"/v2/bot/{id}/":  true,
+		"/healthcheck":   true,
+		"/v2/bots/batch": true,
+	} {
+		rctx := chi.NewRouteContext()
+		rctx.RoutePatterns = []string{pattern}
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		if got := sampled(r, http.StatusOK); got != want {
+			t.Errorf("sampled(%s) = %t, want %t", pattern, got, want)
+		}
+		if !sampled(r, http.StatusInternalServerError) {
+			t.Errorf("a server error on %s wasn't logged", pattern)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package entities
+
+import (
+	"github.com/discordextremelist/api/util"
+	"github.com/getsentry/sentry-go"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"net/http"
+	"strings"
+)
+
+// scrubbedHeaders never leave the API, they carry bot tokens and admin sessions.
+var scrubbedHeaders = []string{util.Authorization, "Cookie"}
+
+func scrubRequest(request *sentry.Request) {
+	if request == nil {
+		return
+	}
+	for _, header := range scrubbedHeaders {
+		delete(request.Headers, header)
+	}
+	request.Cookies = ""
+	// the debug routes are authenticated with ?token=
+	request.QueryString = ""
+}
+
+// Sentry gives every request its own hub tagged with the request id, method, route and bot id, and recovers
+// panics into a 500 so a broken handler doesn't take the connection down with it.
+func Sentry(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub := sentry.GetHubFromContext(r.Context())
+		if hub == nil {
+			hub = sentry.CurrentHub().Clone()
+		}
+		ctx := sentry.SetHubOnContext(r.Context(), hub)
+		r = r.WithContext(ctx)
+		scope := hub.Scope()
+		scope.SetRequest(r)
+		scope.SetTag("method", r.Method)
+		if id := util.RequestIDFrom(ctx); id != "" {
+			scope.SetTag("request_id", id)
+		}
+		for tag, value := range map[string]string{"node": util.Node, "pod": util.Pod, "zone": util.Zone} {
+			if value != "" {
+				scope.SetTag(tag, value)
+			}
+		}
+		// the route is only known once chi has matched it, so resolve it when an event is actually sent
+		scope.AddEventProcessor(func(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+			route := routePattern(r)
+			if event.Tags == nil {
+				event.Tags = map[string]string{}
+			}
+			event.Tags["route"] = route
+			if strings.Contains(route, "/bot/{id}") {
+				event.Tags["bot_id"] = chi.URLParam(r, "id")
+			}
+			scrubRequest(event.Request)
+			return event
+		})
+		Recoverer(next).ServeHTTP(w, r)
+	})
+}
+
+// Recoverer turns a panic into a 500 in the shape of the request's API version. Sentry already recovers every
+// request, versioned routers use Recoverer again so the 500 is written with their version.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww, ok := w.(middleware.WrapResponseWriter)
+		if !ok {
+			ww = middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// net/http uses this to abort a response on purpose, don't report it
+				panic(err)
+			}
+			ctx := r.Context()
+			hub := sentry.GetHubFromContext(ctx)
+			if hub == nil {
+				hub = sentry.CurrentHub()
+			}
+			hub.RecoverWithContext(ctx, err)
+			util.Log(ctx).Errorf("Recovered from panic in %s %s: %v", r.Method, r.URL.Path, err)
+			if ww.Status() == 0 {
+				WriteErrorResponse(ww, r)
+			} else {
+				// the status line is already out, all we can do is cut the response short
+				panic(http.ErrAbortHandler)
+			}
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
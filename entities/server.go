@@ -3,14 +3,16 @@ package entities
 import (
 	"context"
 	"encoding/json"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/tracing"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
-	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"time"
 )
 
+var serverCache = cache.New[Server]("servers", 4096, 1*time.Minute)
+
 type ServerLinks struct {
 	Invite   string `json:"invite,omitempty"`
 	Website  string `json:"website"`
@@ -47,10 +49,12 @@ func CleanupServer(rank UserRank, server *Server) *Server {
 	return &copied
 }
 
-func mongoLookupServer(id string) (error, *Server) {
+func mongoLookupServer(ctx context.Context, id string) (error, *Server) {
+	ctx, span := tracing.StartMongo(ctx, "FindOne", "servers")
+	defer span.End()
 	findStart := time.Now()
 	var findEnd int64
-	res := util.Database.Mongo.Collection("servers").FindOne(context.TODO(), bson.M{"_id": id})
+	res := util.Database.Mongo.Collection("servers").FindOne(ctx, bson.M{"_id": id})
 	if res.Err() != nil {
 		AddMongoLookupTime("servers", id, time.Since(findStart).Microseconds(), -1)
 		return res.Err(), nil
@@ -60,7 +64,8 @@ func mongoLookupServer(id string) (error, *Server) {
 	decodeStart := time.Now()
 	var decodeEnd int64
 	if err := res.Decode(&server); err != nil {
-		sentry.CaptureException(err)
+		util.CaptureException(ctx, err)
+		tracing.Error(span, err)
 		AddMongoLookupTime("servers", id, findEnd, time.Since(decodeStart).Microseconds())
 		return err, nil
 	}
@@ -69,26 +74,41 @@ func mongoLookupServer(id string) (error, *Server) {
 	return nil, &server
 }
 
-func LookupServer(id string, clean bool) (error, *Server) {
+func LookupServer(ctx context.Context, id string, clean bool) (error, *Server) {
+	err, server := serverCache.Fetch(id, func() (error, Server) {
+		err, server := redisLookupServer(context.WithoutCancel(ctx), id)
+		if err != nil {
+			return err, Server{}
+		}
+		return nil, *server
+	})
+	if err != nil {
+		return err, nil
+	}
+	if clean {
+		return nil, CleanupServer(fakeRank, &server)
+	}
+	return nil, &server
+}
+
+func redisLookupServer(ctx context.Context, id string) (error, *Server) {
 	findStart := time.Now()
 	var findEnd int64
-	redisServer, err := util.Database.Redis.HGet(context.TODO(), "servers", id).Result()
+	redisServer, err := hget(ctx, "servers", id)
+	countRedisLookup("servers", redisServer, err)
 	if err == nil {
 		findEnd = time.Since(findStart).Microseconds()
 		if redisServer == "" {
-			err, server := mongoLookupServer(id)
+			err, server := fallback(ctx, "servers", id, mongoLookupServer)
 			if err != nil {
 				if err == mongo.ErrNoDocuments {
 					return err, nil
 				}
-				sentry.CaptureException(err)
-				log.Errorf("Fallback for MongoDB failed for LookupServer(%s): %v", id, err.Error())
+				util.CaptureException(ctx, err)
+				util.Log(ctx).Errorf("Fallback for MongoDB failed for LookupServer(%s): %v", id, err.Error())
 				return LookupError, nil
 			} else {
 				server.MongoID = ""
-				if clean {
-					server = CleanupServer(fakeRank, server)
-				}
 				return nil, server
 			}
 		}
@@ -96,9 +116,9 @@ func LookupServer(id string, clean bool) (error, *Server) {
 		decodeStart := time.Now()
 		err = json.Unmarshal([]byte(redisServer), &server)
 		if err != nil {
-			sentry.CaptureException(err)
+			util.CaptureException(ctx, err)
 			AddRedisLookupTime("servers", id, findEnd, time.Since(decodeStart).Microseconds())
-			log.Errorf("Json parsing failed for LookupServer(%s): %v", id, err.Error())
+			util.Log(ctx).Errorf("Json parsing failed for LookupServer(%s): %v", id, err.Error())
 			return LookupError, nil
 		} else {
 			if server.ID == "" {
@@ -107,33 +127,30 @@ func LookupServer(id string, clean bool) (error, *Server) {
 			} else {
 				server.MongoID = ""
 			}
-			if clean {
-				server = CleanupServer(fakeRank, server)
-			}
 			AddRedisLookupTime("servers", id, findEnd, time.Since(decodeStart).Microseconds())
 			return nil, server
 		}
 	} else {
-		err, server := mongoLookupServer(id)
+		err, server := fallback(ctx, "servers", id, mongoLookupServer)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return err, nil
 			}
-			sentry.CaptureException(err)
-			log.Errorf("Fallback for MongoDB failed for LookupServer(%s): %v", id, err.Error())
+			util.CaptureException(ctx, err)
+			util.Log(ctx).Errorf("Fallback for MongoDB failed for LookupServer(%s): %v", id, err.Error())
 			return LookupError, nil
 		} else {
 			server.MongoID = ""
-			if clean {
-				server = CleanupServer(fakeRank, server)
-			}
 			return nil, server
 		}
 	}
 }
 
-func GetAllServers(clean bool) (error, []Server) {
-	redisServers := util.Scan[Server]("servers")
+func GetAllServers(ctx context.Context, clean bool) (error, []Server) {
+	err, redisServers := util.Scan[Server](ctx, "servers")
+	if err != nil {
+		return err, nil
+	}
 	var actual []Server
 	for _, server := range redisServers {
 		if server.ID == "" {
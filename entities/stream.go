@@ -0,0 +1,168 @@
+package entities
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/util"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const NDJSONContentType = "application/x-ndjson"
+
+// WantsNDJSON reports whether the client asked for lists as newline delimited JSON, one entity per line.
+func WantsNDJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == NDJSONContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectionKey is the ETag key of a streamed list, derived from the collection's cache version so it changes whenever
+// an entity does without scanning the collection. Only the change stream sees the website's writes, without it there
+// is no key and lists aren't tagged.
+func CollectionKey(ctx context.Context, collection string) (error, []byte) {
+	if !util.Config.Features.ChangeStreams {
+		return nil, nil
+	}
+	ctx, span := tracing.StartRedis(ctx, "GET", "cache_version:"+collection)
+	defer span.End()
+	err, version := cache.Version(ctx, util.Database.Redis, collection)
+	if err != nil {
+		tracing.Error(span, err)
+		return err, nil
+	}
+	return nil, strconv.AppendInt([]byte(collection+":"), version, 10)
+}
+
+// Yield sends one entity of a streamed list.
+type Yield func(item interface{}) error
+
+// RespondList streams the entities each yields straight to the client in the shape of the request's API version,
+// reduced to the fields asked for with ?fields=. legacyField names the list in the /v1 body, e.g. bots, key is the
+// list's ETag key, e.g. from CollectionKey, lists without one aren't tagged.
+//
+// Errors of each before anything was yielded are answered with InternalError, later ones can only abort the response.
+func RespondList(w http.ResponseWriter, r *http.Request, key []byte, legacyField string, each func(yield Yield) error) {
+	ndjson := WantsNDJSON(r)
+	codec := Negotiate(r)
+	version := VersionFrom(r.Context())
+	// Every version and format is a representation of its own, with a tag of its own.
+	representation := append([]byte{byte(version)}, codec.ContentType...)
+	if ndjson {
+		representation = append([]byte{byte(version)}, NDJSONContentType...)
+	}
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		fields, errs := ParseFields(raw, listType(legacyField))
+		if len(errs) > 0 {
+			Fail(w, r, InvalidFieldsError.WithFields(errs))
+			return
+		}
+		each = fields.projectEach(each)
+		representation = append(representation, raw...)
+	}
+	w.Header().Add("Vary", "Accept")
+	if key != nil && Precondition(w, r, append(key[:len(key):len(key)], representation...)) {
+		return
+	}
+	if !ndjson && codec.ContentType != JSONCodec.ContentType {
+		respondCollected(w, r, codec, legacyField, each)
+		return
+	}
+	buffered := bufio.NewWriterSize(w, 32<<10)
+	started, count := false, 0
+	start := func() {
+		started = true
+		if ndjson {
+			w.Header().Set("Content-Type", NDJSONContentType)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(http.StatusOK)
+		switch {
+		case ndjson:
+		case version == V1:
+			buffered.WriteString(`{"error":false,"status":200,"` + legacyField + `":[`)
+		default:
+			buffered.WriteString(`{"data":[`)
+		}
+	}
+	err := each(func(item interface{}) error {
+		encoded, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if !started {
+			start()
+		}
+		if count > 0 && !ndjson {
+			buffered.WriteByte(',')
+		}
+		count++
+		buffered.Write(encoded)
+		if ndjson {
+			buffered.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		if !started {
+			dropValidators(w)
+			Fail(w, r, InternalError)
+			return
+		}
+		util.Log(r.Context()).Errorf("Streaming a list failed after %d entities: %v", count, err)
+		buffered.Flush()
+		panic(http.ErrAbortHandler)
+	}
+	if !started {
+		start()
+	}
+	switch {
+	case ndjson:
+	case version == V1:
+		buffered.WriteString("]}\n")
+	default:
+		m := meta(r, nil)
+		m.Count = &count
+		encoded, _ := json.Marshal(m)
+		buffered.WriteString(`],"error":null,"meta":`)
+		buffered.Write(encoded)
+		buffered.WriteString("}\n")
+	}
+	buffered.Flush()
+}
+
+func dropValidators(w http.ResponseWriter) {
+	for _, header := range []string{"ETag", "Cache-Control"} {
+		w.Header().Del(header)
+	}
+}
+
+// respondCollected answers with a list in a format which needs its length upfront, so it is collected first.
+func respondCollected(w http.ResponseWriter, r *http.Request, codec Codec, legacyField string, each func(yield Yield) error) {
+	items := []interface{}{}
+	err := each(func(item interface{}) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		dropValidators(w)
+		Fail(w, r, InternalError)
+		return
+	}
+	if VersionFrom(r.Context()) == V1 {
+		write(w, r, codec, http.StatusOK, map[string]interface{}{"error": false, "status": http.StatusOK, legacyField: items})
+		return
+	}
+	write(w, r, codec, http.StatusOK, Envelope{Data: items, Meta: meta(r, items)})
+}
@@ -4,14 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/tracing"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
-	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"strconv"
 	"time"
 )
 
+var templateCache = cache.New[ServerTemplate]("templates", 1024, 1*time.Minute)
+
+// TemplatesByUsage is a sorted set of template ids scored by their usageCount, updated by every use and rebuilt by the
+// cache sync.
+const TemplatesByUsage = "templates_by_usage"
+
 type Role struct {
 	Name        string `json:"name"`
 	Color       int    `json:"color"`
@@ -34,7 +44,58 @@ type ServerTemplateLinks struct {
 	Template         string `json:"template"`
 }
 
+// Snowflake is an id discord sends as a string, templates may have stored them as numbers.
+type Snowflake string
+
+func (s *Snowflake) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, (*string)(s))
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*s = Snowflake(n.String())
+	return nil
+}
+
+func (s *Snowflake) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	var ok bool
+	switch t {
+	case bsontype.String:
+		var v string
+		v, _, ok = bsoncore.ReadString(data)
+		*s = Snowflake(v)
+	case bsontype.Int32:
+		var v int32
+		v, _, ok = bsoncore.ReadInt32(data)
+		*s = Snowflake(strconv.FormatInt(int64(v), 10))
+	case bsontype.Int64:
+		var v int64
+		v, _, ok = bsoncore.ReadInt64(data)
+		*s = Snowflake(strconv.FormatInt(v, 10))
+	case bsontype.Double:
+		var v float64
+		v, _, ok = bsoncore.ReadDouble(data)
+		*s = Snowflake(strconv.FormatFloat(v, 'f', -1, 64))
+	case bsontype.Null, bsontype.Undefined:
+		return nil
+	default:
+		return fmt.Errorf("can't decode a snowflake from %s", t)
+	}
+	if !ok {
+		return errors.New("invalid snowflake")
+	}
+	return nil
+}
+
 type GuildChannel struct {
+	// ID is the channel's placeholder in the template, which ParentID refers to for the channels of a category.
+	ID                    Snowflake              `json:"id,omitempty"`
+	ParentID              *Snowflake             `json:"parent_id,omitempty"`
 	Type                  int                    `json:"type"`
 	Position              int                    `json:"position,omitempty"`
 	Name                  string                 `json:"name"`
@@ -70,10 +131,12 @@ type ServerTemplate struct {
 	Links                       ServerTemplateLinks `json:"links"`
 }
 
-func mongoLookupTemplate(id string) (error, *ServerTemplate) {
+func mongoLookupTemplate(ctx context.Context, id string) (error, *ServerTemplate) {
+	ctx, span := tracing.StartMongo(ctx, "FindOne", "templates")
+	defer span.End()
 	findStart := time.Now()
 	var findEnd int64
-	res := util.Database.Mongo.Collection("templates").FindOne(context.TODO(), bson.M{"_id": id})
+	res := util.Database.Mongo.Collection("templates").FindOne(ctx, bson.M{"_id": id})
 	if res.Err() != nil {
 		AddMongoLookupTime("templates", id, time.Since(findStart).Microseconds(), -1)
 		return res.Err(), nil
@@ -83,7 +146,8 @@ func mongoLookupTemplate(id string) (error, *ServerTemplate) {
 	decodeStart := time.Now()
 	var decodeEnd int64
 	if err := res.Decode(&template); err != nil {
-		sentry.CaptureException(err)
+		util.CaptureException(ctx, err)
+		tracing.Error(span, err)
 		AddMongoLookupTime("templates", id, findEnd, time.Since(decodeStart).Microseconds())
 		return err, nil
 	}
@@ -92,20 +156,35 @@ func mongoLookupTemplate(id string) (error, *ServerTemplate) {
 	return nil, &template
 }
 
-func LookupTemplate(id string) (error, *ServerTemplate) {
+func LookupTemplate(ctx context.Context, id string) (error, *ServerTemplate) {
+	err, template := templateCache.Fetch(id, func() (error, ServerTemplate) {
+		err, template := redisLookupTemplate(context.WithoutCancel(ctx), id)
+		if err != nil {
+			return err, ServerTemplate{}
+		}
+		return nil, *template
+	})
+	if err != nil {
+		return err, nil
+	}
+	return nil, &template
+}
+
+func redisLookupTemplate(ctx context.Context, id string) (error, *ServerTemplate) {
 	findStart := time.Now()
 	var findEnd int64
-	redisTemplate, err := util.Database.Redis.HGet(context.TODO(), "templates", id).Result()
+	redisTemplate, err := hget(ctx, "templates", id)
+	countRedisLookup("templates", redisTemplate, err)
 	if err == nil {
 		findEnd = time.Since(findStart).Microseconds()
 		if redisTemplate == "" {
-			err, template := mongoLookupTemplate(id)
+			err, template := fallback(ctx, "templates", id, mongoLookupTemplate)
 			if err != nil {
 				if err == mongo.ErrNoDocuments {
 					return err, nil
 				}
-				sentry.CaptureException(err)
-				log.Errorf("Fallback for MongoDB failed for LookupTemplate(%s): %v", id, err.Error())
+				util.CaptureException(ctx, err)
+				util.Log(ctx).Errorf("Fallback for MongoDB failed for LookupTemplate(%s): %v", id, err.Error())
 				return LookupError, nil
 			} else {
 				template.MongoID = ""
@@ -116,9 +195,9 @@ func LookupTemplate(id string) (error, *ServerTemplate) {
 		decodeStart := time.Now()
 		err = json.Unmarshal([]byte(redisTemplate), &template)
 		if err != nil {
-			sentry.CaptureException(err)
+			util.CaptureException(ctx, err)
 			AddRedisLookupTime("templates", id, findEnd, time.Since(decodeStart).Microseconds())
-			log.Errorf("Json parsing failed for LookupTemplate(%s): %v", id, err.Error())
+			util.Log(ctx).Errorf("Json parsing failed for LookupTemplate(%s): %v", id, err.Error())
 			return LookupError, nil
 		} else {
 			if template.ID == "" {
@@ -131,13 +210,13 @@ func LookupTemplate(id string) (error, *ServerTemplate) {
 			return nil, template
 		}
 	} else {
-		err, template := mongoLookupTemplate(id)
+		err, template := fallback(ctx, "templates", id, mongoLookupTemplate)
 		if err != nil {
 			if errors.Is(err, mongo.ErrNoDocuments) {
 				return err, nil
 			}
-			sentry.CaptureException(err)
-			log.Errorf("Fallback for MongoDB failed for LookupTemplate(%s): %v", id, err.Error())
+			util.CaptureException(ctx, err)
+			util.Log(ctx).Errorf("Fallback for MongoDB failed for LookupTemplate(%s): %v", id, err.Error())
 			return LookupError, nil
 		} else {
 			template.MongoID = ""
@@ -146,8 +225,11 @@ func LookupTemplate(id string) (error, *ServerTemplate) {
 	}
 }
 
-func GetAllTemplates() (error, []ServerTemplate) {
-	redisTemplates := util.Scan[ServerTemplate]("templates")
+func GetAllTemplates(ctx context.Context) (error, []ServerTemplate) {
+	err, redisTemplates := util.Scan[ServerTemplate](ctx, "templates")
+	if err != nil {
+		return err, nil
+	}
 	var actual []ServerTemplate
 	for _, template := range redisTemplates {
 		if template.ID == "" {
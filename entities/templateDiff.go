@@ -0,0 +1,206 @@
+package entities
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// What happened to a role, channel or overwrite.
+const (
+	changeAdded   = "added"
+	changeRemoved = "removed"
+	changeChanged = "changed"
+)
+
+// FieldChange is a field which differs, pointers are compared by what they point at.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+type RoleDiff struct {
+	Name string `json:"name"`
+	// Change is added, removed or changed.
+	Change string        `json:"change"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+type OverwriteDiff struct {
+	// Target is the name of the role the overwrite is for, or the member's id.
+	Target string        `json:"target"`
+	Type   string        `json:"type"`
+	Change string        `json:"change"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+type ChannelDiff struct {
+	Name       string          `json:"name"`
+	Type       int             `json:"type"`
+	Change     string          `json:"change"`
+	Fields     []FieldChange   `json:"fields,omitempty"`
+	Overwrites []OverwriteDiff `json:"overwrites,omitempty"`
+}
+
+// TemplateDiff lists what differs between two templates, what is the same is left out. Roles are matched by name,
+// channels by name and type and overwrites by the name of their role, as ids are only placeholders.
+type TemplateDiff struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Roles    []RoleDiff    `json:"roles"`
+	Channels []ChannelDiff `json:"channels"`
+}
+
+func value(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		return rv.Elem().Interface()
+	}
+	return v
+}
+
+// compare appends a change of field to changes when from and to differ.
+func compare(changes []FieldChange, field string, from, to interface{}) []FieldChange {
+	from, to = value(from), value(to)
+	if !reflect.DeepEqual(from, to) {
+		changes = append(changes, FieldChange{Field: field, From: from, To: to})
+	}
+	return changes
+}
+
+// keyed indexes items by key, numbering repeated keys so duplicates are matched in order.
+func keyed[T any](items []T, key func(T) string) (map[string]T, []string) {
+	byKey := map[string]T{}
+	var order []string
+	seen := map[string]int{}
+	for _, item := range items {
+		k := key(item)
+		seen[k]++
+		if seen[k] > 1 {
+			k += "#" + strconv.Itoa(seen[k])
+		}
+		byKey[k] = item
+		order = append(order, k)
+	}
+	return byKey, order
+}
+
+// diff calls changed for the keys in both, and added and removed for the others, in the order of from then to. Keys
+// are computed per side, as they may depend on the template the items are from.
+func diff[T any](from, to []T, fromKey, toKey func(T) string, added, removed func(T), changed func(a, b T)) {
+	fromKeyed, fromOrder := keyed(from, fromKey)
+	toKeyed, toOrder := keyed(to, toKey)
+	for _, k := range fromOrder {
+		if b, ok := toKeyed[k]; ok {
+			changed(fromKeyed[k], b)
+		} else {
+			removed(fromKeyed[k])
+		}
+	}
+	for _, k := range toOrder {
+		if _, ok := fromKeyed[k]; !ok {
+			added(toKeyed[k])
+		}
+	}
+}
+
+// overwriteTarget names who an overwrite is for, roles are referred to by their index in the template.
+func overwriteTarget(template *ServerTemplate, overwrite PermissionsOverwrite) string {
+	if overwriteType(overwrite.Type) == 0 {
+		if i, err := strconv.Atoi(overwrite.ID); err == nil && i >= 0 && i < len(template.Roles) {
+			return template.Roles[i].Name
+		}
+	}
+	return overwrite.ID
+}
+
+func overwriteKind(overwrite PermissionsOverwrite) string {
+	if overwriteType(overwrite.Type) == 1 {
+		return "member"
+	}
+	return "role"
+}
+
+func diffOverwrites(a, b *ServerTemplate, from, to []PermissionsOverwrite) []OverwriteDiff {
+	var diffs []OverwriteDiff
+	key := func(t *ServerTemplate) func(PermissionsOverwrite) string {
+		return func(o PermissionsOverwrite) string { return overwriteKind(o) + " " + overwriteTarget(t, o) }
+	}
+	diff(from, to, key(a), key(b),
+		func(o PermissionsOverwrite) {
+			diffs = append(diffs, OverwriteDiff{Target: overwriteTarget(b, o), Type: overwriteKind(o), Change: changeAdded})
+		},
+		func(o PermissionsOverwrite) {
+			diffs = append(diffs, OverwriteDiff{Target: overwriteTarget(a, o), Type: overwriteKind(o), Change: changeRemoved})
+		},
+		func(o, n PermissionsOverwrite) {
+			var fields []FieldChange
+			fields = compare(fields, "allow", o.Allow, n.Allow)
+			fields = compare(fields, "deny", o.Deny, n.Deny)
+			if len(fields) > 0 {
+				diffs = append(diffs, OverwriteDiff{Target: overwriteTarget(b, n), Type: overwriteKind(n), Change: changeChanged, Fields: fields})
+			}
+		},
+	)
+	return diffs
+}
+
+// parentName is the name of the category a channel is in, empty when it isn't in one.
+func parentName(template *ServerTemplate, channel GuildChannel) string {
+	if channel.ParentID != nil {
+		for _, parent := range template.Channels {
+			if parent.Type == CategoryChannel && parent.ID == *channel.ParentID {
+				return parent.Name
+			}
+		}
+	}
+	return ""
+}
+
+func DiffTemplates(a, b *ServerTemplate) *TemplateDiff {
+	result := &TemplateDiff{From: a.ID, To: b.ID, Roles: []RoleDiff{}, Channels: []ChannelDiff{}}
+	roleKey := func(r Role) string { return r.Name }
+	diff(a.Roles, b.Roles, roleKey, roleKey,
+		func(r Role) { result.Roles = append(result.Roles, RoleDiff{Name: r.Name, Change: changeAdded}) },
+		func(r Role) { result.Roles = append(result.Roles, RoleDiff{Name: r.Name, Change: changeRemoved}) },
+		func(o, n Role) {
+			var fields []FieldChange
+			fields = compare(fields, "color", o.Color, n.Color)
+			fields = compare(fields, "hoist", o.Hoist, n.Hoist)
+			fields = compare(fields, "position", o.Position, n.Position)
+			fields = compare(fields, "permissions", o.Permissions, n.Permissions)
+			fields = compare(fields, "managed", o.Managed, n.Managed)
+			fields = compare(fields, "mentionable", o.Mentionable, n.Mentionable)
+			if len(fields) > 0 {
+				result.Roles = append(result.Roles, RoleDiff{Name: n.Name, Change: changeChanged, Fields: fields})
+			}
+		},
+	)
+	channelKey := func(c GuildChannel) string { return strconv.Itoa(c.Type) + " " + c.Name }
+	diff(a.Channels, b.Channels, channelKey, channelKey,
+		func(c GuildChannel) {
+			result.Channels = append(result.Channels, ChannelDiff{Name: c.Name, Type: c.Type, Change: changeAdded})
+		},
+		func(c GuildChannel) {
+			result.Channels = append(result.Channels, ChannelDiff{Name: c.Name, Type: c.Type, Change: changeRemoved})
+		},
+		func(o, n GuildChannel) {
+			var fields []FieldChange
+			fields = compare(fields, "parent", parentName(a, o), parentName(b, n))
+			fields = compare(fields, "position", o.Position, n.Position)
+			fields = compare(fields, "topic", o.Topic, n.Topic)
+			fields = compare(fields, "nsfw", o.NSFW, n.NSFW)
+			fields = compare(fields, "rate_limit_per_user", o.RateLimitPerUser, n.RateLimitPerUser)
+			fields = compare(fields, "bitrate", o.Bitrate, n.Bitrate)
+			fields = compare(fields, "user_limit", o.UserLimit, n.UserLimit)
+			overwrites := diffOverwrites(a, b, o.PermissionsOverwrites, n.PermissionsOverwrites)
+			if len(fields) > 0 || len(overwrites) > 0 {
+				result.Channels = append(result.Channels, ChannelDiff{Name: n.Name, Type: n.Type, Change: changeChanged, Fields: fields, Overwrites: overwrites})
+			}
+		},
+	)
+	return result
+}
@@ -0,0 +1,299 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Channel types as discord numbers them.
+const (
+	TextChannel     = 0
+	VoiceChannel    = 2
+	CategoryChannel = 4
+	NewsChannel     = 5
+	StageChannel    = 13
+	ForumChannel    = 15
+)
+
+// ExportFormats are the formats templates can be exported in, the first is the default.
+var ExportFormats = []string{"discord", "yaml", "terraform"}
+
+// DiscordRole is a role of a guild creation payload, ids are placeholders which overwrites refer to. Like in discord's
+// own templates a role's placeholder is its index, the first role being @everyone.
+type DiscordRole struct {
+	ID          int    `json:"id" yaml:"id"`
+	Name        string `json:"name" yaml:"name"`
+	Color       int    `json:"color" yaml:"color"`
+	Hoist       bool   `json:"hoist" yaml:"hoist"`
+	Position    int    `json:"position" yaml:"position"`
+	Permissions string `json:"permissions" yaml:"permissions"`
+	Mentionable bool   `json:"mentionable" yaml:"mentionable"`
+}
+
+type DiscordOverwrite struct {
+	ID string `json:"id" yaml:"id"`
+	// Type is 0 for roles and 1 for members.
+	Type  int    `json:"type" yaml:"type"`
+	Allow string `json:"allow" yaml:"allow"`
+	Deny  string `json:"deny" yaml:"deny"`
+}
+
+// DiscordChannel is a channel of a guild creation payload, its id is a placeholder its category's children refer to.
+type DiscordChannel struct {
+	ID                   Snowflake          `json:"id,omitempty" yaml:"id,omitempty"`
+	ParentID             *Snowflake         `json:"parent_id,omitempty" yaml:"parent_id,omitempty"`
+	Name                 string             `json:"name" yaml:"name"`
+	Type                 int                `json:"type" yaml:"type"`
+	Position             int                `json:"position" yaml:"position"`
+	Topic                *string            `json:"topic,omitempty" yaml:"topic,omitempty"`
+	NSFW                 *bool              `json:"nsfw,omitempty" yaml:"nsfw,omitempty"`
+	Bitrate              *int               `json:"bitrate,omitempty" yaml:"bitrate,omitempty"`
+	UserLimit            *int               `json:"user_limit,omitempty" yaml:"user_limit,omitempty"`
+	RateLimitPerUser     int                `json:"rate_limit_per_user,omitempty" yaml:"rate_limit_per_user,omitempty"`
+	PermissionOverwrites []DiscordOverwrite `json:"permission_overwrites" yaml:"permission_overwrites"`
+}
+
+// DiscordGuild is the body of discord's create guild request.
+type DiscordGuild struct {
+	Name                        string           `json:"name" yaml:"name"`
+	Region                      string           `json:"region,omitempty" yaml:"region,omitempty"`
+	VerificationLevel           int              `json:"verification_level" yaml:"verification_level"`
+	DefaultMessageNotifications int              `json:"default_message_notifications" yaml:"default_message_notifications"`
+	ExplicitContentFilter       int              `json:"explicit_content_filter" yaml:"explicit_content_filter"`
+	AfkTimeout                  int              `json:"afk_timeout" yaml:"afk_timeout"`
+	Roles                       []DiscordRole    `json:"roles" yaml:"roles"`
+	Channels                    []DiscordChannel `json:"channels" yaml:"channels"`
+}
+
+// overwriteType normalises the types templates were stored with, role/member or discord's numbers.
+func overwriteType(t string) int {
+	if t == "member" || t == "1" {
+		return 1
+	}
+	return 0
+}
+
+func NewDiscordGuild(template *ServerTemplate) *DiscordGuild {
+	guild := &DiscordGuild{
+		Name:                        template.Name,
+		Region:                      template.Region,
+		VerificationLevel:           template.VerificationLevel,
+		DefaultMessageNotifications: template.DefaultMessageNotifications,
+		ExplicitContentFilter:       template.ExplicitContent,
+		AfkTimeout:                  template.AfkTimeout,
+		Roles:                       make([]DiscordRole, len(template.Roles)),
+		Channels:                    make([]DiscordChannel, len(template.Channels)),
+	}
+	for i, role := range template.Roles {
+		guild.Roles[i] = DiscordRole{
+			ID:          i,
+			Name:        role.Name,
+			Color:       role.Color,
+			Hoist:       role.Hoist,
+			Position:    role.Position,
+			Permissions: strconv.Itoa(role.Permissions),
+			Mentionable: role.Mentionable,
+		}
+	}
+	for i, channel := range template.Channels {
+		overwrites := make([]DiscordOverwrite, len(channel.PermissionsOverwrites))
+		for j, overwrite := range channel.PermissionsOverwrites {
+			overwrites[j] = DiscordOverwrite{
+				ID:    overwrite.ID,
+				Type:  overwriteType(overwrite.Type),
+				Allow: strconv.Itoa(overwrite.Allow),
+				Deny:  strconv.Itoa(overwrite.Deny),
+			}
+		}
+		guild.Channels[i] = DiscordChannel{
+			ID:                   channel.ID,
+			ParentID:             channel.ParentID,
+			Name:                 channel.Name,
+			Type:                 channel.Type,
+			Position:             channel.Position,
+			Topic:                channel.Topic,
+			NSFW:                 channel.NSFW,
+			Bitrate:              channel.Bitrate,
+			UserLimit:            channel.UserLimit,
+			RateLimitPerUser:     channel.RateLimitPerUser,
+			PermissionOverwrites: overwrites,
+		}
+	}
+	return guild
+}
+
+// ExportTemplate renders a template in one of ExportFormats, it returns the body and its content type.
+func ExportTemplate(template *ServerTemplate, format string) ([]byte, string, error) {
+	switch format {
+	case "discord":
+		body, err := json.MarshalIndent(NewDiscordGuild(template), "", "  ")
+		return body, "application/json", err
+	case "yaml":
+		body, err := yaml.Marshal(NewDiscordGuild(template))
+		return body, "application/yaml", err
+	case "terraform":
+		return terraform(template), "text/plain; charset=utf-8", nil
+	}
+	return nil, "", fmt.Errorf("unknown export format %q", format)
+}
+
+// hclString quotes s for HCL, which unlike JSON also interpolates ${ and %{.
+func hclString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteRune(r)
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// hclBlock writes a block with its attributes aligned like terraform fmt does.
+func hclBlock(b *bytes.Buffer, header string, attributes [][2]string) {
+	width := 0
+	for _, attribute := range attributes {
+		width = max(width, len(attribute[0]))
+	}
+	fmt.Fprintf(b, "\n%s {\n", header)
+	for _, attribute := range attributes {
+		fmt.Fprintf(b, "  %-*s = %s\n", width, attribute[0], attribute[1])
+	}
+	b.WriteString("}\n")
+}
+
+// commentText replaces control characters, which could end a comment early, with spaces.
+func commentText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// channelResources are the resources of the discord provider for each channel type it supports.
+var channelResources = map[int]string{
+	TextChannel:     "discord_text_channel",
+	VoiceChannel:    "discord_voice_channel",
+	CategoryChannel: "discord_category_channel",
+	NewsChannel:     "discord_news_channel",
+}
+
+// terraform renders a template as a configuration for the Lucky3028/discord provider, applied to an existing server.
+func terraform(template *ServerTemplate) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s (template %s on Discord Extreme List)\n", commentText(template.Name), template.ID)
+	b.WriteString(`
+terraform {
+  required_providers {
+    discord = {
+      source = "Lucky3028/discord"
+    }
+  }
+}
+
+variable "server_id" {
+  type        = string
+  description = "The server the template is applied to."
+}
+`)
+	// The @everyone role exists already and shares the server's id.
+	roleIDs := map[string]string{}
+	for i, role := range template.Roles {
+		placeholder := strconv.Itoa(i)
+		if i == 0 {
+			roleIDs[placeholder] = "var.server_id"
+			hclBlock(&b, `resource "discord_role_everyone" "everyone"`, [][2]string{
+				{"server_id", "var.server_id"},
+				{"permissions", strconv.Itoa(role.Permissions)},
+			})
+			continue
+		}
+		name := "role_" + placeholder
+		roleIDs[placeholder] = "discord_role." + name + ".id"
+		hclBlock(&b, `resource "discord_role" "`+name+`"`, [][2]string{
+			{"server_id", "var.server_id"},
+			{"name", hclString(role.Name)},
+			{"permissions", strconv.Itoa(role.Permissions)},
+			{"color", strconv.Itoa(role.Color)},
+			{"hoist", strconv.FormatBool(role.Hoist)},
+			{"mentionable", strconv.FormatBool(role.Mentionable)},
+			{"position", strconv.Itoa(role.Position)},
+		})
+	}
+	categories := map[Snowflake]string{}
+	for i, channel := range template.Channels {
+		if channel.Type == CategoryChannel && channel.ID != "" {
+			categories[channel.ID] = channelResources[CategoryChannel] + ".channel_" + strconv.Itoa(i) + ".id"
+		}
+	}
+	for i, channel := range template.Channels {
+		resource, ok := channelResources[channel.Type]
+		if !ok {
+			fmt.Fprintf(&b, "\n# %s isn't exported, the provider doesn't support channels of type %d.\n",
+				hclString(channel.Name), channel.Type)
+			continue
+		}
+		name := "channel_" + strconv.Itoa(i)
+		attributes := [][2]string{
+			{"server_id", "var.server_id"},
+			{"name", hclString(channel.Name)},
+			{"position", strconv.Itoa(channel.Position)},
+		}
+		if channel.ParentID != nil && channel.Type != CategoryChannel && categories[*channel.ParentID] != "" {
+			attributes = append(attributes, [2]string{"category", categories[*channel.ParentID]})
+		}
+		if channel.Topic != nil && channel.Type != VoiceChannel && channel.Type != CategoryChannel {
+			attributes = append(attributes, [2]string{"topic", hclString(*channel.Topic)})
+		}
+		if channel.NSFW != nil && channel.Type == TextChannel {
+			attributes = append(attributes, [2]string{"nsfw", strconv.FormatBool(*channel.NSFW)})
+		}
+		if channel.Bitrate != nil && channel.Type == VoiceChannel {
+			attributes = append(attributes, [2]string{"bitrate", strconv.Itoa(*channel.Bitrate)})
+		}
+		if channel.UserLimit != nil && channel.Type == VoiceChannel {
+			attributes = append(attributes, [2]string{"user_limit", strconv.Itoa(*channel.UserLimit)})
+		}
+		hclBlock(&b, `resource "`+resource+`" "`+name+`"`, attributes)
+		for j, overwrite := range channel.PermissionsOverwrites {
+			target, kind := hclString(overwrite.ID), "user"
+			if overwriteType(overwrite.Type) == 0 {
+				kind = "role"
+				if id, ok := roleIDs[overwrite.ID]; ok {
+					target = id
+				}
+			}
+			hclBlock(&b, `resource "discord_channel_permission" "`+name+"_"+kind+"_"+strconv.Itoa(j)+`"`, [][2]string{
+				{"channel_id", resource + "." + name + ".id"},
+				{"type", hclString(kind)},
+				{"overwrite_id", target},
+				{"allow", strconv.Itoa(overwrite.Allow)},
+				{"deny", strconv.Itoa(overwrite.Deny)},
+			})
+		}
+	}
+	return b.Bytes()
+}
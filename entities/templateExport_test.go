@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTerraformNames(t *testing.T) {
+	template := &ServerTemplate{
+		ID:    "template",
+		Name:  "Evil\rname\u0085resource \"x\" \"y\" {}\x0bend",
+		Roles: []Role{{Name: "@everyone"}},
+		Channels: []GuildChannel{{
+			Type: TextChannel,
+			Name: "general",
+			// Ids which only differ in characters resource names can't have used to share a name.
+			PermissionsOverwrites: []PermissionsOverwrite{
+				{ID: "a.b", Type: "member"},
+				{ID: "a-b", Type: "member"},
+				{ID: "a b", Type: "member"},
+			},
+		}},
+	}
+	out := string(terraform(template))
+	header, _, _ := strings.Cut(out, "\n")
+	if strings.ContainsFunc(header, func(r rune) bool { return r < 0x20 || (r >= 0x7f && r <= 0x9f) }) {
+		t.Fatalf("control characters in the header comment: %q", header)
+	}
+	names := map[string]bool{}
+	for _, match := range regexp.MustCompile(`resource "discord_channel_permission" "([^"]+)"`).FindAllStringSubmatch(out, -1) {
+		if names[match[1]] {
+			t.Fatalf("two overwrites are named %s", match[1])
+		}
+		names[match[1]] = true
+	}
+	if len(names) != 3 || !names["channel_0_user_0"] {
+		t.Fatalf("overwrites are named %v, want channel_<i>_<kind>_<j>", names)
+	}
+}
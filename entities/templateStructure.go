@@ -0,0 +1,135 @@
+package entities
+
+import (
+	"sort"
+	"strconv"
+)
+
+// RolePermissions are what a role is allowed in a channel, see EffectivePermissions.
+type RolePermissions struct {
+	RoleID string `json:"roleId"`
+	Role   string `json:"role"`
+	Permissions
+}
+
+type StructureRole struct {
+	// ID is the role's placeholder in the template, its index.
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Color       int         `json:"color"`
+	Hoist       bool        `json:"hoist"`
+	Position    int         `json:"position"`
+	Mentionable bool        `json:"mentionable"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type StructureChannel struct {
+	ID          Snowflake         `json:"id,omitempty"`
+	Name        string            `json:"name"`
+	Type        int               `json:"type"`
+	Position    int               `json:"position"`
+	Topic       *string           `json:"topic,omitempty"`
+	NSFW        *bool             `json:"nsfw,omitempty"`
+	Permissions []RolePermissions `json:"permissions"`
+	// Channels are those of a category, in display order.
+	Channels []StructureChannel `json:"channels,omitempty"`
+}
+
+// TemplateStructure is a template laid out like discord shows it: roles from the top of the hierarchy down, then the
+// channels without a category followed by the categories with theirs.
+type TemplateStructure struct {
+	ID       string             `json:"id"`
+	Name     string             `json:"name"`
+	Roles    []StructureRole    `json:"roles"`
+	Channels []StructureChannel `json:"channels"`
+}
+
+// voiceLike channels are listed after the text ones of their category.
+func voiceLike(channelType int) bool {
+	return channelType == VoiceChannel || channelType == StageChannel
+}
+
+// sortChannels orders channels like discord: text before voice, then by position and then by id.
+func sortChannels(channels []StructureChannel) {
+	sort.SliceStable(channels, func(i, j int) bool {
+		a, b := channels[i], channels[j]
+		if voiceLike(a.Type) != voiceLike(b.Type) {
+			return !voiceLike(a.Type)
+		}
+		if a.Position != b.Position {
+			return a.Position < b.Position
+		}
+		x, errX := strconv.ParseUint(string(a.ID), 10, 64)
+		y, errY := strconv.ParseUint(string(b.ID), 10, 64)
+		return errX == nil && errY == nil && x < y
+	})
+}
+
+func NewTemplateStructure(template *ServerTemplate) *TemplateStructure {
+	structure := &TemplateStructure{ID: template.ID, Name: template.Name, Roles: []StructureRole{}, Channels: []StructureChannel{}}
+	for i, role := range template.Roles {
+		structure.Roles = append(structure.Roles, StructureRole{
+			ID:          strconv.Itoa(i),
+			Name:        role.Name,
+			Color:       role.Color,
+			Hoist:       role.Hoist,
+			Position:    role.Position,
+			Mentionable: role.Mentionable,
+			Permissions: NewPermissions(role.Permissions),
+		})
+	}
+	// @everyone stays at the bottom whatever its position says.
+	sort.SliceStable(structure.Roles, func(i, j int) bool {
+		a, b := structure.Roles[i], structure.Roles[j]
+		if a.ID == "0" || b.ID == "0" {
+			return b.ID == "0" && a.ID != "0"
+		}
+		return a.Position > b.Position
+	})
+	categories := map[Snowflake]bool{}
+	for _, channel := range template.Channels {
+		if channel.Type == CategoryChannel && channel.ID != "" {
+			categories[channel.ID] = true
+		}
+	}
+	var top []StructureChannel
+	children := map[Snowflake][]StructureChannel{}
+	for _, channel := range template.Channels {
+		node := StructureChannel{
+			ID:          channel.ID,
+			Name:        channel.Name,
+			Type:        channel.Type,
+			Position:    channel.Position,
+			Topic:       channel.Topic,
+			NSFW:        channel.NSFW,
+			Permissions: make([]RolePermissions, len(template.Roles)),
+		}
+		for i, role := range template.Roles {
+			node.Permissions[i] = RolePermissions{
+				RoleID:      strconv.Itoa(i),
+				Role:        role.Name,
+				Permissions: NewPermissions(EffectivePermissions(template, i, channel)),
+			}
+		}
+		// Channels whose category doesn't exist are shown without one, like discord does.
+		if channel.ParentID != nil && categories[*channel.ParentID] && channel.Type != CategoryChannel {
+			children[*channel.ParentID] = append(children[*channel.ParentID], node)
+		} else {
+			top = append(top, node)
+		}
+	}
+	var loose, grouped []StructureChannel
+	for _, node := range top {
+		if node.Type == CategoryChannel {
+			node.Channels = children[node.ID]
+			sortChannels(node.Channels)
+			grouped = append(grouped, node)
+		} else {
+			loose = append(loose, node)
+		}
+	}
+	sortChannels(loose)
+	sortChannels(grouped)
+	structure.Channels = append(append(structure.Channels, loose...), grouped...)
+	return structure
+}
@@ -3,14 +3,16 @@ package entities
 import (
 	"context"
 	"encoding/json"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/tracing"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
-	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"time"
 )
 
+var userCache = cache.New[User]("users", 4096, 1*time.Minute)
+
 type UserPreferences struct {
 	CustomGlobalCSS         string `json:"customGlobalCss"`
 	DefaultColour           string `json:"defaultColour"`
@@ -136,10 +138,12 @@ func CleanupUser(rank UserRank, user *User) *User {
 	return &copied
 }
 
-func mongoLookupUser(id string) (error, *User) {
+func mongoLookupUser(ctx context.Context, id string) (error, *User) {
+	ctx, span := tracing.StartMongo(ctx, "FindOne", "users")
+	defer span.End()
 	findStart := time.Now()
 	var findEnd int64
-	res := util.Database.Mongo.Collection("users").FindOne(context.TODO(), bson.M{"_id": id})
+	res := util.Database.Mongo.Collection("users").FindOne(ctx, bson.M{"_id": id})
 	if res.Err() != nil {
 		AddMongoLookupTime("users", id, time.Since(findStart).Microseconds(), -1)
 		return res.Err(), nil
@@ -149,7 +153,8 @@ func mongoLookupUser(id string) (error, *User) {
 	decodeStart := time.Now()
 	var decodeEnd int64
 	if err := res.Decode(&user); err != nil {
-		sentry.CaptureException(err)
+		util.CaptureException(ctx, err)
+		tracing.Error(span, err)
 		AddMongoLookupTime("users", id, findEnd, time.Since(decodeStart).Microseconds())
 		return err, nil
 	}
@@ -158,26 +163,41 @@ func mongoLookupUser(id string) (error, *User) {
 	return nil, &user
 }
 
-func LookupUser(id string, clean bool) (error, *User) {
+func LookupUser(ctx context.Context, id string, clean bool) (error, *User) {
+	err, user := userCache.Fetch(id, func() (error, User) {
+		err, user := redisLookupUser(context.WithoutCancel(ctx), id)
+		if err != nil {
+			return err, User{}
+		}
+		return nil, *user
+	})
+	if err != nil {
+		return err, nil
+	}
+	if clean {
+		return nil, CleanupUser(fakeRank, &user)
+	}
+	return nil, &user
+}
+
+func redisLookupUser(ctx context.Context, id string) (error, *User) {
 	findStart := time.Now()
 	var findEnd int64
-	redisUser, err := util.Database.Redis.HGet(context.TODO(), "users", id).Result()
+	redisUser, err := hget(ctx, "users", id)
+	countRedisLookup("users", redisUser, err)
 	if err == nil {
 		findEnd = time.Since(findStart).Microseconds()
 		if redisUser == "" {
-			err, user := mongoLookupUser(id)
+			err, user := fallback(ctx, "users", id, mongoLookupUser)
 			if err != nil {
 				if err == mongo.ErrNoDocuments {
 					return err, nil
 				}
-				sentry.CaptureException(err)
-				log.Errorf("Fallback for MongoDB failed for LookupUser(%s): %v", id, err.Error())
+				util.CaptureException(ctx, err)
+				util.Log(ctx).Errorf("Fallback for MongoDB failed for LookupUser(%s): %v", id, err.Error())
 				return LookupError, nil
 			} else {
 				user.MongoID = ""
-				if clean {
-					user = CleanupUser(fakeRank, user)
-				}
 				return nil, user
 			}
 		}
@@ -185,9 +205,9 @@ func LookupUser(id string, clean bool) (error, *User) {
 		decodeStart := time.Now()
 		err = json.Unmarshal([]byte(redisUser), &user)
 		if err != nil {
-			sentry.CaptureException(err)
+			util.CaptureException(ctx, err)
 			AddRedisLookupTime("users", id, findEnd, time.Since(decodeStart).Microseconds())
-			log.Errorf("Json parsing failed for LookupUser(%s): %v", id, err.Error())
+			util.Log(ctx).Errorf("Json parsing failed for LookupUser(%s): %v", id, err.Error())
 			return LookupError, nil
 		} else {
 			if user.ID == "" {
@@ -196,33 +216,30 @@ func LookupUser(id string, clean bool) (error, *User) {
 			} else {
 				user.MongoID = ""
 			}
-			if clean {
-				user = CleanupUser(fakeRank, user)
-			}
 			AddRedisLookupTime("users", id, findEnd, time.Since(decodeStart).Microseconds())
 			return nil, user
 		}
 	} else {
-		err, user := mongoLookupUser(id)
+		err, user := fallback(ctx, "users", id, mongoLookupUser)
 		if err != nil {
 			if err == mongo.ErrNoDocuments {
 				return err, nil
 			}
-			sentry.CaptureException(err)
-			log.Errorf("Fallback for MongoDB failed for LookupUser(%s): %v", id, err.Error())
+			util.CaptureException(ctx, err)
+			util.Log(ctx).Errorf("Fallback for MongoDB failed for LookupUser(%s): %v", id, err.Error())
 			return LookupError, nil
 		} else {
 			user.MongoID = ""
-			if clean {
-				user = CleanupUser(fakeRank, user)
-			}
 			return nil, user
 		}
 	}
 }
 
-func GetAllUsers(clean bool) (error, []User) {
-	redisUsers := util.Scan[User]("users")
+func GetAllUsers(ctx context.Context, clean bool) (error, []User) {
+	err, redisUsers := util.Scan[User](ctx, "users")
+	if err != nil {
+		return err, nil
+	}
 	var actual []User
 	for _, user := range redisUsers {
 		if user.ID == "" {
@@ -0,0 +1,214 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validate checks v, a struct or a pointer to one, against the rules in its validate struct tags and returns every
+// failure. Rules are comma separated:
+//
+//	required   the value must not be the zero value
+//	min=N      numbers must be at least N, strings, slices and maps must have at least N elements
+//	max=N      like min, but at most N
+//	oneof=a b  strings must be one of the space separated values
+//
+// Nested structs and slices of structs are validated too, fields are named by their json names. Tags with rules which
+// don't exist or don't apply to their field are returned as an error, see CheckRules.
+func Validate(v interface{}) (error, []FieldError) {
+	if err := CheckRules(v); err != nil {
+		return err, nil
+	}
+	var errs []FieldError
+	validateValue(reflect.ValueOf(v), "", &errs)
+	return nil, errs
+}
+
+// checked caches what CheckRules found for each type.
+var checked sync.Map
+
+// CheckRules returns every rule of v's type, and of the types it contains, which doesn't exist or doesn't apply to its
+// field. Routes check their bodies when they are documented, so a bad tag fails startup instead of requests.
+func CheckRules(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	if err, ok := checked.Load(t); ok {
+		if err == nil {
+			return nil
+		}
+		return err.(error)
+	}
+	var errs []error
+	checkType(t, t.String(), map[reflect.Type]bool{}, &errs)
+	err := errors.Join(errs...)
+	checked.Store(t, err)
+	return err
+}
+
+func checkType(t reflect.Type, path string, seen map[reflect.Type]bool, errs *[]error) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		name := join(path, jsonName(field))
+		if rules := field.Tag.Get("validate"); rules != "" {
+			for _, rule := range strings.Split(rules, ",") {
+				if err := checkRule(field.Type, rule); err != nil {
+					*errs = append(*errs, fmt.Errorf("%s: %w", name, err))
+				}
+			}
+		}
+		checkType(field.Type, name, seen, errs)
+	}
+}
+
+// checkRule is whether rule exists and applies to fields of type t.
+func checkRule(t reflect.Type, rule string) error {
+	name, arg, _ := strings.Cut(rule, "=")
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch name {
+	case "required":
+	case "min", "max":
+		if _, err := strconv.ParseFloat(arg, 64); err != nil {
+			return fmt.Errorf("validate: %q needs a number", rule)
+		}
+		if _, ok := size(reflect.Zero(t)); !ok {
+			return fmt.Errorf("validate: %q doesn't apply to %s", rule, t)
+		}
+	case "oneof":
+		if t.Kind() != reflect.String {
+			return fmt.Errorf("validate: %q doesn't apply to %s", rule, t)
+		}
+	default:
+		return fmt.Errorf("validate: unknown rule %q", rule)
+	}
+	return nil
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func validateValue(value reflect.Value, path string, errs *[]FieldError) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() || field.Tag.Get("json") == "-" {
+				continue
+			}
+			name := join(path, jsonName(field))
+			if rules := field.Tag.Get("validate"); rules != "" {
+				for _, rule := range strings.Split(rules, ",") {
+					if msg := check(value.Field(i), rule); msg != "" {
+						*errs = append(*errs, FieldError{Field: name, Message: msg})
+					}
+				}
+			}
+			validateValue(value.Field(i), name, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+// size is what min and max compare against, false when they don't apply to the value.
+func size(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(value.Len()), true
+	}
+	return 0, false
+}
+
+func check(value reflect.Value, rule string) string {
+	name, arg, _ := strings.Cut(rule, "=")
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			if name == "required" {
+				return "is required"
+			}
+			return ""
+		}
+		value = value.Elem()
+	}
+	switch name {
+	case "required":
+		if value.IsZero() {
+			return "is required"
+		}
+	case "min", "max":
+		// CheckRules made sure the limit is a number and the value has a size.
+		limit, _ := strconv.ParseFloat(arg, 64)
+		n, _ := size(value)
+		unit := ""
+		switch value.Kind() {
+		case reflect.String:
+			unit = " characters"
+		case reflect.Slice, reflect.Map, reflect.Array:
+			unit = " elements"
+		}
+		if name == "min" && n < limit {
+			return fmt.Sprintf("must be at least %s%s", arg, unit)
+		}
+		if name == "max" && n > limit {
+			return fmt.Sprintf("must be at most %s%s", arg, unit)
+		}
+	case "oneof":
+		options := strings.Fields(arg)
+		for _, option := range options {
+			if value.String() == option {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(options, ", ")
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package entities
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type validated struct {
+	Name    string   `json:"name" validate:"required,max=5"`
+	Count   *int     `json:"count" validate:"min=1"`
+	Owner   *owner   `json:"owner" validate:"required"`
+	Kind    string   `json:"kind" validate:"oneof=bot server"`
+	Tags    []string `json:"tags" validate:"max=2"`
+	Owners  []owner  `json:"owners"`
+	Ignored string   `json:"-" validate:"required"`
+}
+
+type owner struct {
+	ID string `json:"id" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	one, zero := 1, 0
+	tests := []struct {
+		name string
+		body validated
+		want []FieldError
+	}{
+		{"valid", validated{Name: "a", Count: &one, Kind: "bot", Owner: &owner{ID: "1"}, Owners: []owner{{ID: "1"}}}, nil},
+		{"every failure is listed", validated{Name: "toolong", Kind: "user", Tags: []string{"a", "b", "c"}, Owners: []owner{{ID: "1"}, {}}}, []FieldError{
+			{Field: "name", Message: "must be at most 5 characters"},
+			{Field: "owner", Message: "is required"},
+			{Field: "kind", Message: "must be one of bot, server"},
+			{Field: "tags", Message: "must be at most 2 elements"},
+			{Field: "owners[1].id", Message: "is required"},
+		}},
+		{"pointers are checked by what they point to", validated{Name: "a", Count: &zero, Kind: "bot", Owner: &owner{ID: "1"}}, []FieldError{
+			{Field: "count", Message: "must be at least 1"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err, fields := Validate(&test.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fields, test.want) {
+				t.Fatalf("Validate() = %v, want %v", fields, test.want)
+			}
+		})
+	}
+}
+
+func TestBadRules(t *testing.T) {
+	tests := []struct {
+		name string
+		body interface{}
+		want string
+	}{
+		{"unknown rule", struct {
+			Name string `json:"name" validate:"required,email"`
+		}{}, `name: validate: unknown rule "email"`},
+		{"limit isn't a number", struct {
+			Name string `json:"name" validate:"max=five"`
+		}{}, `name: validate: "max=five" needs a number`},
+		{"no size", struct {
+			Ok bool `json:"ok" validate:"min=1"`
+		}{}, `ok: validate: "min=1" doesn't apply to bool`},
+		{"oneof on a number", struct {
+			Count int `json:"count" validate:"oneof=1 2"`
+		}{}, `count: validate: "oneof=1 2" doesn't apply to int`},
+		{"nested", struct {
+			Owners []struct {
+				ID string `json:"id" validate:"requird"`
+			} `json:"owners"`
+		}{}, `owners.id: validate: unknown rule "requird"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckRules(test.body)
+			if err == nil || !strings.HasSuffix(err.Error(), test.want) {
+				t.Fatalf("CheckRules() = %v, want %s", err, test.want)
+			}
+			// Requests with such bodies get an error instead of a panic.
+			if err, _ := Validate(test.body); err == nil {
+				t.Fatal("Validate() didn't return the bad rule")
+			}
+		})
+	}
+	if err := CheckRules(&validated{}); err != nil {
+		t.Fatalf("CheckRules() = %v for valid rules", err)
+	}
+}
@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/discordextremelist/api/metrics"
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const Channel = "events"
+
+const (
+	BotApproved     = "bot.approved"
+	BotArchived     = "bot.archived"
+	BotStatsUpdated = "bot.stats_updated"
+	ServerCreated   = "server.created"
+	// ServerReviewUpdated is published when a server's status.reviewRequired flips either way.
+	ServerReviewUpdated = "server.review_updated"
+	TemplateCreated     = "template.created"
+)
+
+// Types lists every event type, they are named <entity>.<change>.
+var Types = []string{BotApproved, BotArchived, BotStatsUpdated, ServerCreated, ServerReviewUpdated, TemplateCreated}
+
+// Event is a change to an entity. Data is the entity as the public routes return it, or the new counts for
+// bot.stats_updated.
+type Event struct {
+	ID       string      `json:"id"`
+	Type     string      `json:"type"`
+	EntityID string      `json:"entityId"`
+	Time     int64       `json:"time"`
+	Data     interface{} `json:"data"`
+}
+
+// Stats is the data of bot.stats_updated.
+type Stats struct {
+	ServerCount int `json:"serverCount"`
+	ShardCount  int `json:"shardCount"`
+}
+
+// entity is the kind of entity an event type is about, e.g. bot.
+func entity(eventType string) string {
+	kind, _, _ := strings.Cut(eventType, ".")
+	return kind
+}
+
+// newID orders events by when they were published, with a random suffix to keep ids from different replicas apart.
+func newID(now time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%d-%s", now.UnixMilli(), hex.EncodeToString(b))
+}
+
+// Publish sends an event to the subscribers of every replica, including this one.
+func Publish(ctx context.Context, client *redis.Client, eventType, entityID string, data interface{}) error {
+	now := time.Now()
+	payload, err := json.Marshal(Event{ID: newID(now), Type: eventType, EntityID: entityID, Time: now.UnixMilli(), Data: data})
+	if err != nil {
+		return err
+	}
+	if err = client.Publish(ctx, Channel, payload).Err(); err != nil {
+		return err
+	}
+	metrics.EventsPublished.WithLabelValues(eventType).Inc()
+	return nil
+}
+
+// Listen hands the events published by any replica to this one's subscribers until ctx is cancelled. Events
+// published while the subscription is re-established are lost, subscribers aren't told.
+func Listen(ctx context.Context, client *redis.Client) {
+	sub := client.Subscribe(ctx, Channel)
+	defer sub.Close()
+	messages := sub.ChannelWithSubscriptions(ctx, 100)
+	subscribed := false
+	log.WithField("channel", Channel).Info("Listening for events")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if subscribed {
+					log.WithField("channel", Channel).Warn("Resubscribed, events may have been missed")
+				}
+				subscribed = true
+			case *redis.Message:
+				var event Event
+				if err := json.Unmarshal([]byte(m.Payload), &event); err != nil {
+					log.WithField("channel", Channel).Warnf("Ignoring malformed event: %v", err)
+					continue
+				}
+				broadcast(event)
+			}
+		}
+	}
+}
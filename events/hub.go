@@ -0,0 +1,110 @@
+package events
+
+import (
+	"github.com/discordextremelist/api/metrics"
+	"strings"
+	"sync"
+)
+
+// Filter selects the events a subscriber gets, empty sets match everything.
+type Filter struct {
+	// Types holds event types, e.g. bot.approved, or entities to get all of their events, e.g. bot.
+	Types map[string]bool
+	IDs   map[string]bool
+}
+
+// ParseFilter reads comma separated lists of types and entity ids, it returns the types which don't exist.
+func ParseFilter(types, ids string) (Filter, []string) {
+	filter := Filter{Types: map[string]bool{}, IDs: map[string]bool{}}
+	var unknown []string
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		known := false
+		for _, eventType := range Types {
+			known = known || t == eventType || t == entity(eventType)
+		}
+		if !known {
+			unknown = append(unknown, t)
+		}
+		filter.Types[t] = true
+	}
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			filter.IDs[id] = true
+		}
+	}
+	return filter, unknown
+}
+
+func (f Filter) Matches(event Event) bool {
+	if len(f.Types) > 0 && !f.Types[event.Type] && !f.Types[entity(event.Type)] {
+		return false
+	}
+	return len(f.IDs) == 0 || f.IDs[event.EntityID]
+}
+
+// Subscription receives the events matching its filter until it is closed. Events is closed when the subscriber
+// fell more than its buffer behind, or on shutdown.
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+	filter Filter
+}
+
+var (
+	subscribersMutex = &sync.Mutex{}
+	subscribers      = map[*Subscription]bool{}
+)
+
+func Subscribe(filter Filter, buffer int) *Subscription {
+	events := make(chan Event, buffer)
+	sub := &Subscription{Events: events, events: events, filter: filter}
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	subscribers[sub] = true
+	metrics.EventSubscribers.Inc()
+	return sub
+}
+
+// drop has to be called with subscribersMutex held.
+func (s *Subscription) drop() {
+	if subscribers[s] {
+		delete(subscribers, s)
+		close(s.events)
+		metrics.EventSubscribers.Dec()
+	}
+}
+
+func (s *Subscription) Close() {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	s.drop()
+}
+
+// broadcast never blocks on a slow subscriber, it is dropped instead so it reconnects rather than lagging forever.
+func broadcast(event Event) {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	for sub := range subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.drop()
+			metrics.EventSubscribersDropped.Inc()
+		}
+	}
+}
+
+// CloseAll ends every subscription, so streams don't hold up a shutdown.
+func CloseAll() {
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	for sub := range subscribers {
+		sub.drop()
+	}
+}
@@ -0,0 +1,173 @@
+package events
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+const (
+	// resumeKey holds the resume token of the last change published, shared by every replica.
+	resumeKey = "events_resume_token"
+	// claimPrefix keys mark changes already published, so each change is published once however many replicas watch.
+	claimPrefix = "events_claim:"
+	claimTTL    = 10 * time.Minute
+)
+
+// change is the part of a change stream document events are derived from.
+type change struct {
+	ID            bson.Raw `bson:"_id"`
+	OperationType string   `bson:"operationType"`
+	Namespace     struct {
+		Collection string `bson:"coll"`
+	} `bson:"ns"`
+	DocumentKey struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      bson.Raw `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.Raw `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// pipeline matches every change to the cached collections, they are all invalidated while only some publish events.
+var pipeline = mongo.Pipeline{{{Key: "$match", Value: bson.M{
+	"operationType": bson.M{"$in": bson.A{"insert", "update", "replace", "delete"}},
+	"ns.coll":       bson.M{"$in": bson.A{"bots", "users", "servers", "templates"}},
+}}}}
+
+// updated reports whether an update set the status field called name, either directly or by replacing status.
+func (c change) updated(name string) bool {
+	_, direct := c.UpdateDescription.UpdatedFields.LookupErr("status." + name)
+	_, replaced := c.UpdateDescription.UpdatedFields.LookupErr("status")
+	return direct == nil || replaced == nil
+}
+
+// events derives what to publish from a change. Bot updates only count when the field ended up true, a server's
+// review when it changed either way.
+func (c change) events() (types []string, data interface{}) {
+	if len(c.FullDocument) == 0 || (c.OperationType != "insert" && c.OperationType != "update") {
+		return nil, nil
+	}
+	switch c.Namespace.Collection {
+	case "servers":
+		var server entities.Server
+		if bson.Unmarshal(c.FullDocument, &server) != nil {
+			return nil, nil
+		}
+		if c.OperationType == "insert" {
+			types = append(types, ServerCreated)
+		} else if c.updated("reviewRequired") {
+			types = append(types, ServerReviewUpdated)
+		}
+		return types, entities.CleanupServer(entities.UserRank{}, &server)
+	case "templates":
+		if c.OperationType != "insert" {
+			return nil, nil
+		}
+		var template entities.ServerTemplate
+		if bson.Unmarshal(c.FullDocument, &template) != nil {
+			return nil, nil
+		}
+		return []string{TemplateCreated}, &template
+	case "bots":
+		if c.OperationType != "update" {
+			return nil, nil
+		}
+		var bot entities.Bot
+		if bson.Unmarshal(c.FullDocument, &bot) != nil {
+			return nil, nil
+		}
+		if c.updated("approved") && bot.Status.Approved {
+			types = append(types, BotApproved)
+		}
+		if c.updated("archived") && bot.Status.Archived {
+			types = append(types, BotArchived)
+		}
+		return types, entities.CleanupBot(entities.UserRank{}, &bot)
+	}
+	return nil, nil
+}
+
+// claim is true for the first replica to see a change.
+func claim(ctx context.Context, id bson.Raw) bool {
+	sum := sha256.Sum256(id)
+	claimed, err := util.Database.Redis.SetNX(ctx, claimPrefix+hex.EncodeToString(sum[:]), util.Pod, claimTTL).Result()
+	if err != nil {
+		util.CaptureException(ctx, err)
+		return false
+	}
+	return claimed
+}
+
+func watch(ctx context.Context) error {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	token, err := util.Database.Redis.Get(ctx, resumeKey).Bytes()
+	if err == nil {
+		opts.SetResumeAfter(bson.Raw(token))
+	} else if err != redis.Nil {
+		return err
+	}
+	stream, err := util.Database.Mongo.Watch(ctx, pipeline, opts)
+	if err != nil {
+		if token != nil {
+			// The token may have fallen out of the oplog, start from now next time.
+			util.Database.Redis.Del(ctx, resumeKey)
+		}
+		return err
+	}
+	defer stream.Close(context.Background())
+	log.WithField("type", "MongoDB").Info("Watching for changes to publish as events")
+	for stream.Next(ctx) {
+		var c change
+		if err := stream.Decode(&c); err != nil {
+			util.CaptureException(ctx, err)
+			continue
+		}
+		if claim(ctx, c.ID) {
+			// Writes made by the website bypass the API, this is how the caches and list tags learn of them.
+			if err := cache.Publish(ctx, util.Database.Redis, c.Namespace.Collection, c.DocumentKey.ID); err != nil {
+				util.CaptureException(ctx, err)
+			}
+			if util.Config.Features.PublishEvents() {
+				types, data := c.events()
+				for _, eventType := range types {
+					if err := Publish(ctx, util.Database.Redis, eventType, c.DocumentKey.ID, data); err != nil {
+						util.CaptureException(ctx, err)
+					}
+				}
+			}
+		}
+		util.Database.Redis.Set(ctx, resumeKey, []byte(stream.ResumeToken()), 0)
+	}
+	return stream.Err()
+}
+
+// Watch invalidates the caches of every change to MongoDB and publishes the events derived from them until ctx is
+// cancelled, which needs a replica set. Every replica watches and resumes after the last change any of them saw, each
+// change is handled once.
+func Watch(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.WithField("type", "MongoDB").Warnf("Change stream failed, retrying in %s: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestChangeEvents(t *testing.T) {
+	document := func(v interface{}) bson.Raw {
+		raw, err := bson.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	bot := document(bson.M{"_id": "1", "status": bson.M{"approved": true}})
+	updatedApproved := document(bson.M{"status.approved": true})
+	tests := []struct {
+		name       string
+		collection string
+		operation  string
+		full       bson.Raw
+		updated    bson.Raw
+		want       []string
+	}{
+		{"template inserted", "templates", "insert", document(bson.M{"_id": "1"}), nil, []string{TemplateCreated}},
+		{"template replaced", "templates", "replace", document(bson.M{"_id": "1"}), nil, nil},
+		{"bot approved", "bots", "update", bot, updatedApproved, []string{BotApproved}},
+		{"bot inserted approved", "bots", "insert", bot, nil, nil},
+		{"bot replaced", "bots", "replace", bot, nil, nil},
+		{"server deleted", "servers", "delete", nil, nil, nil},
+		{"user updated", "users", "update", document(bson.M{"_id": "1"}), updatedApproved, nil},
+	}
+	for _, test := range tests {
+		var c change
+		c.Namespace.Collection, c.OperationType, c.FullDocument = test.collection, test.operation, test.full
+		c.UpdateDescription.UpdatedFields = test.updated
+		types, _ := c.events()
+		if len(types) != len(test.want) || (len(types) > 0 && types[0] != test.want[0]) {
+			t.Errorf("%s: events() = %v, want %v", test.name, types, test.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package graph
+
+import (
+	"github.com/discordextremelist/api/util"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// editorsEstimate is what Bot.editors is assumed to return, bots rarely have more.
+const editorsEstimate = 5
+
+// entityTypes cost 1 for every one resolved, everything else is free.
+var entityTypes = map[string]bool{"Bot": true, "User": true, "Server": true, "ServerTemplate": true}
+
+// Cost is the estimate of a query, Entities is the number of entities it resolves at most and Depth how deeply its
+// fields are nested.
+type Cost struct {
+	Entities int `json:"entities"`
+	Depth    int `json:"depth"`
+}
+
+type walker struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	// scans counts the User.bots fields, each scans the bots once for every owner at its level.
+	scans *int
+}
+
+// Estimate returns the cost of the operation of a validated document, lists are counted at the length of their ids
+// or first argument and every User.bots adds the cost of its scan. Introspection is free.
+func Estimate(doc *ast.Document, operationName string, variables map[string]interface{}) Cost {
+	w := walker{fragments: map[string]*ast.FragmentDefinition{}, variables: variables, scans: new(int)}
+	var operation *ast.OperationDefinition
+	for _, definition := range doc.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			w.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operationName == "" || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil {
+		return Cost{}
+	}
+	entities, depth := w.selections(operation.SelectionSet, Schema.QueryType(), 0)
+	entities = saturatingAdd(entities, saturatingMul(*w.scans, util.Config.GraphQL.ScanCost))
+	return Cost{Entities: entities, Depth: depth}
+}
+
+func (w walker) selections(set *ast.SelectionSet, parent *graphql.Object, depth int) (int, int) {
+	cost, deepest := 0, depth
+	if set == nil {
+		return cost, deepest
+	}
+	for _, selection := range set.Selections {
+		var c, d int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			c, d = w.field(selection, parent, depth+1)
+		case *ast.InlineFragment:
+			c, d = w.selections(selection.SelectionSet, parent, depth)
+		case *ast.FragmentSpread:
+			if fragment, ok := w.fragments[selection.Name.Value]; ok {
+				c, d = w.selections(fragment.SelectionSet, parent, depth)
+			}
+		}
+		cost = saturatingAdd(cost, c)
+		if d > deepest {
+			deepest = d
+		}
+	}
+	return cost, deepest
+}
+
+func (w walker) field(field *ast.Field, parent *graphql.Object, depth int) (int, int) {
+	definition, ok := parent.Fields()[field.Name.Value]
+	if !ok {
+		return 0, depth
+	}
+	output := definition.Type
+	for {
+		switch wrapped := output.(type) {
+		case *graphql.NonNull:
+			output = wrapped.OfType
+			continue
+		case *graphql.List:
+			output = wrapped.OfType
+			continue
+		}
+		break
+	}
+	object, ok := output.(*graphql.Object)
+	if !ok {
+		return 0, depth
+	}
+	cost, deepest := w.selections(field.SelectionSet, object, depth)
+	if entityTypes[object.Name()] {
+		cost = saturatingAdd(cost, 1)
+	}
+	return saturatingMul(w.count(parent.Name()+"."+field.Name.Value, field.Arguments), cost), deepest
+}
+
+// count is how many items the field returns at most, lists are never longer than a batch as the resolvers reject
+// longer ones.
+func (w walker) count(field string, arguments []*ast.Argument) int {
+	switch field {
+	case "Bot.editors":
+		return editorsEstimate
+	case "User.bots":
+		*w.scans++
+		if n, ok := w.argument(arguments, "first"); ok {
+			return min(max(n, 0), util.Config.MaxBatchSize)
+		}
+		return defaultFirst
+	case "Query.bots", "Query.users", "Query.servers", "Query.templates":
+		n, _ := w.argument(arguments, "ids")
+		return min(max(n, 0), util.Config.MaxBatchSize)
+	}
+	return 1
+}
+
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// saturatingMul multiplies counts, which are never negative.
+func saturatingMul(a, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+	return a * b
+}
+
+// argument returns the value of an int argument, or the length of a list one.
+func (w walker) argument(arguments []*ast.Argument, name string) (int, bool) {
+	for _, argument := range arguments {
+		if argument.Name.Value != name {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			n, err := strconv.Atoi(value.Value)
+			return n, err == nil
+		case *ast.ListValue:
+			return len(value.Values), true
+		case *ast.Variable:
+			// Variables are decoded from JSON, MessagePack or CBOR, numbers can be of any size.
+			variable := reflect.ValueOf(w.variables[value.Name.Value])
+			switch {
+			case variable.CanInt():
+				return int(variable.Int()), true
+			case variable.CanUint():
+				return int(min(variable.Uint(), math.MaxInt)), true
+			case variable.CanFloat():
+				// Converting floats out of range is undefined, so they're clamped first. NaN is no count at all.
+				f := variable.Float()
+				if math.IsNaN(f) {
+					return 0, true
+				}
+				return int(math.Max(math.Min(f, math.MaxInt32), math.MinInt32)), true
+			case variable.Kind() == reflect.Slice:
+				return variable.Len(), true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"github.com/discordextremelist/api/config"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/util"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"math"
+	"testing"
+)
+
+func estimate(t *testing.T, query string, variables map[string]interface{}) Cost {
+	t.Helper()
+	util.Config = config.Defaults()
+	if err := NewSchema(); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Estimate(doc, "", variables)
+}
+
+func TestEstimateClampsCounts(t *testing.T) {
+	batch := config.Defaults().MaxBatchSize
+	scan := config.Defaults().GraphQL.ScanCost
+	for name, first := range map[string]interface{}{"int": int64(math.MaxInt64), "uint": uint64(math.MaxUint64), "float": 1e300} {
+		cost := estimate(t, `query($first: Int) { user(id: "1") { bots(first: $first) { id } } }`,
+			map[string]interface{}{"first": first})
+		if want := 1 + batch + scan; cost.Entities != want {
+			t.Errorf("%s: Entities = %d, want %d", name, cost.Entities, want)
+		}
+	}
+}
+
+func TestEstimateSaturates(t *testing.T) {
+	// Every level multiplies the count by a batch, which overflows well before the depth limit could stop it.
+	query := "id"
+	for i := 0; i < 12; i++ {
+		query = "bots(first: $first) { owner { " + query + " } }"
+	}
+	cost := estimate(t, `query($first: Int) { user(id: "1") { `+query+` } }`, map[string]interface{}{"first": 1e9})
+	if cost.Entities != math.MaxInt {
+		t.Fatalf("Entities = %d, want it saturated at %d", cost.Entities, math.MaxInt)
+	}
+}
+
+func TestEstimateChargesScans(t *testing.T) {
+	cost := estimate(t, `{ users(ids: ["1", "2", "3"]) { bots(first: 0) { id } } }`, nil)
+	if want := 3 + config.Defaults().GraphQL.ScanCost; cost.Entities != want {
+		t.Fatalf("Entities = %d, want %d, the owners share one scan", cost.Entities, want)
+	}
+}
+
+func TestFirstAboveBatchIsRejected(t *testing.T) {
+	util.Config = config.Defaults()
+	if err := NewSchema(); err != nil {
+		t.Fatal(err)
+	}
+	bots := Schema.Type("User").(*graphql.Object).Fields()["bots"]
+	_, err := bots.Resolve(graphql.ResolveParams{
+		Source: &entities.User{ID: "1"},
+		Args:   map[string]interface{}{"first": util.Config.MaxBatchSize + 1},
+	})
+	if err == nil {
+		t.Fatal("first above the maximum batch size was accepted")
+	}
+}
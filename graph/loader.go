@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"context"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/util"
+	"sort"
+)
+
+// defaultFirst is how many bots User.bots returns when first isn't given.
+const defaultFirst = 10
+
+// loader batches the lookups of one request. Resolvers queue ids and return thunks, the executor calls the thunks
+// of a level of the query after every resolver of that level ran, so the first thunk fetches all queued ids at once.
+type loader[T any] struct {
+	ctx     context.Context
+	fetch   func(ctx context.Context, ids []string) (error, map[string]*T)
+	pending []string
+	queued  map[string]bool
+	// done holds nil for ids which don't exist.
+	done   map[string]*T
+	failed map[string]bool
+}
+
+func newLoader[T any](ctx context.Context, fetch func(ctx context.Context, ids []string) (error, map[string]*T)) *loader[T] {
+	return &loader[T]{ctx: ctx, fetch: fetch, queued: map[string]bool{}, done: map[string]*T{}, failed: map[string]bool{}}
+}
+
+func (l *loader[T]) queue(id string) {
+	if !l.queued[id] {
+		l.queued[id] = true
+		l.pending = append(l.pending, id)
+	}
+}
+
+func (l *loader[T]) get(id string) (*T, error) {
+	if len(l.pending) > 0 {
+		ids := l.pending
+		l.pending = nil
+		err, found := l.fetch(l.ctx, ids)
+		if err != nil {
+			util.CaptureException(l.ctx, err)
+		}
+		for _, id := range ids {
+			if err != nil {
+				l.failed[id] = true
+			} else {
+				l.done[id] = found[id]
+			}
+		}
+	}
+	if l.failed[id] {
+		return nil, entities.LookupError
+	}
+	return l.done[id], nil
+}
+
+// load resolves to the entity with id, or null when it doesn't exist.
+func (l *loader[T]) load(id string) func() (interface{}, error) {
+	l.queue(id)
+	return func() (interface{}, error) {
+		entity, err := l.get(id)
+		if entity == nil {
+			return nil, err
+		}
+		return entity, nil
+	}
+}
+
+// loadMany resolves to the entities with ids which exist.
+func (l *loader[T]) loadMany(ids []string) func() (interface{}, error) {
+	for _, id := range ids {
+		l.queue(id)
+	}
+	return func() (interface{}, error) {
+		found := make([]*T, 0, len(ids))
+		for _, id := range ids {
+			entity, err := l.get(id)
+			if err != nil {
+				return nil, err
+			}
+			if entity != nil {
+				found = append(found, entity)
+			}
+		}
+		return found, nil
+	}
+}
+
+// ownedLoader finds the bots of every queued owner with a single scan of the bots hash.
+type ownedLoader struct {
+	ctx     context.Context
+	pending map[string]bool
+	done    map[string][]*entities.Bot
+	failed  map[string]bool
+}
+
+func (l *ownedLoader) load(owner string, first int) func() (interface{}, error) {
+	if _, ok := l.done[owner]; !ok && !l.failed[owner] {
+		l.pending[owner] = true
+	}
+	return func() (interface{}, error) {
+		if len(l.pending) > 0 {
+			pending := l.pending
+			l.pending = map[string]bool{}
+			for id := range pending {
+				l.done[id] = []*entities.Bot{}
+			}
+			err := entities.EachBot(l.ctx, true, func(bot *entities.Bot) error {
+				if pending[bot.Owner.ID] {
+					l.done[bot.Owner.ID] = append(l.done[bot.Owner.ID], bot)
+				}
+				return nil
+			})
+			for id := range pending {
+				if err != nil {
+					delete(l.done, id)
+					l.failed[id] = true
+					continue
+				}
+				bots := l.done[id]
+				sort.Slice(bots, func(i, j int) bool { return bots[i].ID < bots[j].ID })
+			}
+			if err != nil {
+				util.CaptureException(l.ctx, err)
+			}
+		}
+		if l.failed[owner] {
+			return nil, entities.LookupError
+		}
+		bots := l.done[owner]
+		if first < len(bots) {
+			bots = bots[:first]
+		}
+		return bots, nil
+	}
+}
+
+// loaders are per request, so entities are looked up once per query and never outlive it.
+type loaders struct {
+	bots      *loader[entities.Bot]
+	users     *loader[entities.User]
+	servers   *loader[entities.Server]
+	templates *loader[entities.ServerTemplate]
+	ownedBots *ownedLoader
+}
+
+type loadersKey struct{}
+
+// WithLoaders returns a context to execute one query with, entities are redacted like they are on the REST routes.
+func WithLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		bots: newLoader(ctx, func(ctx context.Context, ids []string) (error, map[string]*entities.Bot) {
+			return entities.LookupBots(ctx, ids, true)
+		}),
+		users: newLoader(ctx, func(ctx context.Context, ids []string) (error, map[string]*entities.User) {
+			return entities.LookupUsers(ctx, ids, true)
+		}),
+		servers: newLoader(ctx, func(ctx context.Context, ids []string) (error, map[string]*entities.Server) {
+			return entities.LookupServers(ctx, ids, true)
+		}),
+		templates: newLoader(ctx, entities.LookupTemplates),
+		ownedBots: &ownedLoader{ctx: ctx, pending: map[string]bool{}, done: map[string][]*entities.Bot{}, failed: map[string]bool{}},
+	})
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
@@ -0,0 +1,242 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/util"
+	"github.com/graphql-go/graphql"
+	"reflect"
+	"strings"
+)
+
+// types generates graphql object types from go structs, fields are named by their json names and keep their
+// nullability: pointers and omitempty fields are nullable, omitempty fields resolving to null when they're zero
+// just like they are left out of the json.
+type types struct {
+	objects map[reflect.Type]*graphql.Object
+	// relations replace or add fields of the entity types, e.g. the owner of a bot is resolved to the user.
+	relations map[reflect.Type]graphql.Fields
+}
+
+func (t *types) of(goType reflect.Type, name string) graphql.Output {
+	switch goType.Kind() {
+	case reflect.Ptr:
+		return t.of(goType.Elem(), name)
+	case reflect.String:
+		return graphql.String
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return graphql.Int
+	case reflect.Float32, reflect.Float64:
+		return graphql.Float
+	case reflect.Slice, reflect.Array:
+		element := t.of(goType.Elem(), name)
+		if element == nil {
+			return nil
+		}
+		if goType.Elem().Kind() != reflect.Ptr {
+			element = graphql.NewNonNull(element)
+		}
+		return graphql.NewList(element)
+	case reflect.Struct:
+		return t.object(goType, name)
+	}
+	return nil
+}
+
+// object returns the type of a struct, anonymous structs are named after the field they're declared in.
+func (t *types) object(goType reflect.Type, name string) *graphql.Object {
+	if object, ok := t.objects[goType]; ok {
+		return object
+	}
+	if goType.Name() != "" {
+		name = goType.Name()
+	}
+	object := graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			fields := graphql.Fields{}
+			for i := 0; i < goType.NumField(); i++ {
+				field := goType.Field(i)
+				tag, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+				if !field.IsExported() || tag == "-" || tag == "_id" {
+					continue
+				}
+				if tag == "" {
+					tag = field.Name
+				}
+				output := t.of(field.Type, name+field.Name)
+				if output == nil {
+					continue
+				}
+				omitEmpty := strings.Contains(options, "omitempty")
+				if tag == "id" && field.Type.Kind() == reflect.String {
+					output = graphql.ID
+				}
+				if field.Type.Kind() != reflect.Ptr && field.Type.Kind() != reflect.Slice && !omitEmpty {
+					output = graphql.NewNonNull(output)
+				}
+				fields[tag] = &graphql.Field{Type: output, Resolve: resolveField(i, omitEmpty)}
+			}
+			for tag, field := range t.relations[goType] {
+				fields[tag] = field
+			}
+			return fields
+		}),
+	})
+	t.objects[goType] = object
+	return object
+}
+
+func resolveField(index int, omitEmpty bool) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		value := reflect.Indirect(reflect.ValueOf(p.Source)).Field(index)
+		if omitEmpty && value.IsZero() {
+			return nil, nil
+		}
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return nil, nil
+			}
+			value = value.Elem()
+		}
+		return value.Interface(), nil
+	}
+}
+
+var (
+	botType      = reflect.TypeOf(entities.Bot{})
+	userType     = reflect.TypeOf(entities.User{})
+	serverType   = reflect.TypeOf(entities.Server{})
+	templateType = reflect.TypeOf(entities.ServerTemplate{})
+)
+
+// Schema is generated from the entity types by NewSchema.
+var Schema graphql.Schema
+
+// NewSchema generates the schema: a query type looking entities up by id, and the entity types with their owner,
+// editors and fromGuild ids resolved to the users and servers they refer to.
+func NewSchema() error {
+	t := &types{objects: map[reflect.Type]*graphql.Object{}}
+	user := t.object(userType, "")
+	bot := t.object(botType, "")
+	server := t.object(serverType, "")
+	template := t.object(templateType, "")
+	owner := &graphql.Field{
+		Type:        user,
+		Description: "The owner, null when they aren't on the list anymore.",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return loadersFrom(p.Context).users.load(ownerOf(p.Source)), nil
+		},
+	}
+	t.relations = map[reflect.Type]graphql.Fields{
+		botType: {
+			"owner": owner,
+			"editors": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(user))),
+				Description: "The editors who are still on the list.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFrom(p.Context).users.loadMany(p.Source.(*entities.Bot).Editors), nil
+				},
+			},
+		},
+		serverType: {"owner": owner},
+		templateType: {
+			"owner": owner,
+			"fromGuild": &graphql.Field{
+				Type:        server,
+				Description: "The server the template was made from, null when it isn't listed.",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersFrom(p.Context).servers.load(p.Source.(*entities.ServerTemplate).FromGuild), nil
+				},
+			},
+		},
+		userType: {
+			"bots": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bot))),
+				Description: "The bots the user owns, ordered by id.",
+				Args: graphql.FieldConfigArgument{
+					"first": {Type: graphql.Int, DefaultValue: defaultFirst, Description: "How many bots to return at most, up to the maximum batch size."},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					first, _ := p.Args["first"].(int)
+					if first < 0 {
+						return nil, errors.New("first must not be negative")
+					}
+					if first > util.Config.MaxBatchSize {
+						return nil, fmt.Errorf("first must be at most %d", util.Config.MaxBatchSize)
+					}
+					return loadersFrom(p.Context).ownedBots.load(p.Source.(*entities.User).ID, first), nil
+				},
+			},
+		},
+	}
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"bot":       byID(bot, func(l *loaders) *loader[entities.Bot] { return l.bots }),
+			"bots":      byIDs(bot, func(l *loaders) *loader[entities.Bot] { return l.bots }),
+			"user":      byID(user, func(l *loaders) *loader[entities.User] { return l.users }),
+			"users":     byIDs(user, func(l *loaders) *loader[entities.User] { return l.users }),
+			"server":    byID(server, func(l *loaders) *loader[entities.Server] { return l.servers }),
+			"servers":   byIDs(server, func(l *loaders) *loader[entities.Server] { return l.servers }),
+			"template":  byID(template, func(l *loaders) *loader[entities.ServerTemplate] { return l.templates }),
+			"templates": byIDs(template, func(l *loaders) *loader[entities.ServerTemplate] { return l.templates }),
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		return err
+	}
+	Schema = schema
+	return nil
+}
+
+func ownerOf(source interface{}) string {
+	switch entity := source.(type) {
+	case *entities.Bot:
+		return entity.Owner.ID
+	case *entities.Server:
+		return entity.Owner.ID
+	case *entities.ServerTemplate:
+		return entity.Owner.ID
+	}
+	return ""
+}
+
+func byID[T any](object *graphql.Object, of func(l *loaders) *loader[T]) *graphql.Field {
+	return &graphql.Field{
+		Type: object,
+		Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return of(loadersFrom(p.Context)).load(p.Args["id"].(string)), nil
+		},
+	}
+}
+
+// byIDs resolves a list with an entry per id, like the batch routes ids which don't exist are null.
+func byIDs[T any](object *graphql.Object, of func(l *loaders) *loader[T]) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(object)),
+		Args: graphql.FieldConfigArgument{"ids": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID)))}},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			raw := p.Args["ids"].([]interface{})
+			if len(raw) > util.Config.MaxBatchSize {
+				return nil, fmt.Errorf("at most %d ids can be looked up at once", util.Config.MaxBatchSize)
+			}
+			ids := make([]string, len(raw))
+			for i, id := range raw {
+				ids[i] = id.(string)
+			}
+			l := of(loadersFrom(p.Context))
+			results := make([]interface{}, len(ids))
+			for i, id := range ids {
+				results[i] = l.load(id)
+			}
+			return results, nil
+		},
+	}
+}
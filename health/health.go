@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check is a single named health check, it passes when Run returns nil.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Probe runs its checks concurrently and reports them like the kubernetes /livez, /readyz and /healthz endpoints.
+type Probe struct {
+	name    string
+	timeout time.Duration
+	checks  []Check
+	// latch makes the probe pass forever once it has passed, used for startup probes.
+	latch  bool
+	passed atomic.Bool
+}
+
+type result struct {
+	name string
+	err  error
+}
+
+func NewProbe(name string, timeout time.Duration, checks ...Check) *Probe {
+	return &Probe{name: name, timeout: timeout, checks: checks}
+}
+
+// Latched returns a probe which, once every check passed, keeps passing without running them again.
+func Latched(name string, timeout time.Duration, checks ...Check) *Probe {
+	probe := NewProbe(name, timeout, checks...)
+	probe.latch = true
+	return probe
+}
+
+func (p *Probe) run(ctx context.Context, exclude map[string]bool) []result {
+	results := make([]result, len(p.checks))
+	wg := sync.WaitGroup{}
+	for i, check := range p.checks {
+		results[i].name = check.Name
+		if exclude[check.Name] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, p.timeout)
+			defer cancel()
+			results[i].err = check.Run(checkCtx)
+		}(i, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// ServeHTTP supports ?verbose to list every check and ?exclude=<name> (repeatable) to skip checks.
+func (p *Probe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	_, verbose := query["verbose"]
+	exclude := map[string]bool{}
+	for _, name := range query["exclude"] {
+		exclude[name] = true
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-store")
+	if p.latch && p.passed.Load() {
+		w.WriteHeader(http.StatusOK)
+		if verbose {
+			fmt.Fprintf(w, "[+]%s ok\n%s check passed\n", p.name, p.name)
+		} else {
+			fmt.Fprint(w, "ok")
+		}
+		return
+	}
+	results := p.run(r.Context(), exclude)
+	failed, skipped := false, false
+	for _, res := range results {
+		if res.err != nil {
+			failed = true
+		}
+		if exclude[res.name] {
+			skipped = true
+		}
+	}
+	if !failed {
+		// Excluded checks only pass for the caller which excluded them, latching needs every check to have passed.
+		if !skipped {
+			p.passed.Store(true)
+		}
+		if !verbose {
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "ok")
+			return
+		}
+	}
+	out := strings.Builder{}
+	for _, res := range results {
+		switch {
+		case exclude[res.name]:
+			fmt.Fprintf(&out, "[+]%s excluded: ok\n", res.name)
+		case res.err != nil && verbose:
+			fmt.Fprintf(&out, "[-]%s failed: %v\n", res.name, res.err)
+		case res.err != nil:
+			// like kubernetes, the reason is only shown to callers asking for it
+			fmt.Fprintf(&out, "[-]%s failed: reason withheld\n", res.name)
+		default:
+			fmt.Fprintf(&out, "[+]%s ok\n", res.name)
+		}
+	}
+	if failed {
+		fmt.Fprintf(&out, "%s check failed\n", p.name)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		fmt.Fprintf(&out, "%s check passed\n", p.name)
+		w.WriteHeader(http.StatusOK)
+	}
+	fmt.Fprint(w, out.String())
+}
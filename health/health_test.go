@@ -0,0 +1,39 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExcludeDoesNotLatch(t *testing.T) {
+	up := false
+	probe := Latched("startup", time.Second, Check{Name: "redis", Run: func(context.Context) error {
+		if !up {
+			return errors.New("not up yet")
+		}
+		return nil
+	}})
+	status := func(target string) int {
+		w := httptest.NewRecorder()
+		probe.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Code
+	}
+	if code := status("/startupz?exclude=redis"); code != http.StatusOK {
+		t.Fatalf("excluding the failing check answered %d, want 200", code)
+	}
+	if code := status("/startupz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("after an excluded pass the probe answered %d, want 503 as redis is still down", code)
+	}
+	up = true
+	if code := status("/startupz"); code != http.StatusOK {
+		t.Fatalf("with every check passing the probe answered %d, want 200", code)
+	}
+	up = false
+	if code := status("/startupz"); code != http.StatusOK {
+		t.Fatalf("the latched probe answered %d, want 200", code)
+	}
+}
@@ -1,70 +1,159 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/config"
 	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/events"
 	"github.com/discordextremelist/api/routes"
+	"github.com/discordextremelist/api/tracing"
 	"github.com/discordextremelist/api/util"
+	"github.com/discordextremelist/api/webhooks"
 	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi"
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
-var (
-	check = []string{"ADDR", "PORT", "REDIS_PASSWORD", "REDIS_DB", "MONGO_URL", "MONGO_DB"}
-)
-
 func init() {
-	for _, v := range os.Args {
-		if v == "--dev" {
-			util.Dev = true
-		}
-	}
-	log.SetLevel(log.DebugLevel)
 	log.SetFormatter(&log.TextFormatter{ForceColors: true, FullTimestamp: true})
 	_ = godotenv.Load()
-	for i := 0; i < len(check); i++ {
-		if _, ok := os.LookupEnv(check[i]); !ok {
-			log.Fatalf("Required environmental variable '%s' doesn't exist!", check[i])
-		}
+	err, cfg := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	level, _ := log.ParseLevel(cfg.LogLevel)
+	log.SetLevel(level)
+	if cfg.Logging.Format == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	util.Config = cfg
+	util.Dev = cfg.Dev
+	for name, opts := range cfg.Cache {
+		cache.Configure(name, opts.Capacity, opts.TTL.Duration)
 	}
 }
 
 func main() {
-	util.InitSentry()
-	defer sentry.Flush(2 * time.Second)
-	if !util.Dev {
-		util.BuildClient()
-		err := util.FindKubernetesNode()
+	util.InitSentry(util.Config.Sentry)
+	if args := util.Config.Args; len(args) > 0 && args[0] == "cache" {
+		code := runCacheCommand(args[1:])
+		sentry.Flush(2 * time.Second)
+		os.Exit(code)
+	}
+	if !util.Dev && util.Config.Features.Kubernetes {
+		err := util.FindKubernetesNode(util.Config.Kubernetes)
 		if err != nil {
 			log.Errorf("Failed to get the node this pod is on: %v", err)
 		} else {
-			log.Infof("Currently on node: %s", util.Node)
+			log.Infof("Currently on node: %s (pod %s, zone %s, region %s)", util.Node, util.Pod, util.Zone, util.Region)
 		}
 	}
-	util.Database.OpenRedisConnection()
-	util.Database.OpenMongoConnection()
+	shutdownTracing, err := tracing.Init(context.Background(), util.Config.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialise tracing: %v", err)
+	}
+	util.Database.OpenRedisConnection(util.Config.Redis)
+	util.Database.OpenMongoConnection(util.Config.Mongo)
+	if util.Config.Features.CacheInvalidation {
+		util.Go(func(ctx context.Context) {
+			cache.Listen(ctx, util.Database.Redis)
+		})
+	}
+	if util.Config.Features.PublishEvents() {
+		util.Go(func(ctx context.Context) {
+			events.Listen(ctx, util.Database.Redis)
+		})
+	}
+	if util.Config.Features.ChangeStreams {
+		util.Go(events.Watch)
+	}
+	if util.Config.Features.Webhooks {
+		util.Go(webhooks.Dispatch)
+		util.Go(webhooks.Deliver)
+	}
 	if util.Dev {
 		entities.PopulateDevCache()
 	}
 	util.Router = chi.NewRouter()
 	util.Router.Use(util.RealIP)
+	util.Router.Use(util.RequestID)
+	if util.Config.Features.ReplicaHeaders {
+		util.Router.Use(util.Replica)
+	}
+	util.Router.Use(tracing.Middleware)
 	util.Router.Use(entities.RequestLogger)
+	util.Router.Use(entities.Sentry)
+	if util.Config.Features.Compression {
+		util.Router.Use(util.Compress)
+	}
 	util.Router.NotFound(entities.NotFound)
-	util.Router.Use(entities.TokenValidator)
-	routes.InitGeneralRoutes()
-	routes.InitBotRoutes()
-	routes.InitUserRoutes()
-	routes.InitServerRoutes()
-	routes.InitTemplateRoutes()
+	routes.InitProbeRoutes()
 	routes.InitDebugRoutes()
-	ip := os.Getenv("ADDR")
-	port := os.Getenv("PORT")
-	serve := fmt.Sprintf("%s:%s", ip, port)
-	log.Infof("Starting to serve at: %s", serve)
-	log.Fatal(http.ListenAndServe(serve, util.Router))
+	routes.InitErrorRoutes()
+	if util.Config.Features.Metrics {
+		routes.InitMetricsRoutes()
+	}
+	routes.InitAPIRoutes()
+	if err := routes.InitOpenAPIRoutes(); err != nil {
+		if util.Dev {
+			log.Fatalf("Failed to document the API: %v", err)
+		}
+		sentry.CaptureException(err)
+		log.Errorf("Failed to document the API: %v", err)
+	}
+	serve := fmt.Sprintf("%s:%d", util.Config.Addr, util.Config.Port)
+	timeouts := util.Config.Timeouts
+	server := &http.Server{
+		Addr:              serve,
+		Handler:           util.Router,
+		ReadHeaderTimeout: timeouts.ReadHeader.Duration,
+		ReadTimeout:       timeouts.Read.Duration,
+		WriteTimeout:      timeouts.Write.Duration,
+		IdleTimeout:       timeouts.Idle.Duration,
+	}
+	// Event streams only end when their subscription does, Shutdown would wait for them until it times out.
+	server.RegisterOnShutdown(events.CloseAll)
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	go func() {
+		log.Infof("Starting to serve at: %s", serve)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	<-signals.Done()
+	stopSignals()
+	shutdown(server, shutdownTracing)
+}
+
+func shutdown(server *http.Server, shutdownTracing func(ctx context.Context) error) {
+	shutdownTimeout := util.Config.Timeouts.Shutdown.Duration
+	workerTimeout := util.Config.Timeouts.Workers.Duration
+	log.Infof("Shutting down, draining in-flight requests for up to %s...", shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		sentry.CaptureException(err)
+		log.Errorf("Failed to drain requests: %v", err)
+	}
+	if !util.StopWorkers(workerTimeout) {
+		log.Warnf("Background workers didn't stop within %s", workerTimeout)
+	}
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), workerTimeout)
+	defer cancelClose()
+	util.Database.Close(closeCtx)
+	if err := shutdownTracing(closeCtx); err != nil {
+		log.Errorf("Failed to flush traces: %v", err)
+	}
+	sentry.Flush(2 * time.Second)
+	log.Info("Shutdown complete!")
 }
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"github.com/discordextremelist/api/cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "del_api"
+
+var (
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to serve a request by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	LookupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "lookup_duration_seconds",
+		Help:      "Time taken to find and decode an entity by source and collection.",
+		Buckets:   []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"source", "collection"})
+	RedisLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_lookups_total",
+		Help:      "Entity lookups against the redis cache by collection and result (hit or miss).",
+	}, []string{"collection", "result"})
+	MongoFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongo_fallbacks_total",
+		Help:      "Lookups which fell back to MongoDB by collection and result (found, not_found or error).",
+	}, []string{"collection", "result"})
+	RatelimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ratelimit_rejections_total",
+		Help:      "Requests rejected by a ratelimit bucket by reason (ratelimited, temp_banned or perm_banned).",
+	}, []string{"bucket", "reason"})
+	RatelimitBans = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ratelimit_bans_total",
+		Help:      "Bans issued by a ratelimit bucket by type (temp or perm).",
+	}, []string{"bucket", "type"})
+	EventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_published_total",
+		Help:      "Events published by this replica by type.",
+	}, []string{"type"})
+	EventSubscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_subscribers",
+		Help:      "Clients currently streaming /events from this replica.",
+	})
+	EventSubscribersDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "event_subscribers_dropped_total",
+		Help:      "Subscribers disconnected for falling too far behind.",
+	})
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by outcome (delivered, retrying or dead).",
+	}, []string{"outcome"})
+	memoryCacheDesc = map[string]*prometheus.Desc{
+		"hits":      prometheus.NewDesc(namespace+"_memory_cache_hits_total", "In-process cache hits.", []string{"cache"}, nil),
+		"misses":    prometheus.NewDesc(namespace+"_memory_cache_misses_total", "In-process cache misses.", []string{"cache"}, nil),
+		"evictions": prometheus.NewDesc(namespace+"_memory_cache_evictions_total", "In-process cache evictions.", []string{"cache"}, nil),
+		"coalesced": prometheus.NewDesc(namespace+"_memory_cache_coalesced_total", "Loads shared with a concurrent caller.", []string{"cache"}, nil),
+		"size":      prometheus.NewDesc(namespace+"_memory_cache_entries", "Entries held in the in-process cache.", []string{"cache"}, nil),
+	}
+)
+
+type memoryCacheCollector struct{}
+
+func (memoryCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range memoryCacheDesc {
+		ch <- desc
+	}
+}
+
+func (memoryCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, stats := range cache.AllStats() {
+		ch <- prometheus.MustNewConstMetric(memoryCacheDesc["hits"], prometheus.CounterValue, float64(stats.Hits), name)
+		ch <- prometheus.MustNewConstMetric(memoryCacheDesc["misses"], prometheus.CounterValue, float64(stats.Misses), name)
+		ch <- prometheus.MustNewConstMetric(memoryCacheDesc["evictions"], prometheus.CounterValue, float64(stats.Evictions), name)
+		ch <- prometheus.MustNewConstMetric(memoryCacheDesc["coalesced"], prometheus.CounterValue, float64(stats.Coalesced), name)
+		ch <- prometheus.MustNewConstMetric(memoryCacheDesc["size"], prometheus.GaugeValue, float64(stats.Size), name)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(memoryCacheCollector{})
+}
+
+// RegisterPings exposes the redis and mongo round trip times, both functions should return milliseconds or -1 on failure.
+func RegisterPings(redisPing, mongoPing func() int64) {
+	for name, ping := range map[string]func() int64{"redis": redisPing, "mongo": mongoPing} {
+		ping := ping
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name + "_ping_milliseconds",
+			Help:      "Round trip time of a ping, -1 if it failed.",
+		}, func() float64 {
+			return float64(ping())
+		})
+	}
+}
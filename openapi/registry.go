@@ -0,0 +1,333 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var UndocumentedRoutes = errors.New("routes without an openapi entry")
+
+// Reply documents one response of a route.
+type Reply struct {
+	Description string
+	// Body is a value of the returned type, nil when there is no body.
+	Body interface{}
+	// ContentType defaults to application/json.
+	ContentType string
+	// Error replies send the error body of the route's mount.
+	Error bool
+	// Raw bodies are sent as they are on every mount, e.g. in a protocol's own format.
+	Raw bool
+}
+
+// Route documents an operation, it is registered next to the handler with Add.
+type Route struct {
+	ID          string
+	Summary     string
+	Description string
+	Tags        []string
+	Params      []Parameter
+	// Body is a value of the accepted request body type, nil when none is read.
+	Body    interface{}
+	Replies map[int]Reply
+	// Security lists the names of the security schemes accepted, any of them is enough.
+	Security []string
+	// Ratelimited routes document the ratelimit headers and the 429 and ban responses.
+	Ratelimited bool
+	// Streaming routes are never answered with a 304, e.g. event streams.
+	Streaming bool
+}
+
+var (
+	mutex  sync.Mutex
+	routes = map[string]Route{}
+	hidden = map[string]bool{}
+)
+
+// normalise matches patterns as written in Route blocks with how chi.Walk reports them, "/bots/" is served at "/bots".
+func normalise(pattern string) string {
+	if len(pattern) > 1 {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	return pattern
+}
+
+func key(method, pattern string) string {
+	return strings.ToUpper(method) + " " + normalise(pattern)
+}
+
+func Add(method, pattern string, route Route) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	routes[key(method, pattern)] = route
+}
+
+// Hide marks a route as deliberately left out of the document, e.g. admin only or infrastructure routes.
+func Hide(method, pattern string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	hidden[key(method, pattern)] = true
+}
+
+func PathParam(name, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &Schema{Type: "string"}}
+}
+
+func QueryParam(name, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// Mount documents the routes of a router mounted at a path prefix, they are added without the prefix.
+type Mount struct {
+	// ID prefixes the operation ids, and the shared error responses when Error is set, so they stay unique.
+	ID string
+	// Wrap documents what is sent for a reply with body, by default the body itself.
+	Wrap func(types Schemas, status int, body interface{}) *Schema
+	// Error is a value of the body of this mount's error responses, by default Spec.Error.
+	Error interface{}
+}
+
+// Spec holds what is shared by every operation of the document.
+type Spec struct {
+	Info Info
+	// Error is a value of the body sent with every error response.
+	Error interface{}
+	// Problem, when set, is a value of the application/problem+json body errors are sent as when asked for.
+	Problem         interface{}
+	SecuritySchemes map[string]*SecurityScheme
+	// Formats are the content types JSON bodies can also be exchanged in, e.g. application/msgpack.
+	Formats []string
+	// Mounts are keyed by their path prefix, routes outside of them are documented as added.
+	Mounts map[string]Mount
+	// CheckBody, when set, is given every request body type so mistakes in them, like validate rules which don't
+	// exist, are found when the API starts.
+	CheckBody func(body interface{}) error
+}
+
+func ref(kind, name string) string {
+	return "#/components/" + kind + "/" + name
+}
+
+// mount finds the mount serving pattern and returns it along with the pattern relative to it.
+func (spec Spec) mount(pattern string) (Mount, string) {
+	best := ""
+	for prefix := range spec.Mounts {
+		if len(prefix) > len(best) && (pattern == prefix || strings.HasPrefix(pattern, prefix+"/")) {
+			best = prefix
+		}
+	}
+	relative := strings.TrimPrefix(pattern, best)
+	if relative == "" {
+		relative = "/"
+	}
+	return spec.Mounts[best], relative
+}
+
+// content documents a body of contentType, and of every other format when it is JSON.
+func (spec Spec) content(contentType string, schema *Schema) map[string]MediaType {
+	content := map[string]MediaType{contentType: {Schema: schema}}
+	if contentType == "application/json" {
+		for _, format := range spec.Formats {
+			content[format] = MediaType{Schema: schema}
+		}
+	}
+	return content
+}
+
+func (spec Spec) errorContent(types Schemas, mount Mount) map[string]MediaType {
+	body := spec.Error
+	if mount.Error != nil {
+		body = mount.Error
+	}
+	content := spec.content("application/json", types.Of(body))
+	if spec.Problem != nil {
+		content["application/problem+json"] = MediaType{Schema: types.Of(spec.Problem)}
+	}
+	return content
+}
+
+// errorResponses adds the error responses shared by the operations of mount and returns the prefix of their names.
+func (spec Spec) errorResponses(doc *Document, types Schemas, mount Mount) string {
+	prefix := ""
+	if mount.Error != nil {
+		prefix = mount.ID
+	}
+	if _, ok := doc.Components.Responses[prefix+"NotFound"]; ok {
+		return prefix
+	}
+	errorBody := func(description string, headers map[string]*Header) *Response {
+		return &Response{
+			Description: description,
+			Headers:     headers,
+			Content:     spec.errorContent(types, mount),
+		}
+	}
+	doc.Components.Responses[prefix+"NotFound"] = errorBody("The resource doesn't exist.", nil)
+	doc.Components.Responses[prefix+"Ratelimited"] = errorBody("The bucket's limit was reached, repeatedly hitting it leads to a ban.", map[string]*Header{
+		"Retry-After": {Description: "Milliseconds until the window resets.", Schema: &Schema{Type: "integer"}},
+	})
+	doc.Components.Responses[prefix+"Banned"] = errorBody("The client is temporarily or permanently banned from the API.", nil)
+	doc.Components.Responses[prefix+"InternalError"] = errorBody("Something went wrong on our side.", nil)
+	return prefix
+}
+
+func components(types Schemas, schemes map[string]*SecurityScheme) Components {
+	integer := &Schema{Type: "integer"}
+	return Components{
+		Schemas: types,
+		Headers: map[string]*Header{
+			"X-RateLimit-Limit":     {Description: "Requests allowed per window of the bucket.", Schema: integer},
+			"X-RateLimit-Remaining": {Description: "Requests left in the current window.", Schema: integer},
+			"X-RateLimit-Reset":     {Description: "Unix time in milliseconds at which the window resets.", Schema: integer},
+			"X-RateLimit-Bucket":    {Description: "Name of the ratelimit bucket the route belongs to.", Schema: &Schema{Type: "string"}},
+			"X-Request-ID":          {Description: "The request's id, echoed from the request when valid.", Schema: &Schema{Type: "string"}},
+			"ETag":                  {Description: "Strong entity tag of the returned data, send it back in If-None-Match.", Schema: &Schema{Type: "string"}},
+			"Cache-Control":         {Description: "How long the response may be cached.", Schema: &Schema{Type: "string"}},
+		},
+		Responses:       map[string]*Response{},
+		SecuritySchemes: schemes,
+	}
+}
+
+// conditional documents the validators and 304 response of a GET operation.
+func conditional(op *Operation) {
+	ok, found := op.Responses["200"]
+	if !found {
+		return
+	}
+	for _, header := range []string{"ETag", "Cache-Control"} {
+		ok.Headers[header] = &Header{Ref: ref("headers", header)}
+	}
+	op.Parameters = append(op.Parameters,
+		Parameter{Name: "If-None-Match", In: "header", Description: "ETags of cached copies.", Schema: &Schema{Type: "string"}},
+	)
+	op.Responses["304"] = &Response{Description: "The cached copy is still current.", Headers: map[string]*Header{
+		"ETag":          {Ref: ref("headers", "ETag")},
+		"Cache-Control": {Ref: ref("headers", "Cache-Control")},
+	}}
+}
+
+func (spec Spec) operation(doc *Document, types Schemas, mount Mount, method string, route Route) *Operation {
+	id := route.ID
+	if mount.ID != "" {
+		id = mount.ID + strings.ToUpper(id[:1]) + id[1:]
+	}
+	op := &Operation{
+		OperationID: id,
+		Summary:     route.Summary,
+		Description: route.Description,
+		Tags:        route.Tags,
+		Parameters:  append([]Parameter(nil), route.Params...),
+		Responses:   map[string]*Response{},
+	}
+	if route.Body != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  spec.content("application/json", types.Of(route.Body)),
+		}
+	}
+	for _, name := range route.Security {
+		op.Security = append(op.Security, map[string][]string{name: {}})
+	}
+	for status, reply := range route.Replies {
+		response := &Response{Description: reply.Description, Headers: map[string]*Header{
+			"X-Request-ID": {Ref: ref("headers", "X-Request-ID")},
+		}}
+		contentType := reply.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		switch {
+		case reply.Error:
+			response.Content = spec.errorContent(types, mount)
+		case reply.Body != nil && mount.Wrap != nil && !reply.Raw:
+			response.Content = spec.content(contentType, mount.Wrap(types, status, reply.Body))
+		case reply.Body != nil:
+			response.Content = spec.content(contentType, types.Of(reply.Body))
+		}
+		if route.Ratelimited && status < 300 {
+			for _, header := range []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-RateLimit-Bucket"} {
+				response.Headers[header] = &Header{Ref: ref("headers", header)}
+			}
+		}
+		op.Responses[strconv.Itoa(status)] = response
+	}
+	if method == http.MethodGet && !route.Streaming {
+		conditional(op)
+	}
+	common := map[string]string{"500": "InternalError"}
+	if route.Ratelimited {
+		common["429"] = "Ratelimited"
+		common["403"] = "Banned"
+	}
+	for _, param := range route.Params {
+		if param.In == "path" {
+			common["404"] = "NotFound"
+		}
+	}
+	prefix := spec.errorResponses(doc, types, mount)
+	for status, name := range common {
+		if _, ok := op.Responses[status]; !ok {
+			op.Responses[status] = &Response{Ref: ref("responses", prefix+name)}
+		}
+	}
+	return op
+}
+
+// Build documents every route served by router. Routes which were neither added nor hidden, and entries which no
+// longer match a route, are returned as an UndocumentedRoutes error next to the document, along with what CheckBody
+// found wrong with the request bodies.
+func (spec Spec) Build(router chi.Routes) (error, *Document) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	types := Schemas{}
+	doc := &Document{
+		OpenAPI:    "3.1.0",
+		Info:       spec.Info,
+		Paths:      map[string]PathItem{},
+		Components: components(types, spec.SecuritySchemes),
+	}
+	var missing []string
+	var bodies []error
+	served := map[string]bool{}
+	_ = chi.Walk(router, func(method string, pattern string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		path := normalise(pattern)
+		mount, relative := spec.mount(path)
+		k := key(method, relative)
+		served[k] = true
+		if hidden[k] {
+			return nil
+		}
+		route, ok := routes[k]
+		if !ok {
+			missing = append(missing, key(method, path))
+			return nil
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(method)] = spec.operation(doc, types, mount, method, route)
+		if route.Body != nil && spec.CheckBody != nil {
+			if err := spec.CheckBody(route.Body); err != nil {
+				bodies = append(bodies, fmt.Errorf("%s: %w", key(method, path), err))
+			}
+		}
+		return nil
+	})
+	for k := range routes {
+		if !served[k] {
+			missing = append(missing, k+" (no longer served)")
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		bodies = append(bodies, fmt.Errorf("%w: %s", UndocumentedRoutes, strings.Join(missing, ", ")))
+	}
+	return errors.Join(bodies...), doc
+}
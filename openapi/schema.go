@@ -0,0 +1,152 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schemas turns go types into JSON schemas following encoding/json's rules, named structs become components.
+type Schemas map[string]*Schema
+
+// Of returns the schema of v's type.
+func (s Schemas) Of(v interface{}) *Schema {
+	return s.of(reflect.TypeOf(v))
+}
+
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	// generic instantiations are named like Page[github.com/discordextremelist/api/entities.Bot]
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		args := strings.Split(strings.TrimSuffix(name[i+1:], "]"), ",")
+		name = name[:i]
+		for _, arg := range args {
+			name += arg[strings.LastIndexByte(arg, '.')+1:]
+		}
+	}
+	return name
+}
+
+func (s Schemas) of(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := componentName(t)
+		if _, ok := s[name]; !ok {
+			// reserve the name first so self referencing types terminate
+			s[name] = &Schema{}
+			*s[name] = *s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	// interfaces and anything else can hold any value
+	return &Schema{}
+}
+
+func (s Schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.fields(t, schema)
+	return schema
+}
+
+func (s Schemas) fields(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.fields(embedded, schema)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = s.of(field.Type)
+		constrain(schema.Properties[name], field.Tag.Get("validate"))
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// constrain documents the entities.Validate rules of a field on its schema.
+func constrain(schema *Schema, rules string) {
+	if rules == "" || schema.Ref != "" {
+		return
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			count := int(limit)
+			switch schema.Type {
+			case "string":
+				if name == "min" {
+					schema.MinLength = &count
+				} else {
+					schema.MaxLength = &count
+				}
+			case "array":
+				if name == "min" {
+					schema.MinItems = &count
+				} else {
+					schema.MaxItems = &count
+				}
+			default:
+				if name == "min" {
+					schema.Minimum = &limit
+				} else {
+					schema.Maximum = &limit
+				}
+			}
+		case "oneof":
+			for _, option := range strings.Fields(arg) {
+				schema.Enum = append(schema.Enum, option)
+			}
+		}
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/metrics"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
 	"github.com/go-redis/redis/v8"
 	log "github.com/sirupsen/logrus"
 	"net/http"
@@ -86,22 +86,49 @@ func NewRatelimiter(opts RatelimiterOptions) *Ratelimiter {
 	s := time.Now()
 	count := util.Database.Redis.HLen(context.TODO(), opts.RedisPrefix).Val()
 	log.WithField("ratelimiter", opts.RedisPrefix).Debugf("Took %s to get %d ratelimits!", time.Now().Sub(s), count)
-	go rl.resetRatelimits()
-	go rl.resetTempBans()
+	util.Go(rl.resetRatelimits)
+	util.Go(rl.resetTempBans)
 	return rl
 }
 
-func (r *Ratelimiter) getAll() map[string]*Ratelimit {
-	return util.Scan[*Ratelimit](r.RPrefix)
+// OptionsFor builds the options of the configured ratelimit bucket called name, stored under "rl_<name>".
+func OptionsFor(name string) RatelimiterOptions {
+	bucket := util.Config.Bucket(name)
+	return RatelimiterOptions{
+		Limit:         bucket.Limit,
+		Reset:         int(bucket.Reset.Milliseconds()),
+		RedisPrefix:   "rl_" + name,
+		TempBanLength: bucket.TempBanLength.Duration,
+		TempBanAfter:  bucket.TempBanAfter,
+		PermBanAfter:  bucket.PermBanAfter,
+	}
+}
+
+func (r *Ratelimiter) bucket() string {
+	return strings.Replace(r.RPrefix, "rl_", "", 1)
+}
+
+// getAll returns every ratelimit of the bucket, or none when they can't be read, e.g. while shutting down.
+func (r *Ratelimiter) getAll(ctx context.Context) map[string]*Ratelimit {
+	err, ratelimits := util.Scan[*Ratelimit](ctx, r.RPrefix)
+	if err != nil && ctx.Err() == nil {
+		util.CaptureException(ctx, err)
+		log.Errorf("Failed to read the %s ratelimits: %v", r.bucket(), err)
+	}
+	return ratelimits
 }
 
-func (r *Ratelimiter) resetRatelimits() {
+func (r *Ratelimiter) resetRatelimits(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(r.Reset) * time.Millisecond)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-time.After(time.Duration(r.Reset) * time.Millisecond):
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 			{
 				r.NextReset = time.Now().Add(time.Duration(r.Reset))
-				for k := range r.getAll() {
+				for k := range r.getAll(ctx) {
 					r.reset(k)
 				}
 			}
@@ -123,14 +150,18 @@ func (r *Ratelimiter) HasExpired(ratelimit *Ratelimit) bool {
 	return (time.Now().UnixNano() - ratelimit.TempBannedAt) >= r.TempBanLength.Nanoseconds()
 }
 
-func (r *Ratelimiter) resetTempBans() {
+func (r *Ratelimiter) resetTempBans(ctx context.Context) {
+	ticker := time.NewTicker(TempBanReset)
+	defer ticker.Stop()
 	for {
 		select {
-		case <-time.After(TempBanReset):
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 			{
-				for k, v := range r.getAll() {
+				for k, v := range r.getAll(ctx) {
 					if v.PermBannedAt > 0 {
-						return
+						continue
 					}
 					v.Unpatch()
 					v.AfterClearCount = 0
@@ -141,20 +172,21 @@ func (r *Ratelimiter) resetTempBans() {
 	}
 }
 
-func (r *Ratelimiter) getRatelimit(key string) *Ratelimit {
-	res, err := util.Database.Redis.HGet(context.TODO(), r.RPrefix, key).Result()
+// getRatelimit counts cost requests against key and returns its ratelimit.
+func (r *Ratelimiter) getRatelimit(ctx context.Context, key string, cost int) *Ratelimit {
+	res, err := util.Database.Redis.HGet(ctx, r.RPrefix, key).Result()
 	if err != nil {
-		sentry.CaptureException(err)
 		if err == redis.Nil {
 			r.cacheRatelimit(key, DefaultRatelimit)
 			return DefaultRatelimit
 		}
+		util.CaptureException(ctx, err)
 		return DefaultRatelimit
 	}
 	var rl *Ratelimit
 	err = json.Unmarshal([]byte(res), &rl)
 	if err != nil {
-		sentry.CaptureException(err)
+		util.CaptureException(ctx, err)
 		return DefaultRatelimit
 	}
 	if rl == nil {
@@ -167,15 +199,16 @@ func (r *Ratelimiter) getRatelimit(key string) *Ratelimit {
 			TotalBans:       0,
 		}
 	}
-	rl.Current++
+	rl.Current += cost
 	r.cacheRatelimit(key, rl)
 	return rl
 }
 
 func (r *Ratelimiter) reset(key string) {
-	rl := r.getRatelimit(key)
+	rl := r.getRatelimit(context.TODO(), key, 1)
 	if rl.PermBannedAt < 1 && rl.TotalBans == r.PermBanAfter {
 		rl.PatchPerm()
+		metrics.RatelimitBans.WithLabelValues(r.bucket(), "perm").Inc()
 	}
 	if rl.TotalBans > 0 && (rl.TempBannedAt > 0 || rl.PermBannedAt > 0) {
 		if rl.TempBan && r.HasExpired(rl) {
@@ -190,6 +223,7 @@ func (r *Ratelimiter) reset(key string) {
 		rl.AfterClearCount++
 		if rl.AfterClearCount >= r.TempBanAfter {
 			rl.PatchTemp()
+			metrics.RatelimitBans.WithLabelValues(r.bucket(), "temp").Inc()
 		}
 	}
 	rl.Current = 0
@@ -198,30 +232,49 @@ func (r *Ratelimiter) reset(key string) {
 
 func (r *Ratelimiter) Ratelimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, req *http.Request) {
-		ratelimit := r.getRatelimit(req.RemoteAddr)
+		ratelimit := r.getRatelimit(req.Context(), req.RemoteAddr, 1)
 		headers := writer.Header()
 		if ratelimit.TotalBans > 0 && (ratelimit.TempBannedAt > 0 || ratelimit.PermBannedAt > 0) {
-			headers.Set("Content-Type", "application/json")
-			writer.WriteHeader(http.StatusForbidden)
 			if !ratelimit.TempBan {
-				json.NewEncoder(writer).Encode(entities.PermBannedError)
+				metrics.RatelimitRejections.WithLabelValues(r.bucket(), "perm_banned").Inc()
+				entities.Fail(writer, req, entities.PermBannedError)
 			} else {
-				json.NewEncoder(writer).Encode(entities.TempBannedError)
+				metrics.RatelimitRejections.WithLabelValues(r.bucket(), "temp_banned").Inc()
+				entities.Fail(writer, req, entities.TempBannedError)
 			}
 			return
 		}
 		left := r.Limit - ratelimit.Current
 		if left <= 0 {
-			headers.Set("Content-Type", "application/json")
 			headers.Set("Retry-After", strconv.FormatInt(time.Now().Sub(r.NextReset).Milliseconds(), 10))
-			writer.WriteHeader(http.StatusTooManyRequests)
-			json.NewEncoder(writer).Encode(entities.RatelimitedError)
+			metrics.RatelimitRejections.WithLabelValues(r.bucket(), "ratelimited").Inc()
+			entities.Fail(writer, req, entities.RatelimitedError)
 			return
 		}
 		headers.Set("X-RateLimit-Limit", strconv.Itoa(r.Limit))
 		headers.Set("X-RateLimit-Remaining", strconv.Itoa(left))
 		headers.Set("X-RateLimit-Reset", strconv.FormatInt(r.NextReset.Unix()*1000, 10))
-		headers.Set("X-RateLimit-Bucket", strings.Replace(r.RPrefix, "rl_", "", 1))
+		headers.Set("X-RateLimit-Bucket", r.bucket())
 		next.ServeHTTP(writer, req)
 	})
 }
+
+// Spend counts cost more requests against the client of a request which already passed Ratelimit, for routes whose
+// requests aren't all equally expensive. It returns false after answering with RatelimitedError when the client
+// can't afford it, otherwise X-RateLimit-Remaining is updated.
+func (r *Ratelimiter) Spend(writer http.ResponseWriter, req *http.Request, cost int) bool {
+	if cost < 1 {
+		return true
+	}
+	ratelimit := r.getRatelimit(req.Context(), req.RemoteAddr, cost)
+	left := r.Limit - ratelimit.Current
+	if left <= 0 {
+		writer.Header().Del("X-RateLimit-Remaining")
+		writer.Header().Set("Retry-After", strconv.FormatInt(time.Until(r.NextReset).Milliseconds(), 10))
+		metrics.RatelimitRejections.WithLabelValues(r.bucket(), "ratelimited").Inc()
+		entities.Fail(writer, req, entities.RatelimitedError)
+		return false
+	}
+	writer.Header().Set("X-RateLimit-Remaining", strconv.Itoa(left))
+	return true
+}
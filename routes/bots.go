@@ -1,20 +1,21 @@
 package routes
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
+	"github.com/discordextremelist/api/cache"
 	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/events"
+	"github.com/discordextremelist/api/openapi"
 	"github.com/discordextremelist/api/ratelimit"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/trending"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"io/ioutil"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
-	"strings"
-	"time"
 )
 
 var (
@@ -23,148 +24,274 @@ var (
 )
 
 func Bot(w http.ResponseWriter, r *http.Request) {
-	err, bot := entities.LookupBot(chi.URLParam(r, "id"), true)
+	err, bot := entities.LookupBot(r.Context(), chi.URLParam(r, "id"), true)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			entities.NotFound(w, r)
 		} else {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
 		}
 		return
 	}
-	entities.WriteBotResponse(w, bot)
+	entities.WriteBotResponse(w, r, bot)
 }
 
-func Bots(w http.ResponseWriter, _ *http.Request) {
-	err, bots := entities.GetAllBots(true)
+func Bots(w http.ResponseWriter, r *http.Request) {
+	err, key := entities.CollectionKey(r.Context(), "bots")
 	if err != nil {
-		sentry.CaptureException(err)
-		entities.WriteErrorResponse(w)
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
 		return
 	}
-	entities.WriteJson(200, w, entities.APIResponseBots{
-		Error:  false,
-		Status: 200,
-		Bots:   bots,
+	entities.RespondList(w, r, key, "bots", func(yield entities.Yield) error {
+		return entities.EachBot(r.Context(), true, func(bot *entities.Bot) error {
+			return yield(bot)
+		})
 	})
 }
 
+func BotsBatch(w http.ResponseWriter, r *http.Request) {
+	ids, ok := entities.DecodeBatch(w, r)
+	if !ok {
+		return
+	}
+	err, bots := entities.LookupBots(r.Context(), ids, true)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.RespondBatch(w, r, ids, bots)
+}
+
+func TrendingBots(w http.ResponseWriter, r *http.Request) {
+	entries, ids, ok := trendingIDs(w, r, trending.Bots)
+	if !ok {
+		return
+	}
+	err, bots := entities.LookupBots(r.Context(), ids, true)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	ranked := []RankedBot{}
+	for _, entry := range entries {
+		if bot, ok := bots[entry.ID]; ok {
+			ranked = append(ranked, RankedBot{Score: entry.Score, Bot: bot})
+		}
+	}
+	entities.Respond(w, r, 200, ranked)
+}
+
 // TODO: Widget
-func Widget(w http.ResponseWriter, _ *http.Request) {
-	entities.WriteNotImplementedResponse(w)
+func Widget(w http.ResponseWriter, r *http.Request) {
+	entities.WriteNotImplementedResponse(w, r)
 }
 
 type StatsRequest struct {
-	GuildCount int `json:"guildCount"`
-	ShardCount int `json:"shardCount"`
+	GuildCount int `json:"guildCount" validate:"min=0"`
+	ShardCount int `json:"shardCount" validate:"min=0"`
+}
+
+type StatsResponse struct {
+	Status  int          `json:"status"`
+	Error   bool         `json:"error"`
+	Updated StatsRequest `json:"updated"`
+}
+
+func (s StatsRequest) Legacy(status int) interface{} {
+	return StatsResponse{Status: status, Error: false, Updated: s}
 }
 
 func UpdateStats(w http.ResponseWriter, r *http.Request) {
-	if !strings.Contains(r.Header.Get(util.ContentType), "application/json") {
-		entities.WriteJson(400, w, entities.BadContentType)
-	} else {
-		bytes, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
-			return
-		}
-		var body StatsRequest
-		err = json.Unmarshal(bytes, &body)
-		if err != nil {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
-			return
-		}
-		err, bot := entities.LookupBot(chi.URLParam(r, "id"), false)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				entities.NotFound(w, r)
-			} else {
-				sentry.CaptureException(err)
-				entities.WriteErrorResponse(w)
-			}
-			return
-		}
-		if !util.Dev && (r.Header.Get(util.Authorization) != bot.Token) {
-			entities.BadAuth(w, r)
-			return
-		}
-		set := bson.M{}
-		if body.GuildCount > 0 {
-			bot.ServerCount = body.GuildCount
-			set["serverCount"] = body.GuildCount
+	var body StatsRequest
+	if !entities.Decode(w, r, &body) {
+		return
+	}
+	// Not from the LRU, a token the website just regenerated mustn't keep working.
+	err, bot := entities.FreshBot(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			entities.NotFound(w, r)
 		} else {
-			set["serverCount"] = bot.ServerCount
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
 		}
-		if body.ShardCount > 0 {
-			bot.ShardCount = body.ShardCount
-			set["shardCount"] = body.ShardCount
+		return
+	}
+	if !util.Dev && (r.Header.Get(util.Authorization) != bot.Token) {
+		entities.BadAuth(w, r)
+		return
+	}
+	set := bson.M{}
+	previous := bot.ServerCount
+	if body.GuildCount > 0 {
+		set["serverCount"] = body.GuildCount
+	}
+	if body.ShardCount > 0 {
+		set["shardCount"] = body.ShardCount
+	}
+	if len(set) == 0 {
+		// Nothing to update.
+		entities.Respond(w, r, 200, body)
+		return
+	}
+	// Only the counts are set and the document MongoDB ends up with is cached, so the website's writes in the
+	// meantime aren't reverted.
+	ctx, span := tracing.StartMongo(r.Context(), "FindOneAndUpdate", "bots")
+	res := util.Database.Mongo.Collection("bots").FindOneAndUpdate(ctx, bson.M{"_id": bot.ID},
+		bson.D{{Key: "$set", Value: set}}, options.FindOneAndUpdate().SetReturnDocument(options.After))
+	var document bson.M
+	var updated struct {
+		ServerCount int `bson:"serverCount"`
+		ShardCount  int `bson:"shardCount"`
+	}
+	err = res.Decode(&document)
+	if err == nil {
+		err = res.Decode(&updated)
+	}
+	tracing.Error(span, err)
+	span.End()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			entities.NotFound(w, r)
 		} else {
-			set["shardCount"] = bot.ShardCount
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
 		}
-		marshaled, err := json.Marshal(bot)
-		if err != nil {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
-			return
+		return
+	}
+	bot.ServerCount, bot.ShardCount = updated.ServerCount, updated.ShardCount
+	marshaled, err := json.Marshal(&document)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	ctx, span = tracing.StartRedis(r.Context(), "HSET", "bots")
+	err = util.Database.Redis.HSet(ctx, "bots", bot.ID, string(marshaled)).Err()
+	tracing.Error(span, err)
+	span.End()
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	if err = cache.Publish(r.Context(), util.Database.Redis, "bots", bot.ID); err != nil {
+		util.CaptureException(r.Context(), err)
+	}
+	// A bot's first count isn't growth.
+	if growth := bot.ServerCount - previous; previous > 0 && growth != 0 {
+		if err = trending.Bots.Record(r.Context(), bot.ID, float64(growth)); err != nil {
+			util.CaptureException(r.Context(), err)
 		}
-		err = util.Database.Redis.HMSet(context.TODO(), "bots", bot.ID, string(marshaled)).Err()
-		if err != nil {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
-			return
+	}
+	if util.Config.Features.PublishEvents() {
+		stats := events.Stats{ServerCount: bot.ServerCount, ShardCount: bot.ShardCount}
+		if err = events.Publish(r.Context(), util.Database.Redis, events.BotStatsUpdated, bot.ID, stats); err != nil {
+			util.CaptureException(r.Context(), err)
 		}
-		_, err = util.Database.Mongo.Collection("bots").UpdateOne(context.TODO(), bson.M{"_id": bot.ID}, bson.D{{"$set", set}})
+	}
+	entities.Respond(w, r, 200, body)
+}
+
+func premiumRatelimit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		err, bot := entities.LookupBot(request.Context(), chi.URLParam(request, "id"), true)
 		if err != nil {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
-			return
+			botsRatelimiter.Ratelimit(handler).ServeHTTP(writer, request)
+		} else {
+			if bot.Status.Premium {
+				premiumBotRatelimiter.Ratelimit(handler).ServeHTTP(writer, request)
+			} else {
+				botsRatelimiter.Ratelimit(handler).ServeHTTP(writer, request)
+			}
 		}
-		entities.WriteJson(200, w, map[string]interface{}{"status": 200, "error": false, "updated": body})
-	}
+	})
 }
 
-func InitBotRoutes() {
-	botsRatelimiter = ratelimit.NewRatelimiter(ratelimit.RatelimiterOptions{
-		Limit:         10,
-		Reset:         60000,
-		RedisPrefix:   "rl_bots",
-		TempBanAfter:  3,
-		PermBanAfter:  3,
-		TempBanLength: 24 * time.Hour,
+func InitBotRoutes(routers ...chi.Router) {
+	botsRatelimiter = ratelimit.NewRatelimiter(ratelimit.OptionsFor("bots"))
+	premiumBotRatelimiter = ratelimit.NewRatelimiter(ratelimit.OptionsFor("premium_bots"))
+	for _, router := range routers {
+		router.Route("/bots", func(r chi.Router) {
+			r.Use(botsRatelimiter.Ratelimit)
+			r.Get("/", Bots)
+			r.Post("/batch", BotsBatch)
+			r.Get("/trending", TrendingBots)
+		})
+		router.Route("/bot/{id}", func(r chi.Router) {
+			r.Use(entities.TokenValidator)
+			r.Use(premiumRatelimit)
+			r.Get("/", Bot)
+			r.Get("/widget", Widget)
+			r.Post("/stats", UpdateStats)
+		})
+	}
+	botID := openapi.PathParam("id", "The bot's id.")
+	openapi.Add(http.MethodGet, "/bots", openapi.Route{
+		ID:      "getBots",
+		Summary: "List every bot",
+		Tags:    []string{"bots"},
+		Params:  []openapi.Parameter{fieldsParam},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "Every bot, streamed as newline delimited JSON with `Accept: application/x-ndjson`.", Body: []entities.Bot{}},
+			400: invalidFields,
+		},
+		Ratelimited: true,
 	})
-	premiumBotRatelimiter = ratelimit.NewRatelimiter(ratelimit.RatelimiterOptions{
-		Limit:         20,
-		Reset:         10000,
-		RedisPrefix:   "rl_premium_bots",
-		TempBanAfter:  4,
-		PermBanAfter:  4,
-		TempBanLength: 24 * time.Hour,
+	openapi.Add(http.MethodPost, "/bots/batch", batchRoute("getBotsBatch", "bots"))
+	openapi.Add(http.MethodGet, "/bots/trending", openapi.Route{
+		ID:          "getTrendingBots",
+		Summary:     "Get the bots growing fastest",
+		Description: "Bots are ranked by the servers they gained, net of those they lost, as reported to `/bot/{id}/stats`.",
+		Tags:        []string{"bots"},
+		Params:      []openapi.Parameter{windowParam, limitParam},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The bots with the highest decayed growth in the window, highest first.", Body: []RankedBot{}},
+			400: badRanking,
+		},
+		Ratelimited: true,
 	})
-	util.Router.Route("/bots", func(r chi.Router) {
-		r.Use(botsRatelimiter.Ratelimit)
-		r.Get("/", Bots)
+	openapi.Add(http.MethodGet, "/bot/{id}", openapi.Route{
+		ID:          "getBot",
+		Summary:     "Get a bot",
+		Description: "Premium bots are ratelimited with the premium_bots bucket.",
+		Tags:        []string{"bots"},
+		Params:      []openapi.Parameter{botID, fieldsParam},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The bot.", Body: &entities.Bot{}},
+			400: invalidFields,
+		},
+		Ratelimited: true,
 	})
-	util.Router.Route("/bot/{id}", func(r chi.Router) {
-		r.Use(entities.TokenValidator)
-		r.Use(func(handler http.Handler) http.Handler {
-			return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-				err, bot := entities.LookupBot(chi.URLParam(request, "id"), true)
-				if err != nil {
-					botsRatelimiter.Ratelimit(handler).ServeHTTP(writer, request)
-				} else {
-					if bot.Status.Premium {
-						premiumBotRatelimiter.Ratelimit(handler).ServeHTTP(writer, request)
-					} else {
-						botsRatelimiter.Ratelimit(handler).ServeHTTP(writer, request)
-					}
-				}
-			})
-		})
-		r.Get("/", Bot)
-		r.Get("/widget", Widget)
-		r.Post("/stats", UpdateStats)
+	openapi.Add(http.MethodGet, "/bot/{id}/widget", openapi.Route{
+		ID:      "getBotWidget",
+		Summary: "Get a bot's widget",
+		Tags:    []string{"bots"},
+		Params:  []openapi.Parameter{botID},
+		Replies: map[int]openapi.Reply{
+			501: {Description: "Not implemented yet.", Error: true},
+		},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodPost, "/bot/{id}/stats", openapi.Route{
+		ID:      "updateBotStats",
+		Summary: "Update a bot's server and shard count",
+		Tags:    []string{"bots"},
+		Params:  []openapi.Parameter{botID},
+		Body:    StatsRequest{},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The counts were updated, counts of 0 are left as they were.", Body: StatsRequest{}},
+			400: {Description: "The body couldn't be decoded.", Error: true},
+			413: {Description: "The body is too large.", Error: true},
+			403: {Description: "The token is missing, invalid or belongs to another bot, or the client is banned.", Error: true},
+			415: {Description: "The body isn't JSON, MessagePack or CBOR.", Error: true},
+			422: {Description: "A count is negative or the body has unknown fields, see `fields`.", Error: true},
+		},
+		Security:    []string{"botToken"},
+		Ratelimited: true,
 	})
 }
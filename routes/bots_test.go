@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStatsTokenNotFromLRU(t *testing.T) {
+	id := "100000000000000020"
+	token := func(c string) string { return "DELAPI_" + strings.Repeat(c, 32) + "-" + id }
+	bot := func(token string) string { return `{"_id":"` + id + `","name":"Stats","token":"` + token + `"}` }
+	testRedis.HSet("bots", id, bot(token("a")))
+	// Leaves the bot with the old token in the LRU.
+	expectStatus(t, serve(http.MethodGet, "/v2/bot/"+id), http.StatusOK)
+	testRedis.HSet("bots", id, bot(token("b")))
+	body := `{"guildCount":10}`
+	expectStatus(t, serveBody(http.MethodPost, "/v2/bot/"+id+"/stats", body,
+		"Authorization", token("a"), "Content-Type", "application/json"), http.StatusForbidden)
+	// MongoDB can't be reached, getting that far means the new token was accepted.
+	expectStatus(t, serveBody(http.MethodPost, "/v2/bot/"+id+"/stats", body,
+		"Authorization", token("b"), "Content-Type", "application/json"), http.StatusInternalServerError)
+}
@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"context"
+	"github.com/discordextremelist/api/cache"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/util"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConditionalGet(t *testing.T) {
+	testRedis.HSet("bots", "100000000000000010", `{"_id":"100000000000000010","name":"Cached"}`)
+	w := serve(http.MethodGet, "/v2/bot/100000000000000010")
+	expectStatus(t, w, http.StatusOK)
+	tag := w.Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("no ETag")
+	}
+	if modified := w.Header().Get("Last-Modified"); modified != "" {
+		t.Fatalf("Last-Modified = %q, replicas can't agree on one", modified)
+	}
+	request := func(header, value string) *httptest.ResponseRecorder {
+		return serve(http.MethodGet, "/v2/bot/100000000000000010", header, value)
+	}
+	expectStatus(t, request("If-None-Match", tag), http.StatusNotModified)
+	expectStatus(t, request("If-None-Match", `"stale"`), http.StatusOK)
+	expectStatus(t, request("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)), http.StatusOK)
+}
+
+func TestListTagFollowsVersion(t *testing.T) {
+	testRedis.HSet("bots", "100000000000000011", `{"_id":"100000000000000011","name":"Listed"}`)
+	w := serve(http.MethodGet, "/v2/bots/")
+	expectStatus(t, w, http.StatusOK)
+	tag := w.Header().Get("ETag")
+	revalidate := func() *httptest.ResponseRecorder {
+		return serve(http.MethodGet, "/v2/bots/", "If-None-Match", tag)
+	}
+	tracing.Memory.Reset()
+	expectStatus(t, revalidate(), http.StatusNotModified)
+	for _, span := range tracing.Memory.GetSpans() {
+		if span.Name == "redis.HSCAN" {
+			t.Fatal("revalidating the list scanned the collection")
+		}
+	}
+	if err := cache.Publish(context.Background(), util.Database.Redis, "bots", "100000000000000011"); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, revalidate(), http.StatusOK)
+}
+
+func TestListUntaggedWithoutChangeStreams(t *testing.T) {
+	util.Config.Features.ChangeStreams = false
+	defer func() { util.Config.Features.ChangeStreams = true }()
+	w := serve(http.MethodGet, "/v2/bots/")
+	expectStatus(t, w, http.StatusOK)
+	if tag := w.Header().Get("ETag"); tag != "" {
+		t.Fatalf("ETag = %s, the website's writes wouldn't change it", tag)
+	}
+}
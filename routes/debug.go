@@ -1,45 +1,106 @@
 package routes
 
 import (
-	"context"
+	"errors"
+	"github.com/discordextremelist/api/cache"
 	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/tracing"
 	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
 	"go.mongodb.org/mongo-driver/bson"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 )
 
-func Debug(w http.ResponseWriter, r *http.Request) {
-	if !util.Dev {
-		token := r.URL.Query().Get("token")
-		if token == "" {
-			entities.WriteJson(403, w, map[string]interface{}{})
-			return
-		}
-		err := util.Database.Mongo.Collection("adminTokens").FindOne(context.TODO(), bson.M{"token": token}).Err()
-		if err != nil {
-			entities.WriteJson(403, w, map[string]interface{}{})
-			return
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !util.Dev {
+			token := r.URL.Query().Get("token")
+			if token == "" {
+				entities.Fail(w, r, entities.ForbiddenError)
+				return
+			}
+			ctx, span := tracing.StartMongo(r.Context(), "FindOne", "adminTokens")
+			err := util.Database.Mongo.Collection("adminTokens").FindOne(ctx, bson.M{"token": token}).Err()
+			span.End()
+			if err != nil {
+				entities.Fail(w, r, entities.ForbiddenError)
+				return
+			}
 		}
-	}
-	debug(w)
+		next.ServeHTTP(w, r)
+	})
 }
 
-func debug(w http.ResponseWriter) {
+func Debug(w http.ResponseWriter, _ *http.Request) {
 	hostname, _ := os.Hostname()
 	entities.WritePrettyJson(200, w, &entities.DebugStatistics{
 		RedisPing: util.Database.PingRedis(),
 		MongoPing: util.Database.PingMongo(),
 		Node:      util.Node,
+		Pod:       util.Pod,
+		Namespace: util.Namespace,
+		Zone:      util.Zone,
+		Region:    util.Region,
 		LookupTimes: entities.LookupTimes{
-			Mongo: entities.MongoLookupTimes,
-			Redis: entities.RedisLookupTimes,
+			Mongo: entities.MongoLookupTimes.Recent(),
+			Redis: entities.RedisLookupTimes.Recent(),
 		},
-		ResponseTimes: entities.ResponseTimes,
+		ResponseTimes: entities.ResponseTimes.Recent(),
 		Hostname:      hostname,
+		Cache:         cache.AllStats(),
 	})
 }
 
+func SyncCache(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := entities.CacheSyncOptions{}
+	// A typo mustn't turn a dry run into a real sync.
+	if dryRun := query.Get("dryRun"); dryRun != "" {
+		var err error
+		if opts.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			entities.Fail(w, r, entities.InvalidQueryError.With("dryRun must be true or false!"))
+			return
+		}
+	}
+	if batchSize := query.Get("batchSize"); batchSize != "" {
+		var err error
+		if opts.BatchSize, err = strconv.Atoi(batchSize); err != nil || opts.BatchSize < 1 {
+			entities.Fail(w, r, entities.InvalidQueryError.With("batchSize must be a positive number!"))
+			return
+		}
+	}
+	if cols := query.Get("collections"); cols != "" {
+		opts.Collections = strings.Split(cols, ",")
+	}
+	err, report := entities.SyncCache(r.Context(), opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, entities.UnknownCollection):
+			entities.Fail(w, r, entities.UnknownCollectionError)
+		case errors.Is(err, entities.SyncInProgress), errors.Is(err, entities.SyncLockLost):
+			entities.Fail(w, r, entities.SyncInProgressError)
+		default:
+			entities.WriteErrorResponse(w, r)
+		}
+		return
+	}
+	entities.WritePrettyJson(200, w, map[string]interface{}{"status": 200, "error": false, "report": report})
+}
+
 func InitDebugRoutes() {
-	util.Router.Get("/debug", Debug)
+	util.Router.Route("/debug", func(r chi.Router) {
+		r.Use(AdminOnly)
+		r.Get("/", Debug)
+		if util.Config.Features.CacheSyncEndpoint {
+			r.Post("/cache/sync", SyncCache)
+		}
+	})
+	openapi.Hide(http.MethodGet, "/debug")
+	if util.Config.Features.CacheSyncEndpoint {
+		openapi.Hide(http.MethodPost, "/debug/cache/sync")
+	}
 }
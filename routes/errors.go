@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
+	"net/http"
+)
+
+type ErrorType struct {
+	Type    string `json:"type"`
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func errorType(err entities.APIError) ErrorType {
+	return ErrorType{Type: err.Type(), Status: err.Status, Code: err.Code, Message: err.Message}
+}
+
+func Errors(w http.ResponseWriter, _ *http.Request) {
+	catalog := entities.Catalog()
+	types := make([]ErrorType, 0, len(catalog))
+	for _, err := range catalog {
+		types = append(types, errorType(err))
+	}
+	entities.WritePrettyJson(200, w, types)
+}
+
+func Error(w http.ResponseWriter, r *http.Request) {
+	err, ok := entities.LookupAPIError(chi.URLParam(r, "code"))
+	if !ok {
+		entities.NotFound(w, r)
+		return
+	}
+	entities.WritePrettyJson(200, w, errorType(err))
+}
+
+// InitErrorRoutes serves the error catalog, the type of a problem details body points at its entry.
+func InitErrorRoutes() {
+	util.Router.Get("/errors", Errors)
+	util.Router.Get("/errors/{code}", Error)
+	openapi.Add(http.MethodGet, "/errors", openapi.Route{
+		ID:      "getErrors",
+		Summary: "Every error the API responds with",
+		Tags:    []string{"general"},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The error catalog, codes are stable while messages may change.", Body: []ErrorType{}},
+		},
+	})
+	openapi.Add(http.MethodGet, "/errors/{code}", openapi.Route{
+		ID:      "getError",
+		Summary: "An error of the catalog",
+		Tags:    []string{"general"},
+		Params:  []openapi.Parameter{openapi.PathParam("code", "The error's code.")},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The error.", Body: ErrorType{}},
+		},
+	})
+}
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/events"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/ratelimit"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	eventsRatelimiter *ratelimit.Ratelimiter
+	upgrader          = websocket.Upgrader{
+		HandshakeTimeout: 10 * time.Second,
+		// Events are public and nothing is read from the connection, any page may subscribe.
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+)
+
+// streamWebSocket sends every event as a JSON text message, pings each heartbeat and expects the pong by the next one.
+func streamWebSocket(w http.ResponseWriter, r *http.Request, sub *events.Subscription) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade already told the client what was wrong with the handshake.
+		return
+	}
+	defer conn.Close()
+	heartbeat := util.Config.Events.Heartbeat.Duration
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+	})
+	// Clients don't send anything, reading only handles control frames and notices when they go away.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "subscription ended, reconnect")
+				_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(heartbeat))
+			if conn.WriteJSON(event) != nil {
+				return
+			}
+		case <-ticker.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(heartbeat)) != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamSSE sends every event as a server-sent event named after its type, with a comment each heartbeat.
+func streamSSE(w http.ResponseWriter, r *http.Request, sub *events.Subscription) {
+	rc := http.NewResponseController(w)
+	// The server's write timeout is meant for ordinary responses, the stream lasts until the client leaves.
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if rc.Flush() != nil {
+		return
+	}
+	ticker := time.NewTicker(util.Config.Events.Heartbeat.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				util.CaptureException(r.Context(), err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+func Events(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, unknown := events.ParseFilter(query.Get("types"), query.Get("ids"))
+	if len(unknown) > 0 {
+		entities.Fail(w, r, entities.UnknownEventTypeError.With(fmt.Sprintf(
+			"Unknown event types %s, expected an entity or one of %s!", strings.Join(unknown, ", "), strings.Join(events.Types, ", "),
+		)))
+		return
+	}
+	sub := events.Subscribe(filter, util.Config.Events.Buffer)
+	defer sub.Close()
+	if websocket.IsWebSocketUpgrade(r) {
+		streamWebSocket(w, r, sub)
+	} else {
+		streamSSE(w, r, sub)
+	}
+}
+
+func InitEventRoutes(routers ...chi.Router) {
+	eventsRatelimiter = ratelimit.NewRatelimiter(ratelimit.OptionsFor("events"))
+	for _, router := range routers {
+		router.With(eventsRatelimiter.Ratelimit).Get("/events", Events)
+	}
+	openapi.Add(http.MethodGet, "/events", openapi.Route{
+		ID:      "streamEvents",
+		Summary: "Stream entity changes",
+		Description: "Streams `" + strings.Join(events.Types, "`, `") + "` events as they happen, over server-sent " +
+			"events or, when the request is a WebSocket handshake, as JSON text messages. Streams are pinged every " +
+			"heartbeat. Events published while a client is disconnected aren't replayed, and clients falling too far " +
+			"behind are disconnected. Each connection counts as one request of the events bucket.",
+		Tags: []string{"events"},
+		Params: []openapi.Parameter{
+			openapi.QueryParam("types", "Comma separated event types, or entities to get all of their events, e.g. `bot,server.created`.", &openapi.Schema{Type: "string"}),
+			openapi.QueryParam("ids", "Comma separated ids of the entities to get events about.", &openapi.Schema{Type: "string"}),
+		},
+		Replies: map[int]openapi.Reply{
+			101: {Description: "Switched to a WebSocket, every message is an event."},
+			200: {Description: "The server-sent events, named after their type with the event as data.", Body: events.Event{}, ContentType: "text/event-stream", Raw: true},
+			400: {Description: "The types parameter lists types which don't exist (`unknown_event_type`).", Error: true},
+		},
+		Ratelimited: true,
+		Streaming:   true,
+	})
+}
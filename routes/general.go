@@ -2,27 +2,26 @@ package routes
 
 import (
 	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/openapi"
 	"github.com/discordextremelist/api/ratelimit"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi"
 	"net/http"
-	"time"
 )
 
-func Stats(w http.ResponseWriter, _ *http.Request) {
-	result := entities.APIStatsResponse{Status: 200, Error: false}
-	err, servers := entities.GetAllServers(false)
+func Stats(w http.ResponseWriter, r *http.Request) {
+	result := entities.Stats{}
+	err, servers := entities.GetAllServers(r.Context(), false)
 	if err != nil {
-		sentry.CaptureException(err)
-		entities.WriteJson(500, w, entities.GetServersFailed)
+		util.CaptureException(r.Context(), err)
+		entities.Fail(w, r, entities.GetServersFailed)
 		return
 	}
 	result.Servers = entities.APIStatsResponseServers{Total: len(servers)}
-	err, bots := entities.GetAllBots(false)
+	err, bots := entities.GetAllBots(r.Context(), false)
 	if err != nil {
-		sentry.CaptureException(err)
-		entities.WriteJson(500, w, entities.GetBotsFailed)
+		util.CaptureException(r.Context(), err)
+		entities.Fail(w, r, entities.GetBotsFailed)
 		return
 	}
 	botRes := entities.APIStatsResponseBots{Total: len(bots), Approved: 0, Premium: 0}
@@ -35,10 +34,10 @@ func Stats(w http.ResponseWriter, _ *http.Request) {
 		}
 	}
 	result.Bots = botRes
-	err, users := entities.GetAllUsers(false)
+	err, users := entities.GetAllUsers(r.Context(), false)
 	if err != nil {
-		sentry.CaptureException(err)
-		entities.WriteJson(500, w, entities.GetUsersFailed)
+		util.CaptureException(r.Context(), err)
+		entities.Fail(w, r, entities.GetUsersFailed)
 		return
 	}
 	userRes := entities.APIStatsResponseUsers{Total: len(users), Premium: 0, Staff: entities.APIStatsResponseStaff{Total: 0, Mods: 0, Assistants: 0, Admins: 0}}
@@ -63,52 +62,58 @@ func Stats(w http.ResponseWriter, _ *http.Request) {
 		}
 	}
 	result.Users = userRes
-	err, templates := entities.GetAllTemplates()
+	err, templates := entities.GetAllTemplates(r.Context())
 	if err != nil {
-		sentry.CaptureException(err)
-		entities.WriteJson(500, w, entities.GetTemplatesFailed)
+		util.CaptureException(r.Context(), err)
+		entities.Fail(w, r, entities.GetTemplatesFailed)
 		return
 	}
 	result.Templates = len(templates)
-	entities.WriteJson(200, w, result)
+	entities.Respond(w, r, 200, result)
 }
 
-func Health(w http.ResponseWriter, _ *http.Request) {
-	result := entities.APIHealthResponse{
-		Status:    200,
-		Error:     false,
-		RedisOK:   true,
-		MongoOK:   true,
+func Health(w http.ResponseWriter, r *http.Request) {
+	result := entities.Health{
 		MongoPing: util.Database.PingMongo(),
 		RedisPing: util.Database.PingRedis(),
 	}
-	if !util.Database.IsRedisOpen() {
-		result.Status = http.StatusServiceUnavailable
-		result.Error = true
-		result.RedisOK = false
+	// a failed ping is reported as -1, no need to ping a second time
+	result.RedisOK = result.RedisPing >= 0
+	result.MongoOK = result.MongoPing >= 0
+	status := 200
+	if !result.RedisOK || !result.MongoOK {
+		status = http.StatusServiceUnavailable
 	}
-	if !util.Database.IsMongoOpen() {
-		if result.Status != http.StatusServiceUnavailable {
-			result.Status = http.StatusServiceUnavailable
-			result.Error = true
-		}
-		result.MongoOK = false
-	}
-	entities.WriteJson(result.Status, w, result)
+	entities.Respond(w, r, status, result)
 }
 
-func InitGeneralRoutes() {
-	ratelimiter := ratelimit.NewRatelimiter(ratelimit.RatelimiterOptions{
-		Limit:         5,
-		Reset:         5000,
-		RedisPrefix:   "rl_general",
-		TempBanLength: 1 * time.Hour,
-		TempBanAfter:  5,
-		PermBanAfter:  2,
+func InitGeneralRoutes(routers ...chi.Router) {
+	ratelimiter := ratelimit.NewRatelimiter(ratelimit.OptionsFor("general"))
+	for _, router := range routers {
+		router.Group(func(r chi.Router) {
+			r.Use(ratelimiter.Ratelimit)
+			r.Get("/health", Health)
+			r.Get("/stats", Stats)
+		})
+	}
+	openapi.Add(http.MethodGet, "/health", openapi.Route{
+		ID:          "getHealth",
+		Summary:     "Redis and MongoDB health",
+		Description: "Prefer /readyz for probes, this route is ratelimited.",
+		Tags:        []string{"general"},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "Both databases answered.", Body: entities.Health{}},
+			503: {Description: "A database didn't answer, its ping is -1.", Body: entities.Health{}},
+		},
+		Ratelimited: true,
 	})
-	util.Router.Route("/", func(r chi.Router) {
-		r.Use(ratelimiter.Ratelimit)
-		r.Get("/health", Health)
-		r.Get("/stats", Stats)
+	openapi.Add(http.MethodGet, "/stats", openapi.Route{
+		ID:      "getStats",
+		Summary: "Entity counts",
+		Tags:    []string{"general"},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "Totals of servers, bots, users and templates.", Body: entities.Stats{}},
+		},
+		Ratelimited: true,
 	})
 }
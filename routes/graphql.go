@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/graph"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/ratelimit"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"net/http"
+)
+
+var graphQLRatelimiter *ratelimit.Ratelimiter
+
+// GraphQLRequest is a query as graphql clients send it, over GET the fields are query parameters with the variables
+// encoded as JSON.
+type GraphQLRequest struct {
+	Query         string                 `json:"query" validate:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// GraphQLResponse is the result of a query, sent as is on every API version.
+type GraphQLResponse struct {
+	Data       interface{}                `json:"data"`
+	Errors     []gqlerrors.FormattedError `json:"errors,omitempty"`
+	Extensions map[string]interface{}     `json:"extensions,omitempty"`
+}
+
+func writeGraphQL(w http.ResponseWriter, r *http.Request, status int, result *graphql.Result) {
+	response := GraphQLResponse{Data: result.Data, Errors: result.Errors, Extensions: result.Extensions}
+	codec := entities.Negotiate(r)
+	w.Header().Add("Vary", "Accept")
+	// Queries sent with GET can be cached like any other read.
+	if r.Method == http.MethodGet && status == http.StatusOK && len(result.Errors) == 0 {
+		if key, err := json.Marshal(response); err == nil && entities.Precondition(w, r, append(key, codec.ContentType...)) {
+			return
+		}
+	}
+	body, err := codec.Marshal(response)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func GraphQL(w http.ResponseWriter, r *http.Request) {
+	var body GraphQLRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		body = GraphQLRequest{Query: query.Get("query"), OperationName: query.Get("operationName")}
+		if variables := query.Get("variables"); variables != "" && json.Unmarshal([]byte(variables), &body.Variables) != nil {
+			entities.Fail(w, r, entities.ValidationError.WithFields([]entities.FieldError{{Field: "variables", Message: "must be a JSON object"}}))
+			return
+		}
+		if !entities.Check(w, r, &body) {
+			return
+		}
+	} else if !entities.Decode(w, r, &body) {
+		return
+	}
+	doc, err := parser.Parse(parser.ParseParams{Source: body.Query})
+	if err != nil {
+		writeGraphQL(w, r, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if validation := graphql.ValidateDocument(&graph.Schema, doc, nil); !validation.IsValid {
+		writeGraphQL(w, r, http.StatusBadRequest, &graphql.Result{Errors: validation.Errors})
+		return
+	}
+	cost := graph.Estimate(doc, body.OperationName, body.Variables)
+	limits := util.Config.GraphQL
+	if cost.Entities > limits.MaxCost || cost.Depth > limits.MaxDepth {
+		// Reported like the other errors about the query, graphql clients only look for them in errors.
+		tooComplex := entities.QueryTooComplexError.With(fmt.Sprintf(
+			"The query resolves up to %d entities nested %d deep, at most %d entities nested %d deep are allowed!",
+			cost.Entities, cost.Depth, limits.MaxCost, limits.MaxDepth,
+		))
+		writeGraphQL(w, r, tooComplex.Status, &graphql.Result{Errors: []gqlerrors.FormattedError{{
+			Message:    tooComplex.Message,
+			Extensions: map[string]interface{}{"code": tooComplex.Code, "cost": cost},
+		}}})
+		return
+	}
+	// Ratelimit already counted the request as one entity.
+	if !graphQLRatelimiter.Spend(w, r, cost.Entities-1) {
+		return
+	}
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        graph.Schema,
+		AST:           doc,
+		OperationName: body.OperationName,
+		Args:          body.Variables,
+		Context:       graph.WithLoaders(r.Context()),
+	})
+	result.Extensions = map[string]interface{}{"cost": cost}
+	writeGraphQL(w, r, http.StatusOK, result)
+}
+
+func InitGraphQLRoutes(routers ...chi.Router) {
+	// The schema only depends on the entity types, failing to generate it is a bug rather than something to recover from.
+	if err := graph.NewSchema(); err != nil {
+		panic("failed to generate the graphql schema: " + err.Error())
+	}
+	graphQLRatelimiter = ratelimit.NewRatelimiter(ratelimit.OptionsFor("graphql"))
+	for _, router := range routers {
+		router.With(graphQLRatelimiter.Ratelimit).Get("/graphql", GraphQL)
+		router.With(graphQLRatelimiter.Ratelimit).Post("/graphql", GraphQL)
+	}
+	description := "Bots, users, servers and templates with their owners, editors and source servers resolved, " +
+		"redacted like on the other routes. Queries are ratelimited by cost: every entity resolved counts as a request " +
+		"of the graphql bucket, lists counting at their number of ids or `first`. The cost is returned in `extensions`."
+	replies := map[int]openapi.Reply{
+		200: {Description: "The result, errors resolving fields are listed in `errors` next to the partial data.", Body: GraphQLResponse{}, Raw: true},
+		400: {Description: "The query couldn't be parsed or validated, or resolves too many entities (`query_too_complex`), `errors` says why.", Body: GraphQLResponse{}, Raw: true},
+		422: {Description: "The query is missing.", Error: true},
+	}
+	openapi.Add(http.MethodGet, "/graphql", openapi.Route{
+		ID:          "graphqlQuery",
+		Summary:     "Run a GraphQL query",
+		Description: description,
+		Tags:        []string{"graphql"},
+		Params: []openapi.Parameter{
+			openapi.QueryParam("query", "The query document.", &openapi.Schema{Type: "string"}),
+			openapi.QueryParam("operationName", "The operation to run when the document has several.", &openapi.Schema{Type: "string"}),
+			openapi.QueryParam("variables", "The variables as a JSON object.", &openapi.Schema{Type: "string"}),
+		},
+		Replies:     replies,
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodPost, "/graphql", openapi.Route{
+		ID:          "graphqlPost",
+		Summary:     "Run a GraphQL query",
+		Description: description,
+		Tags:        []string{"graphql"},
+		Body:        GraphQLRequest{},
+		Replies: map[int]openapi.Reply{
+			200: replies[200],
+			400: {Description: replies[400].Description + " Bodies which can't be decoded get the usual error body.", Body: GraphQLResponse{}, Raw: true},
+			413: {Description: "The body is too large.", Error: true},
+			415: {Description: "The body isn't JSON, MessagePack or CBOR.", Error: true},
+			422: {Description: "The query is missing or the body has unknown fields.", Error: true},
+		},
+		Ratelimited: true,
+	})
+}
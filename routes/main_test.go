@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/discordextremelist/api/config"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	testRedis *miniredis.Miniredis
+	// openAPIErr is what InitOpenAPIRoutes returned for the router every test shares.
+	openAPIErr error
+)
+
+// TestMain serves every route like main does, against an in-memory redis and a MongoDB which can't be reached, so
+// lookups missing from redis fail fast.
+func TestMain(m *testing.M) {
+	var err error
+	if testRedis, err = miniredis.Run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	util.Config = config.Defaults()
+	util.Config.Tracing.Exporter = "memory"
+	if _, err = tracing.Init(context.Background(), util.Config.Tracing); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	util.Database.Redis = redis.NewClient(&redis.Options{Addr: testRedis.Addr()})
+	client, err := mongo.Connect(context.Background(), options.Client().
+		ApplyURI("mongodb://127.0.0.1:1").
+		SetServerSelectionTimeout(100*time.Millisecond))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	util.Database.Mongo = client.Database("test")
+	util.Router = chi.NewRouter()
+	util.Router.Use(util.RequestID, tracing.Middleware, entities.Sentry)
+	util.Router.NotFound(entities.NotFound)
+	InitProbeRoutes()
+	InitDebugRoutes()
+	InitErrorRoutes()
+	InitMetricsRoutes()
+	InitAPIRoutes()
+	openAPIErr = InitOpenAPIRoutes()
+	code := m.Run()
+	testRedis.Close()
+	os.Exit(code)
+}
+
+var clients atomic.Int32
+
+// serve sends a request with header, pairs of names and values, from a client of its own so tests don't share
+// ratelimits.
+func serve(method, target string, header ...string) *httptest.ResponseRecorder {
+	return serveBody(method, target, "", header...)
+}
+
+func serveBody(method, target, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	n := clients.Add(1)
+	r.RemoteAddr = fmt.Sprintf("192.0.%d.%d:1234", n/250, n%250+1)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	util.Router.ServeHTTP(w, r)
+	return w
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+}
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/discordextremelist/api/metrics"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/util"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+func InitMetricsRoutes() {
+	metrics.RegisterPings(util.Database.PingRedis, util.Database.PingMongo)
+	util.Router.Method(http.MethodGet, "/metrics", promhttp.Handler())
+	openapi.Hide(http.MethodGet, "/metrics")
+}
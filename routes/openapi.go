@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/discordextremelist/api/config"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
+	"html/template"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	//go:embed docs.html
+	docsHTML string
+	docsPage = template.Must(template.New("docs").Parse(docsHTML))
+	document *openapi.Document
+)
+
+const vendoredRedoc = "/docs/redoc.standalone.js"
+
+// renderDocs renders /docs with docs' redoc. A vendored bundle is returned to be served from vendoredRedoc and is
+// pinned with its own hash, so the page doesn't run whatever ends up at that path later either.
+func renderDocs(docs config.Docs) (err error, page, bundle []byte) {
+	data := struct{ Src, Integrity string }{Src: docs.Redoc, Integrity: docs.RedocIntegrity}
+	if !docs.RemoteRedoc() {
+		if bundle, err = os.ReadFile(docs.Redoc); err != nil {
+			return fmt.Errorf("docs.redoc: %w", err), nil, nil
+		}
+		sum := sha512.Sum384(bundle)
+		data.Src = vendoredRedoc
+		data.Integrity = "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	var b bytes.Buffer
+	if err = docsPage.Execute(&b, data); err != nil {
+		return err, nil, nil
+	}
+	return nil, b.Bytes(), bundle
+}
+
+// fieldsParam documents ?fields= of the routes answering with entities, see entities.ParseFields.
+var fieldsParam = openapi.QueryParam("fields", "Comma separated json paths to return instead of the whole entity, e.g. `id,name,status.approved`.", &openapi.Schema{Type: "string"})
+
+var invalidFields = openapi.Reply{Description: "`fields` names a path which doesn't exist.", Error: true}
+
+// batchRoute documents the batch lookup route of the entities called plural.
+func batchRoute(id, plural string) openapi.Route {
+	return openapi.Route{
+		ID:          id,
+		Summary:     "Get several " + plural + " at once",
+		Description: "Results are in the order the ids were given in, duplicates are dropped. Ids which don't exist have a `not_found` error instead of data.",
+		Tags:        []string{plural},
+		Params:      []openapi.Parameter{fieldsParam},
+		Body:        entities.BatchRequest{},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "A result per id.", Body: entities.BatchResults{}},
+			400: {Description: "The body couldn't be decoded, or `fields` names a path which doesn't exist.", Error: true},
+			413: {Description: "The body is too large.", Error: true},
+			415: {Description: "The body isn't JSON, MessagePack or CBOR.", Error: true},
+			422: {Description: "No ids or more than the configured maximum were given.", Error: true},
+		},
+		Ratelimited: true,
+	}
+}
+
+var spec = openapi.Spec{
+	Info: openapi.Info{
+		Title:   "Discord Extreme List API",
+		Version: "2",
+		Description: "Every route is ratelimited per IP, exceeding a bucket's limit repeatedly gets the IP temporarily and then permanently banned. " +
+			"/v2 wraps every body in a {data, error, meta} envelope, /v1 and the unprefixed routes keep the original shapes.",
+	},
+	Error:   entities.APIResponse{},
+	Problem: entities.Problem{},
+	SecuritySchemes: map[string]*openapi.SecurityScheme{
+		"botToken": {
+			Type:        "apiKey",
+			In:          "header",
+			Name:        util.Authorization,
+			Description: "The bot's DELAPI_ token, found on its edit page.",
+		},
+		"websiteToken": {
+			Type:        "apiKey",
+			In:          "header",
+			Name:        util.Authorization,
+			Description: "The website's token, the WEBSITE_TOKEN the API is configured with.",
+		},
+	},
+	Formats: []string{entities.MsgpackCodec.ContentType, entities.CBORCodec.ContentType},
+	Mounts: map[string]openapi.Mount{
+		"":    {Wrap: legacy},
+		"/v1": {ID: "v1", Wrap: legacy},
+		"/v2": {ID: "v2", Wrap: envelope, Error: entities.Envelope{}},
+	},
+	CheckBody: entities.CheckRules,
+}
+
+func legacy(types openapi.Schemas, status int, body interface{}) *openapi.Schema {
+	return types.Of(entities.Legacy(status, body))
+}
+
+func envelope(types openapi.Schemas, _ int, body interface{}) *openapi.Schema {
+	return &openapi.Schema{AllOf: []*openapi.Schema{
+		types.Of(entities.Envelope{}),
+		{Properties: map[string]*openapi.Schema{"data": types.Of(body)}},
+	}}
+}
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// unknownRouteKeys reports the keys of cache_control and logging.access_sample which match no route of router, the
+// config can only check how they are written.
+func unknownRouteKeys(router chi.Routes) error {
+	served := map[string]bool{}
+	_ = chi.Walk(router, func(_ string, pattern string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route := versionPrefix.ReplaceAllString(pattern, "/")
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		served[route] = true
+		return nil
+	})
+	var errs []error
+	for route := range util.Config.CacheControl {
+		if !served[route] {
+			errs = append(errs, fmt.Errorf("cache_control.%s matches no route", route))
+		}
+	}
+	for route := range util.Config.Logging.AccessSample {
+		if !served[route] {
+			errs = append(errs, fmt.Errorf("logging.access_sample.%s matches no route", route))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// InitOpenAPIRoutes documents every route registered so far, it has to be called after all the other Init*Routes.
+// A route added without an openapi entry fails startup in development and is reported in production, so do settings
+// keyed by routes which don't exist.
+func InitOpenAPIRoutes() error {
+	err, page, bundle := renderDocs(util.Config.Docs)
+	if err != nil {
+		return err
+	}
+	if bundle != nil {
+		openapi.Hide(http.MethodGet, vendoredRedoc)
+		util.Router.Get(vendoredRedoc, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+			_, _ = w.Write(bundle)
+		})
+	}
+	openapi.Hide(http.MethodGet, "/openapi.json")
+	openapi.Hide(http.MethodGet, "/docs")
+	util.Router.Get("/openapi.json", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		entities.WritePrettyJson(200, w, document)
+	})
+	util.Router.Get("/docs", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(page)
+	})
+	err, document = spec.Build(util.Router)
+	codes := []interface{}{}
+	for _, apiErr := range entities.Catalog() {
+		codes = append(codes, apiErr.Code)
+	}
+	for _, name := range []string{"APIError", "Problem"} {
+		if schema, ok := document.Components.Schemas[name]; ok {
+			schema.Properties["code"].Enum = codes
+		}
+	}
+	return errors.Join(err, unknownRouteKeys(util.Router))
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"errors"
+	"github.com/discordextremelist/api/config"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestEveryRouteIsDocumented fails when a route is served without an openapi entry, or an entry outlives its route.
+func TestEveryRouteIsDocumented(t *testing.T) {
+	if errors.Is(openAPIErr, openapi.UndocumentedRoutes) {
+		t.Fatal(openAPIErr)
+	}
+	if openAPIErr != nil {
+		t.Fatalf("InitOpenAPIRoutes() = %v", openAPIErr)
+	}
+}
+
+func TestUndocumentedRouteIsReported(t *testing.T) {
+	router := chi.NewRouter()
+	router.Mount("/", util.Router)
+	router.Get("/undocumented", func(http.ResponseWriter, *http.Request) {})
+	err, _ := spec.Build(router)
+	if !errors.Is(err, openapi.UndocumentedRoutes) || !strings.Contains(err.Error(), "GET /undocumented") {
+		t.Fatalf("Build() = %v, want GET /undocumented reported", err)
+	}
+}
+
+func TestDocsPinRedoc(t *testing.T) {
+	err, page, bundle := renderDocs(config.Docs{Redoc: "https://cdn.example/redoc.js?a=1&b=2", RedocIntegrity: "sha384-abc"})
+	if err != nil || bundle != nil {
+		t.Fatalf("renderDocs() = %v, %d byte bundle", err, len(bundle))
+	}
+	if want := `<script src="https://cdn.example/redoc.js?a=1&b=2" integrity="sha384-abc" crossorigin="anonymous">`; !strings.Contains(html.UnescapeString(string(page)), want) {
+		t.Fatalf("page doesn't contain %s:\n%s", want, page)
+	}
+	path := filepath.Join(t.TempDir(), "redoc.standalone.js")
+	if err := os.WriteFile(path, []byte("alert(1)"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err, page, bundle = renderDocs(config.Docs{Redoc: path})
+	if err != nil || string(bundle) != "alert(1)" {
+		t.Fatalf("renderDocs() = %v, bundle %q", err, bundle)
+	}
+	// echo -n 'alert(1)' | openssl dgst -sha384 -binary | openssl base64 -A
+	if want := `<script src="/docs/redoc.standalone.js" integrity="sha384-HT2E9NfWiuQ/w1PRai+hTyqW16NIoCGA/m8VQDUopfAtcz6YQjtsMmQd5uRbVDpW" crossorigin="anonymous">`; !strings.Contains(html.UnescapeString(string(page)), want) {
+		t.Fatalf("page doesn't contain %s:\n%s", want, page)
+	}
+	if err, _, _ = renderDocs(config.Docs{Redoc: filepath.Join(t.TempDir(), "missing.js")}); err == nil {
+		t.Fatal("renderDocs() with a missing bundle didn't fail")
+	}
+}
+
+func TestUnknownRouteKeys(t *testing.T) {
+	defer func(control map[string]string) { util.Config.CacheControl = control }(util.Config.CacheControl)
+	util.Config.CacheControl = map[string]string{"/bot/{id}": "no-store", "/bot/{ID}": "no-store"}
+	err := unknownRouteKeys(util.Router)
+	if err == nil || err.Error() != "cache_control./bot/{ID} matches no route" {
+		t.Fatalf("unknownRouteKeys() = %v, want /bot/{ID} reported", err)
+	}
+}
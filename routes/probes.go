@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"github.com/discordextremelist/api/health"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/util"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"net/http"
+	"time"
+)
+
+func latencyCheck(name string, max time.Duration, ping func(ctx context.Context) error) health.Check {
+	return health.Check{Name: name, Run: func(ctx context.Context) error {
+		start := time.Now()
+		if err := ping(ctx); err != nil {
+			return err
+		}
+		if took := time.Since(start); max > 0 && took > max {
+			return fmt.Errorf("ping took %s, over the %s limit", took.Round(time.Millisecond), max)
+		}
+		return nil
+	}}
+}
+
+func redisCheck() health.Check {
+	return latencyCheck("redis", util.Config.Probes.MaxRedisLatency.Duration, func(ctx context.Context) error {
+		return util.Database.Redis.Ping(ctx).Err()
+	})
+}
+
+func mongoCheck() health.Check {
+	return latencyCheck("mongo", util.Config.Probes.MaxMongoLatency.Duration, func(ctx context.Context) error {
+		return util.Database.Mongo.Client().Ping(ctx, readpref.Primary())
+	})
+}
+
+// cacheCheck passes once every warm collection has enough entities in redis to serve lookups without mongo.
+func cacheCheck() health.Check {
+	return health.Check{Name: "cache", Run: func(ctx context.Context) error {
+		min := int64(util.Config.Probes.MinCacheEntries)
+		for _, col := range util.Config.Probes.WarmCollections {
+			size, err := util.Database.Redis.HLen(ctx, col).Result()
+			if err != nil {
+				return err
+			}
+			if size < min {
+				return fmt.Errorf("%s has %d cached entities, need at least %d", col, size, min)
+			}
+		}
+		return nil
+	}}
+}
+
+var pingCheck = health.Check{Name: "ping", Run: func(context.Context) error { return nil }}
+
+// InitProbeRoutes registers the kubernetes probes, outside any ratelimiter so the kubelet can't get itself banned.
+func InitProbeRoutes() {
+	timeout := util.Config.Probes.Timeout.Duration
+	util.Router.Method(http.MethodGet, "/livez", health.NewProbe("livez", timeout, pingCheck))
+	util.Router.Method(http.MethodGet, "/readyz", health.NewProbe("readyz", timeout, pingCheck, redisCheck(), mongoCheck(), cacheCheck()))
+	util.Router.Method(http.MethodGet, "/startupz", health.Latched("startupz", timeout, pingCheck, redisCheck(), mongoCheck(), cacheCheck()))
+	for probe, summary := range map[string]string{
+		"livez":    "Liveness probe",
+		"readyz":   "Readiness probe, checks redis, mongo and that the cache is warm",
+		"startupz": "Startup probe, passes for good once readiness passed",
+	} {
+		openapi.Add(http.MethodGet, "/"+probe, openapi.Route{
+			ID:      probe,
+			Summary: summary,
+			Tags:    []string{"probes"},
+			Params: []openapi.Parameter{
+				openapi.QueryParam("verbose", "List the result of every check.", &openapi.Schema{Type: "boolean"}),
+				openapi.QueryParam("exclude", "Name of a check to skip, can be repeated.", &openapi.Schema{Type: "string"}),
+			},
+			Replies: map[int]openapi.Reply{
+				200: {Description: "Every check passed.", Body: "", ContentType: "text/plain"},
+				503: {Description: "A check failed.", Body: "", ContentType: "text/plain"},
+			},
+		})
+	}
+}
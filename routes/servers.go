@@ -2,40 +2,61 @@ package routes
 
 import (
 	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/openapi"
 	"github.com/discordextremelist/api/ratelimit"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi"
 	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
-	"time"
 )
 
 func GetServer(w http.ResponseWriter, r *http.Request) {
-	err, server := entities.LookupServer(chi.URLParam(r, "id"), true)
+	err, server := entities.LookupServer(r.Context(), chi.URLParam(r, "id"), true)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			entities.NotFound(w, r)
 		} else {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
 		}
 		return
 	}
-	entities.WriteServerResponse(w, server)
+	entities.WriteServerResponse(w, r, server)
 }
 
-func InitServerRoutes() {
-	ratelimiter := ratelimit.NewRatelimiter(ratelimit.RatelimiterOptions{
-		Limit:         10,
-		Reset:         10000,
-		RedisPrefix:   "rl_servers",
-		TempBanLength: 48 * time.Hour,
-		TempBanAfter:  3,
-		PermBanAfter:  2,
-	})
-	util.Router.Route("/server", func(r chi.Router) {
-		r.Use(ratelimiter.Ratelimit)
-		r.Get("/{id}", GetServer)
+func ServersBatch(w http.ResponseWriter, r *http.Request) {
+	ids, ok := entities.DecodeBatch(w, r)
+	if !ok {
+		return
+	}
+	err, servers := entities.LookupServers(r.Context(), ids, true)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.RespondBatch(w, r, ids, servers)
+}
+
+func InitServerRoutes(routers ...chi.Router) {
+	ratelimiter := ratelimit.NewRatelimiter(ratelimit.OptionsFor("servers"))
+	for _, router := range routers {
+		router.Route("/server", func(r chi.Router) {
+			r.Use(ratelimiter.Ratelimit)
+			r.Get("/{id}", GetServer)
+		})
+		router.With(ratelimiter.Ratelimit).Post("/servers/batch", ServersBatch)
+	}
+	openapi.Add(http.MethodPost, "/servers/batch", batchRoute("getServersBatch", "servers"))
+	openapi.Add(http.MethodGet, "/server/{id}", openapi.Route{
+		ID:      "getServer",
+		Summary: "Get a server",
+		Tags:    []string{"servers"},
+		Params:  []openapi.Parameter{openapi.PathParam("id", "The server's id."), fieldsParam},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The server.", Body: &entities.Server{}},
+			400: invalidFields,
+		},
+		Ratelimited: true,
 	})
 }
@@ -1,41 +1,343 @@
 package routes
 
 import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/discordextremelist/api/cache"
 	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/openapi"
 	"github.com/discordextremelist/api/ratelimit"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/trending"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
-	"time"
+	"slices"
 )
 
+// lookupTemplate writes the error response itself when the template can't be looked up.
+func lookupTemplate(w http.ResponseWriter, r *http.Request, id string) (*entities.ServerTemplate, bool) {
+	err, template := entities.LookupTemplate(r.Context(), id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			entities.NotFound(w, r)
+		} else {
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
+		}
+		return nil, false
+	}
+	return template, true
+}
+
 func GetTemplate(w http.ResponseWriter, r *http.Request) {
-	err, template := entities.LookupTemplate(chi.URLParam(r, "id"))
+	if template, ok := lookupTemplate(w, r, chi.URLParam(r, "id")); ok {
+		entities.WriteTemplateResponse(w, r, template)
+	}
+}
+
+func ExportTemplate(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = entities.ExportFormats[0]
+	}
+	if !slices.Contains(entities.ExportFormats, format) {
+		entities.Fail(w, r, entities.UnknownFormatError)
+		return
+	}
+	template, ok := lookupTemplate(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	body, contentType, err := entities.ExportTemplate(template, format)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	// Exports are documents of their own, sent the same on every version.
+	if entities.Precondition(w, r, append(body, contentType...)) {
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="template-%s.%s"`, template.ID, exportExtensions[format]))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+var exportExtensions = map[string]string{"discord": "json", "yaml": "yaml", "terraform": "tf"}
+
+func DiffTemplates(w http.ResponseWriter, r *http.Request) {
+	from, ok := lookupTemplate(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	to, ok := lookupTemplate(w, r, chi.URLParam(r, "other"))
+	if !ok {
+		return
+	}
+	entities.Respond(w, r, 200, entities.DiffTemplates(from, to))
+}
+
+func TemplateStructure(w http.ResponseWriter, r *http.Request) {
+	if template, ok := lookupTemplate(w, r, chi.URLParam(r, "id")); ok {
+		entities.Respond(w, r, 200, entities.NewTemplateStructure(template))
+	}
+}
+
+// WebsiteOnly lets through requests authorised with Config.WebsiteToken.
+func WebsiteOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := util.Config.WebsiteToken
+		if !util.Dev && (token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(util.Authorization)), []byte(token)) != 1) {
+			entities.BadAuth(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type UseResponse struct {
+	UsageCount int `json:"usageCount"`
+}
+
+func UseTemplate(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	ctx, span := tracing.StartMongo(r.Context(), "FindOneAndUpdate", "templates")
+	res := util.Database.Mongo.Collection("templates").FindOneAndUpdate(ctx, bson.M{"_id": id},
+		bson.D{{Key: "$inc", Value: bson.M{"usageCount": 1}}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	// The whole document is cached like the sync does, a copy from before the update could overwrite other changes.
+	var document bson.M
+	var updated struct {
+		UsageCount int `bson:"usageCount"`
+	}
+	err := res.Decode(&document)
+	if err == nil {
+		err = res.Decode(&updated)
+	}
+	tracing.Error(span, err)
+	span.End()
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			entities.NotFound(w, r)
 		} else {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
 		}
 		return
 	}
-	entities.WriteTemplateResponse(w, template)
+	marshaled, err := json.Marshal(&document)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	ctx, span = tracing.StartRedis(r.Context(), "HSET", "templates")
+	_, err = util.Database.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, "templates", id, string(marshaled))
+		pipe.ZAdd(ctx, entities.TemplatesByUsage, &redis.Z{Score: float64(updated.UsageCount), Member: id})
+		return nil
+	})
+	tracing.Error(span, err)
+	span.End()
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	if err = cache.Publish(r.Context(), util.Database.Redis, "templates", id); err != nil {
+		util.CaptureException(r.Context(), err)
+	}
+	// The use is counted either way, it just won't show in trending.
+	if err = trending.Templates.Record(r.Context(), id, 1); err != nil {
+		util.CaptureException(r.Context(), err)
+	}
+	entities.Respond(w, r, 200, UseResponse{UsageCount: updated.UsageCount})
+}
+
+func TrendingTemplates(w http.ResponseWriter, r *http.Request) {
+	entries, ids, ok := trendingIDs(w, r, trending.Templates)
+	if !ok {
+		return
+	}
+	err, templates := entities.LookupTemplates(r.Context(), ids)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	ranked := []RankedTemplate{}
+	for _, entry := range entries {
+		// Deleted templates keep their score until it has decayed.
+		if template, ok := templates[entry.ID]; ok {
+			ranked = append(ranked, RankedTemplate{Score: entry.Score, Template: template})
+		}
+	}
+	entities.Respond(w, r, 200, ranked)
+}
+
+func TopTemplates(w http.ResponseWriter, r *http.Request) {
+	limit, ok := rankingLimit(w, r)
+	if !ok {
+		return
+	}
+	ctx, span := tracing.StartRedis(r.Context(), "ZREVRANGE", entities.TemplatesByUsage)
+	top, err := util.Database.Redis.ZRevRangeWithScores(ctx, entities.TemplatesByUsage, 0, int64(limit-1)).Result()
+	tracing.Error(span, err)
+	span.End()
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.Fail(w, r, entities.GetTemplatesFailed)
+		return
+	}
+	ids := make([]string, len(top))
+	for i, z := range top {
+		ids[i] = z.Member.(string)
+	}
+	err, templates := entities.LookupTemplates(r.Context(), ids)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.Fail(w, r, entities.GetTemplatesFailed)
+		return
+	}
+	ranked := []RankedTemplate{}
+	for _, z := range top {
+		// Deleted templates stay ranked until the next sync.
+		if template, ok := templates[z.Member.(string)]; ok {
+			ranked = append(ranked, RankedTemplate{Score: z.Score, Template: template})
+		}
+	}
+	entities.Respond(w, r, 200, ranked)
 }
 
-func InitTemplateRoutes() {
-	ratelimiter := ratelimit.NewRatelimiter(ratelimit.RatelimiterOptions{
-		Limit:         10,
-		Reset:         10000,
-		RedisPrefix:   "rl_templates",
-		TempBanLength: 48 * time.Hour,
-		TempBanAfter:  3,
-		PermBanAfter:  2,
+func TemplatesBatch(w http.ResponseWriter, r *http.Request) {
+	ids, ok := entities.DecodeBatch(w, r)
+	if !ok {
+		return
+	}
+	err, templates := entities.LookupTemplates(r.Context(), ids)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.RespondBatch(w, r, ids, templates)
+}
+
+func InitTemplateRoutes(routers ...chi.Router) {
+	ratelimiter := ratelimit.NewRatelimiter(ratelimit.OptionsFor("templates"))
+	for _, router := range routers {
+		router.Route("/template", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(ratelimiter.Ratelimit)
+				r.Get("/{id}", GetTemplate)
+				r.Get("/{id}/export", ExportTemplate)
+				r.Get("/{id}/diff/{other}", DiffTemplates)
+				r.Get("/{id}/structure", TemplateStructure)
+			})
+			// Every use on the website goes through here, so it isn't ratelimited per IP.
+			r.With(WebsiteOnly).Post("/{id}/use", UseTemplate)
+		})
+		router.Route("/templates", func(r chi.Router) {
+			r.Use(ratelimiter.Ratelimit)
+			r.Post("/batch", TemplatesBatch)
+			r.Get("/trending", TrendingTemplates)
+			r.Get("/top", TopTemplates)
+		})
+	}
+	openapi.Add(http.MethodPost, "/templates/batch", batchRoute("getTemplatesBatch", "templates"))
+	templateID := openapi.PathParam("id", "The template's id.")
+	openapi.Add(http.MethodGet, "/template/{id}", openapi.Route{
+		ID:      "getTemplate",
+		Summary: "Get a server template",
+		Tags:    []string{"templates"},
+		Params:  []openapi.Parameter{templateID, fieldsParam},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The template.", Body: &entities.ServerTemplate{}},
+			400: invalidFields,
+		},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodGet, "/template/{id}/export", openapi.Route{
+		ID:      "exportTemplate",
+		Summary: "Export a server template",
+		Description: "`discord` is the body of discord's create guild request, `yaml` the same document as YAML and " +
+			"`terraform` a configuration for the Lucky3028/discord provider which applies the template to the server in " +
+			"`var.server_id`. Role ids are placeholders, the index of the role with 0 being @everyone, which overwrites refer to.",
+		Tags: []string{"templates"},
+		Params: []openapi.Parameter{
+			templateID,
+			openapi.QueryParam("format", "One of `discord` (the default), `yaml` or `terraform`.", &openapi.Schema{Type: "string", Enum: []interface{}{"discord", "yaml", "terraform"}}),
+		},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The export, sent as it is on every version. YAML is sent as `application/yaml` and terraform as `text/plain`.", Body: entities.DiscordGuild{}, Raw: true},
+			400: {Description: "The format isn't one of discord, yaml or terraform.", Error: true},
+		},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodGet, "/template/{id}/diff/{other}", openapi.Route{
+		ID:          "diffTemplates",
+		Summary:     "Compare two server templates",
+		Description: "Roles are matched by name, channels by name and type and permission overwrites by the name of their role. Only what differs is listed.",
+		Tags:        []string{"templates"},
+		Params:      []openapi.Parameter{templateID, openapi.PathParam("other", "The id of the template to compare with.")},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "What changed from the first template to the second.", Body: &entities.TemplateDiff{}},
+		},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodGet, "/template/{id}/structure", openapi.Route{
+		ID:      "getTemplateStructure",
+		Summary: "Get a server template's channel tree",
+		Description: "Channels are nested in their categories and sorted like discord shows them. Each lists the " +
+			"permissions every role has in it, worked out from the role's and @everyone's permissions and the channel's " +
+			"overwrites, as if a member only had that role. Member overwrites aren't applied.",
+		Tags:   []string{"templates"},
+		Params: []openapi.Parameter{templateID},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The roles from the top of the hierarchy down and the channel tree.", Body: &entities.TemplateStructure{}},
+		},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodPost, "/template/{id}/use", openapi.Route{
+		ID:          "useTemplate",
+		Summary:     "Record a use of a server template",
+		Description: "Only meant for the website. Increments `usageCount` and counts towards `/templates/trending`.",
+		Tags:        []string{"templates"},
+		Params:      []openapi.Parameter{templateID},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The use was recorded.", Body: UseResponse{}},
+			403: {Description: "The website's token is missing or invalid.", Error: true},
+		},
+		Security: []string{"websiteToken"},
+	})
+	openapi.Add(http.MethodGet, "/templates/trending", openapi.Route{
+		ID:      "getTrendingTemplates",
+		Summary: "Get the templates used most recently",
+		Tags:    []string{"templates"},
+		Params:  []openapi.Parameter{windowParam, limitParam},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The templates with the highest decayed use counts in the window, highest first.", Body: []RankedTemplate{}},
+			400: badRanking,
+		},
+		Ratelimited: true,
 	})
-	util.Router.Route("/template", func(r chi.Router) {
-		r.Use(ratelimiter.Ratelimit)
-		r.Get("/{id}", GetTemplate)
+	openapi.Add(http.MethodGet, "/templates/top", openapi.Route{
+		ID:      "getTopTemplates",
+		Summary: "Get the templates used most of all time",
+		Tags:    []string{"templates"},
+		Params:  []openapi.Parameter{limitParam},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The templates with the highest `usageCount` as of their last use or cache sync, highest first.", Body: []RankedTemplate{}},
+			400: {Description: "The limit is out of range.", Error: true},
+		},
+		Ratelimited: true,
 	})
 }
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"encoding/json"
+	"github.com/discordextremelist/api/entities"
+	"net/http"
+	"testing"
+)
+
+func TestTopTemplatesFromRanking(t *testing.T) {
+	for id, uses := range map[string]float64{"300000000000000001": 5, "300000000000000002": 50, "300000000000000003": 20} {
+		testRedis.HSet("templates", id, `{"_id":"`+id+`","name":"Template"}`)
+		testRedis.ZAdd(entities.TemplatesByUsage, uses, id)
+	}
+	w := serve(http.MethodGet, "/v2/templates/top?limit=2")
+	expectStatus(t, w, http.StatusOK)
+	var body struct {
+		Data []RankedTemplate `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ranked := range body.Data {
+		got = append(got, ranked.Template.ID)
+	}
+	if len(got) != 2 || got[0] != "300000000000000002" || got[1] != "300000000000000003" || body.Data[0].Score != 50 {
+		t.Fatalf("ranked %v, want the two most used templates", body.Data)
+	}
+}
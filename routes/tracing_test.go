@@ -0,0 +1,64 @@
+package routes
+
+import (
+	"github.com/discordextremelist/api/tracing"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"testing"
+)
+
+// traced serves a request and returns the spans it produced.
+func traced(t *testing.T, target string, status int) tracetest.SpanStubs {
+	t.Helper()
+	tracing.Memory.Reset()
+	expectStatus(t, serve(http.MethodGet, target), status)
+	return tracing.Memory.GetSpans()
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	t.Fatalf("no %s span in %v", name, names)
+	return tracetest.SpanStub{}
+}
+
+func expectChild(t *testing.T, child, parent tracetest.SpanStub) {
+	t.Helper()
+	if child.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Fatalf("%s isn't a child of %s", child.Name, parent.Name)
+	}
+}
+
+func TestTracingRedisLookup(t *testing.T) {
+	testRedis.HSet("bots", "100000000000000001", `{"_id":"100000000000000001","name":"Traced"}`)
+	spans := traced(t, "/v2/bot/100000000000000001", http.StatusOK)
+	server := findSpan(t, spans, "GET /v2/bot/{id}/")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Fatalf("%s is a %s span, want server", server.Name, server.SpanKind)
+	}
+	expectChild(t, findSpan(t, spans, "redis.HGET"), server)
+}
+
+func TestTracingCacheFallback(t *testing.T) {
+	spans := traced(t, "/v2/bot/100000000000000002", http.StatusInternalServerError)
+	server := findSpan(t, spans, "GET /v2/bot/{id}/")
+	expectChild(t, findSpan(t, spans, "redis.HGET"), server)
+	fallback := findSpan(t, spans, "cache.fallback")
+	expectChild(t, fallback, server)
+	expectChild(t, findSpan(t, spans, "mongo.FindOne"), fallback)
+}
+
+func TestTracingScan(t *testing.T) {
+	testRedis.HSet("bots", "100000000000000003", `{"_id":"100000000000000003","name":"Scanned"}`)
+	spans := traced(t, "/v2/bots", http.StatusOK)
+	expectChild(t, findSpan(t, spans, "redis.HSCAN"), findSpan(t, spans, "GET /v2/bots/"))
+}
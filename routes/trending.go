@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/trending"
+	"github.com/discordextremelist/api/util"
+	"net/http"
+	"strconv"
+)
+
+type RankedTemplate struct {
+	// Score is the decayed number of uses for trending templates and the total for top templates.
+	Score    float64                  `json:"score"`
+	Template *entities.ServerTemplate `json:"template"`
+}
+
+type RankedBot struct {
+	// Score is the decayed number of servers the bot gained, net of those it lost.
+	Score float64       `json:"score"`
+	Bot   *entities.Bot `json:"bot"`
+}
+
+const defaultRankingLimit = 10
+
+// rankingWindow reads ?window=, which defaults to the first of trending.Windows.
+func rankingWindow(w http.ResponseWriter, r *http.Request) (trending.Window, bool) {
+	name := r.URL.Query().Get("window")
+	if name == "" {
+		return trending.Windows[0], true
+	}
+	window, ok := trending.ParseWindow(name)
+	if !ok {
+		entities.Fail(w, r, entities.UnknownWindowError)
+	}
+	return window, ok
+}
+
+// rankingLimit reads ?limit=, rankings are as long as a batch lookup at most.
+func rankingLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultRankingLimit, true
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > util.Config.MaxBatchSize {
+		entities.Fail(w, r, entities.InvalidLimitError)
+		return 0, false
+	}
+	return limit, true
+}
+
+// trendingIDs returns the ids ranked by tracker in the requested window with their scores.
+func trendingIDs(w http.ResponseWriter, r *http.Request, tracker *trending.Tracker) ([]trending.Entry, []string, bool) {
+	window, ok := rankingWindow(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	limit, ok := rankingLimit(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	err, entries := tracker.Top(r.Context(), window, limit)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return nil, nil, false
+	}
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return entries, ids, true
+}
+
+var (
+	windowParam = openapi.QueryParam("window", "The period to rank over, `24h` (the default), `7d` or `30d`. Scores decay "+
+		"exponentially with the window as their mean lifetime, so steady activity scores about what happens per window.",
+		&openapi.Schema{Type: "string", Enum: []interface{}{"24h", "7d", "30d"}})
+	limitParam = openapi.QueryParam("limit", "How many to rank, 10 by default and at most the maximum batch size.",
+		&openapi.Schema{Type: "integer"})
+	badRanking = openapi.Reply{Description: "The window isn't one of 24h, 7d or 30d, or the limit is out of range.", Error: true}
+)
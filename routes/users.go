@@ -2,41 +2,61 @@ package routes
 
 import (
 	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/openapi"
 	"github.com/discordextremelist/api/ratelimit"
 	"github.com/discordextremelist/api/util"
-	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi"
 	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
-	"time"
 )
 
 func GetUser(w http.ResponseWriter, r *http.Request) {
-	err, user := entities.LookupUser(chi.URLParam(r, "id"), true)
+	err, user := entities.LookupUser(r.Context(), chi.URLParam(r, "id"), true)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			entities.NotFound(w, r)
 		} else {
-			sentry.CaptureException(err)
-			entities.WriteErrorResponse(w)
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
 		}
 		return
 	}
-	entities.WriteUserResponse(w, user)
+	entities.WriteUserResponse(w, r, user)
 }
 
-func InitUserRoutes() {
-	// TODO: Decide on ratelimiting for users
-	ratelimiter := ratelimit.NewRatelimiter(ratelimit.RatelimiterOptions{
-		Limit:         10,
-		Reset:         10000,
-		RedisPrefix:   "rl_users",
-		TempBanLength: 48 * time.Hour,
-		TempBanAfter:  3,
-		PermBanAfter:  2,
-	})
-	util.Router.Route("/user", func(r chi.Router) {
-		r.Use(ratelimiter.Ratelimit)
-		r.Get("/{id}", GetUser)
+func UsersBatch(w http.ResponseWriter, r *http.Request) {
+	ids, ok := entities.DecodeBatch(w, r)
+	if !ok {
+		return
+	}
+	err, users := entities.LookupUsers(r.Context(), ids, true)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.RespondBatch(w, r, ids, users)
+}
+
+func InitUserRoutes(routers ...chi.Router) {
+	ratelimiter := ratelimit.NewRatelimiter(ratelimit.OptionsFor("users"))
+	for _, router := range routers {
+		router.Route("/user", func(r chi.Router) {
+			r.Use(ratelimiter.Ratelimit)
+			r.Get("/{id}", GetUser)
+		})
+		router.With(ratelimiter.Ratelimit).Post("/users/batch", UsersBatch)
+	}
+	openapi.Add(http.MethodPost, "/users/batch", batchRoute("getUsersBatch", "users"))
+	openapi.Add(http.MethodGet, "/user/{id}", openapi.Route{
+		ID:      "getUser",
+		Summary: "Get a user",
+		Tags:    []string{"users"},
+		Params:  []openapi.Parameter{openapi.PathParam("id", "The user's id."), fieldsParam},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The user.", Body: &entities.User{}},
+			400: invalidFields,
+		},
+		Ratelimited: true,
 	})
 }
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-chi/chi"
+)
+
+func versionRouter(version entities.APIVersion) chi.Router {
+	router := chi.NewRouter()
+	router.Use(entities.Version(version), entities.Recoverer)
+	router.NotFound(entities.NotFound)
+	return router
+}
+
+// InitAPIRoutes serves the public API at /v1, /v2 and, answering like /v1 for clients predating versions, the root.
+// Each Init*Routes registers its handlers on every version, sharing one set of ratelimiters between them.
+func InitAPIRoutes() {
+	v1, v2, root := versionRouter(entities.V1), versionRouter(entities.V2), versionRouter(entities.V1)
+	InitGeneralRoutes(v1, v2, root)
+	InitBotRoutes(v1, v2, root)
+	InitUserRoutes(v1, v2, root)
+	InitServerRoutes(v1, v2, root)
+	InitTemplateRoutes(v1, v2, root)
+	InitGraphQLRoutes(v1, v2, root)
+	if util.Config.Features.Events {
+		InitEventRoutes(v1, v2, root)
+	}
+	if util.Config.Features.Webhooks {
+		InitWebhookRoutes(v1, v2, root)
+	}
+	util.Router.Mount("/v1", v1)
+	util.Router.Mount("/v2", v2)
+	util.Router.Mount("/", root)
+}
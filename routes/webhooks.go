@@ -0,0 +1,292 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/discordextremelist/api/entities"
+	"github.com/discordextremelist/api/events"
+	"github.com/discordextremelist/api/openapi"
+	"github.com/discordextremelist/api/ratelimit"
+	"github.com/discordextremelist/api/util"
+	"github.com/discordextremelist/api/webhooks"
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var webhooksRatelimiter *ratelimit.Ratelimiter
+
+type WebhookRequest struct {
+	URL   string   `json:"url" validate:"required,max=2048"`
+	Types []string `json:"types" validate:"max=20"`
+	IDs   []string `json:"ids" validate:"max=100"`
+}
+
+type RedeliverResponse struct {
+	Queued int `json:"queued"`
+}
+
+// webhookOwner returns the id of the bot whose token authorised the request.
+func webhookOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	err, bot := entities.TokenBot(r.Context(), r.Header.Get(util.Authorization))
+	if err != nil {
+		if _, ok := err.(entities.APIError); !ok && err != mongo.ErrNoDocuments {
+			util.CaptureException(r.Context(), err)
+		}
+		entities.BadAuth(w, r)
+		return "", false
+	}
+	return bot.ID, true
+}
+
+// ownedWebhook returns the webhook the route is about, after making sure it belongs to the bot asking.
+func ownedWebhook(w http.ResponseWriter, r *http.Request) (*webhooks.Webhook, bool) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return nil, false
+	}
+	err, webhook := webhooks.Get(r.Context(), owner, chi.URLParam(r, "id"))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			entities.NotFound(w, r)
+		} else {
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
+		}
+		return nil, false
+	}
+	return webhook, true
+}
+
+func Webhooks(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+	err, list := webhooks.List(r.Context(), owner)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.Respond(w, r, 200, list)
+}
+
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+	var body WebhookRequest
+	if !entities.Decode(w, r, &body) {
+		return
+	}
+	if target, err := url.Parse(body.URL); err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		entities.Fail(w, r, entities.ValidationError.WithFields([]entities.FieldError{{Field: "url", Message: "must be an absolute http or https URL"}}))
+		return
+	}
+	if _, unknown := events.ParseFilter(strings.Join(body.Types, ","), ""); len(unknown) > 0 {
+		entities.Fail(w, r, entities.UnknownEventTypeError.With(fmt.Sprintf(
+			"Unknown event types %s, expected an entity or one of %s!", strings.Join(unknown, ", "), strings.Join(events.Types, ", "),
+		)))
+		return
+	}
+	err, count := webhooks.Count(r.Context(), owner)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	if count >= util.Config.Webhooks.MaxPerOwner {
+		entities.Fail(w, r, entities.WebhookLimitError)
+		return
+	}
+	webhook := webhooks.New(owner, body.URL, body.Types, body.IDs)
+	if err := webhooks.Create(r.Context(), webhook); err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.Respond(w, r, 201, webhook)
+}
+
+func Webhook(w http.ResponseWriter, r *http.Request) {
+	if webhook, ok := ownedWebhook(w, r); ok {
+		entities.Respond(w, r, 200, webhooks.Cleanup(webhook))
+	}
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := webhookOwner(w, r)
+	if !ok {
+		return
+	}
+	if err := webhooks.Delete(r.Context(), owner, chi.URLParam(r, "id")); err != nil {
+		if err == mongo.ErrNoDocuments {
+			entities.NotFound(w, r)
+		} else {
+			util.CaptureException(r.Context(), err)
+			entities.WriteErrorResponse(w, r)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	err, attempts := webhooks.Log(r.Context(), webhook.ID)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.Respond(w, r, 200, attempts)
+}
+
+func WebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	err, deliveries := webhooks.DeadLetters(r.Context(), webhook.ID)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.Respond(w, r, 200, deliveries)
+}
+
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := ownedWebhook(w, r)
+	if !ok {
+		return
+	}
+	err, n := webhooks.Redeliver(r.Context(), webhook.ID)
+	if err != nil {
+		util.CaptureException(r.Context(), err)
+		entities.WriteErrorResponse(w, r)
+		return
+	}
+	entities.Respond(w, r, 202, RedeliverResponse{Queued: n})
+}
+
+func InitWebhookRoutes(routers ...chi.Router) {
+	webhooksRatelimiter = ratelimit.NewRatelimiter(ratelimit.OptionsFor("webhooks"))
+	for _, router := range routers {
+		router.Route("/webhooks", func(r chi.Router) {
+			r.Use(webhooksRatelimiter.Ratelimit)
+			r.Get("/", Webhooks)
+			r.Post("/", CreateWebhook)
+		})
+		router.Route("/webhook/{id}", func(r chi.Router) {
+			r.Use(webhooksRatelimiter.Ratelimit)
+			r.Get("/", Webhook)
+			r.Delete("/", DeleteWebhook)
+			r.Get("/deliveries", WebhookDeliveries)
+			r.Get("/dead", WebhookDeadLetters)
+			r.Post("/redeliver", RedeliverWebhook)
+		})
+	}
+	webhookID := openapi.PathParam("id", "The webhook's id.")
+	badAuth := openapi.Reply{Description: "The token is missing or invalid, or the client is banned.", Error: true}
+	openapi.Add(http.MethodGet, "/webhooks", openapi.Route{
+		ID:      "getWebhooks",
+		Summary: "List the bot's webhooks",
+		Tags:    []string{"webhooks"},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The webhooks of the bot the token belongs to, without their secrets.", Body: []webhooks.Webhook{}},
+			403: badAuth,
+		},
+		Security:    []string{"botToken"},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodPost, "/webhooks", openapi.Route{
+		ID:      "createWebhook",
+		Summary: "Register a webhook",
+		Description: "Events matching `types` and `ids`, like the parameters of `/events`, are POSTed to `url` as JSON. " +
+			"Deliveries carry `" + webhooks.SignatureHeader + ": t=<unix seconds>,v1=<signature>`, the hex HMAC-SHA256 " +
+			"of `<t>.<body>` keyed with the webhook's secret. Receivers have to answer with a 2xx, failed deliveries are " +
+			"retried with exponential backoff (honouring `Retry-After`) and dead-lettered after the last attempt.",
+		Tags: []string{"webhooks"},
+		Body: WebhookRequest{},
+		Replies: map[int]openapi.Reply{
+			201: {Description: "The webhook, with the secret deliveries are signed with. It isn't returned again.", Body: &webhooks.Webhook{}},
+			400: {Description: "The body couldn't be decoded, or `types` lists types which don't exist (`unknown_event_type`).", Error: true},
+			403: badAuth,
+			409: {Description: "The bot already has as many webhooks as it may have.", Error: true},
+			413: {Description: "The body is too large.", Error: true},
+			415: {Description: "The body isn't JSON, MessagePack or CBOR.", Error: true},
+			422: {Description: "The URL is missing or not http(s), too many types or ids were given, or the body has unknown fields.", Error: true},
+		},
+		Security:    []string{"botToken"},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodGet, "/webhook/{id}", openapi.Route{
+		ID:      "getWebhook",
+		Summary: "Get a webhook",
+		Tags:    []string{"webhooks"},
+		Params:  []openapi.Parameter{webhookID},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The webhook, without its secret.", Body: &webhooks.Webhook{}},
+			403: badAuth,
+		},
+		Security:    []string{"botToken"},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodDelete, "/webhook/{id}", openapi.Route{
+		ID:          "deleteWebhook",
+		Summary:     "Delete a webhook",
+		Description: "Its delivery log and dead letters are deleted with it, queued deliveries are dropped.",
+		Tags:        []string{"webhooks"},
+		Params:      []openapi.Parameter{webhookID},
+		Replies: map[int]openapi.Reply{
+			204: {Description: "The webhook was deleted."},
+			403: badAuth,
+		},
+		Security:    []string{"botToken"},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodGet, "/webhook/{id}/deliveries", openapi.Route{
+		ID:          "getWebhookDeliveries",
+		Summary:     "Get a webhook's delivery log",
+		Description: "Every attempt is logged with the receiver's status or why it couldn't be reached, only the latest are kept.",
+		Tags:        []string{"webhooks"},
+		Params:      []openapi.Parameter{webhookID},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The latest attempts, newest first.", Body: []webhooks.Attempt{}},
+			403: badAuth,
+		},
+		Security:    []string{"botToken"},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodGet, "/webhook/{id}/dead", openapi.Route{
+		ID:      "getWebhookDeadLetters",
+		Summary: "Get a webhook's dead letters",
+		Tags:    []string{"webhooks"},
+		Params:  []openapi.Parameter{webhookID},
+		Replies: map[int]openapi.Reply{
+			200: {Description: "The latest deliveries which ran out of attempts, newest first.", Body: []webhooks.Delivery{}},
+			403: badAuth,
+		},
+		Security:    []string{"botToken"},
+		Ratelimited: true,
+	})
+	openapi.Add(http.MethodPost, "/webhook/{id}/redeliver", openapi.Route{
+		ID:      "redeliverWebhook",
+		Summary: "Retry a webhook's dead letters",
+		Tags:    []string{"webhooks"},
+		Params:  []openapi.Parameter{webhookID},
+		Replies: map[int]openapi.Reply{
+			202: {Description: "The dead letters were queued again with a fresh set of attempts.", Body: RedeliverResponse{}},
+			403: badAuth,
+		},
+		Security:    []string{"botToken"},
+		Ratelimited: true,
+	})
+}
@@ -0,0 +1,135 @@
+package trending
+
+import (
+	"context"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-redis/redis/v8"
+	"math"
+	"time"
+)
+
+// Window is a period entities are ranked over. Counts decay exponentially with the window as their mean lifetime, so
+// something happening at a steady rate scores about as often as it happens per window.
+type Window struct {
+	Name     string
+	Lifetime time.Duration
+}
+
+// Windows are the windows every tracker keeps, the first is the default.
+var Windows = []Window{
+	{Name: "24h", Lifetime: 24 * time.Hour},
+	{Name: "7d", Lifetime: 7 * 24 * time.Hour},
+	{Name: "30d", Lifetime: 30 * 24 * time.Hour},
+}
+
+func ParseWindow(name string) (Window, bool) {
+	for _, window := range Windows {
+		if window.Name == name {
+			return window, true
+		}
+	}
+	return Window{}, false
+}
+
+// Tracker ranks the entities of a collection by how much happened to them recently, e.g. templates by their uses or
+// bots by the servers they gained.
+type Tracker struct {
+	name string
+}
+
+var (
+	Templates = New("templates")
+	Bots      = New("bots")
+)
+
+func New(name string) *Tracker {
+	return &Tracker{name: name}
+}
+
+// Entry is an entity's decayed score in a window.
+type Entry struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+}
+
+// key is the sorted set of a window. Scores are stored forward decayed: an amount recorded at t is added as
+// amount*e^((t-epoch)/lifetime), so older amounts shrink relative to newer ones without touching them and ranks are
+// those of the decayed scores. Dividing by e^((now-epoch)/lifetime) gives the decayed score itself.
+func (t *Tracker) key(window Window) string {
+	return "trending:" + t.name + ":" + window.Name
+}
+
+func (t *Tracker) epochKey(window Window) string {
+	return "trending_epoch:" + t.name + ":" + window.Name
+}
+
+// recordScript adds ARGV[2] to ARGV[1] in every window, KEYS being pairs of a window's set and epoch and ARGV[4:] the
+// windows' lifetimes. When the factor grows too large for floats to stay precise, the set is scaled down and its
+// epoch moved to now, dropping what has decayed to nothing.
+var recordScript = redis.NewScript(`
+local now = tonumber(ARGV[3])
+for i = 1, #KEYS, 2 do
+	local epoch = tonumber(redis.call('GET', KEYS[i + 1]))
+	if not epoch then
+		epoch = now
+		redis.call('SET', KEYS[i + 1], epoch)
+	end
+	local age = (now - epoch) / tonumber(ARGV[3 + (i + 1) / 2])
+	if age > 20 then
+		redis.call('ZUNIONSTORE', KEYS[i], 1, KEYS[i], 'WEIGHTS', math.exp(-age))
+		redis.call('ZREMRANGEBYSCORE', KEYS[i], '(-0.01', '(0.01')
+		redis.call('SET', KEYS[i + 1], now)
+		age = 0
+	end
+	redis.call('ZINCRBY', KEYS[i], tonumber(ARGV[2]) * math.exp(age), ARGV[1])
+end
+return 1
+`)
+
+// Record adds amount to id in every window, amounts may be negative, e.g. for servers a bot lost.
+func (t *Tracker) Record(ctx context.Context, id string, amount float64) error {
+	ctx, span := tracing.StartRedis(ctx, "EVALSHA", "trending:"+t.name)
+	defer span.End()
+	keys := make([]string, 0, 2*len(Windows))
+	args := []interface{}{id, amount, unix(time.Now())}
+	for _, window := range Windows {
+		keys = append(keys, t.key(window), t.epochKey(window))
+		args = append(args, window.Lifetime.Seconds())
+	}
+	err := recordScript.Run(ctx, util.Database.Redis, keys, args...).Err()
+	tracing.Error(span, err)
+	return err
+}
+
+// Top returns the n entities with the highest positive scores in window, highest first.
+func (t *Tracker) Top(ctx context.Context, window Window, n int) (error, []Entry) {
+	ctx, span := tracing.StartRedis(ctx, "ZREVRANGEBYSCORE", t.key(window))
+	defer span.End()
+	var epoch *redis.StringCmd
+	var top *redis.ZSliceCmd
+	_, err := util.Database.Redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		epoch = pipe.Get(ctx, t.epochKey(window))
+		top = pipe.ZRevRangeByScoreWithScores(ctx, t.key(window), &redis.ZRangeBy{Min: "(0", Max: "+inf", Count: int64(n)})
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		tracing.Error(span, err)
+		return err, nil
+	}
+	entries := []Entry{}
+	since, err := epoch.Float64()
+	if err != nil {
+		// Nothing was recorded yet.
+		return nil, entries
+	}
+	scale := math.Exp(-(unix(time.Now()) - since) / window.Lifetime.Seconds())
+	for _, z := range top.Val() {
+		entries = append(entries, Entry{ID: z.Member.(string), Score: math.Round(z.Score*scale*1000) / 1000})
+	}
+	return nil, entries
+}
+
+func unix(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
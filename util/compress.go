@@ -0,0 +1,204 @@
+package util
+
+import (
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Encodings are the supported content codings, encoders are pooled as they are expensive to allocate.
+var Encodings = map[string]*sync.Pool{
+	"zstd": {New: func() interface{} {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1<<20))
+		return enc
+	}},
+	"br": {New: func() interface{} {
+		return brotli.NewWriterLevel(nil, 4)
+	}},
+	"gzip": {New: func() interface{} {
+		enc, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return enc
+	}},
+}
+
+var compressibleTypes = []string{"application/json", "application/problem+json", "application/x-ndjson", "application/msgpack", "application/cbor", "text/"}
+
+// negotiate picks the coding with the highest q-value in the Accept-Encoding header, ties go to the earliest in
+// preferred. It returns an empty string when the response should be sent as is.
+func negotiate(header string, preferred []string) string {
+	if header == "" {
+		return ""
+	}
+	weights := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		weights[strings.ToLower(strings.TrimSpace(coding))] = q
+	}
+	best, bestQ := "", 0.0
+	for _, coding := range preferred {
+		q, ok := weights[coding]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+func compressible(status int, header http.Header) bool {
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds back the start of a response until it knows whether it is worth compressing, that is when
+// MinBytes were written or the handler flushed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	min      int
+	status   int
+	buffer   []byte
+	decided  bool
+	encoder  encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buffer = append(cw.buffer, p...)
+		if len(cw.buffer) < cw.min {
+			return len(p), nil
+		}
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *compressWriter) start(worthIt bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if cw.status == http.StatusNotModified {
+		header.Add("Vary", "Accept-Encoding")
+	} else if compressible(cw.status, header) {
+		header.Add("Vary", "Accept-Encoding")
+		if worthIt {
+			header.Set("Content-Encoding", cw.encoding)
+			header.Del("Content-Length")
+			// The compressed bytes differ from what the tag was computed from, weak tags still match on revalidation.
+			if tag := header.Get("ETag"); strings.HasPrefix(tag, `"`) {
+				header.Set("ETag", "W/"+tag)
+			}
+			cw.encoder = Encodings[cw.encoding].Get().(encoder)
+			cw.encoder.Reset(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buffered := cw.buffer
+	cw.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buffered)
+	} else {
+		_, err = cw.ResponseWriter.Write(buffered)
+	}
+	return err
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		if cw.start(true) != nil {
+			return
+		}
+	}
+	if cw.encoder != nil && cw.encoder.Flush() != nil {
+		return
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 {
+			return
+		}
+		if cw.start(false) != nil {
+			return
+		}
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+		cw.encoder.Reset(nil)
+		Encodings[cw.encoding].Put(cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+// Compress encodes responses with the best coding both the client and Config.Compression.Encodings accept. Responses
+// smaller than Config.Compression.MinBytes which aren't flushed early are sent as they are. Upgrades, i.e. WebSockets,
+// are left alone since they take over the connection.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiate(r.Header.Get("Accept-Encoding"), Config.Compression.Encodings)
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, min: Config.Compression.MinBytes}
+		// Not deferred, after a panic the recoverer writes the error response instead of what was buffered.
+		next.ServeHTTP(cw, r)
+		cw.close()
+	})
+}
@@ -3,39 +3,122 @@ package util
 import (
 	"context"
 	"errors"
+	"fmt"
+	"github.com/discordextremelist/api/config"
 	"github.com/getsentry/sentry-go"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"net/http"
 	"os"
+	"strings"
 )
 
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
 var (
 	UnknownPod = errors.New("unknown pod")
 	Client     *kubernetes.Clientset
 	Node       string
+	Pod        string
+	Namespace  string
+	Zone       string
+	Region     string
 )
 
-func BuildClient() {
-	config, _ := rest.InClusterConfig()
+func BuildClient() error {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return err
+	}
 	client, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		sentry.CaptureException(err)
-		logrus.Errorf("Failed to create a Kubernetes API Client: %v", err)
+		return err
 	}
 	Client = client
 	logrus.Info("Kubernetes API Client built successfully!")
+	return nil
+}
+
+func podNamespace(cfg config.Kubernetes) string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if cfg.Namespace != "" {
+		return cfg.Namespace
+	}
+	if namespace, err := os.ReadFile(serviceAccountNamespace); err == nil {
+		return strings.TrimSpace(string(namespace))
+	}
+	return ""
 }
 
-func FindKubernetesNode() error {
-	host, _ := os.Hostname()
-	pod, err := Client.CoreV1().Pods("del").Get(context.TODO(), host, v1.GetOptions{})
+// FindKubernetesNode works out which pod, node, zone and region this replica runs on. The downward API env vars
+// (NODE_NAME, POD_NAME, POD_NAMESPACE, NODE_ZONE, NODE_REGION) are preferred, the kubernetes API is only asked for
+// what they leave out.
+func FindKubernetesNode(cfg config.Kubernetes) error {
+	Pod = os.Getenv("POD_NAME")
+	if Pod == "" {
+		Pod, _ = os.Hostname()
+	}
+	Namespace = podNamespace(cfg)
+	Node = os.Getenv("NODE_NAME")
+	Zone = os.Getenv("NODE_ZONE")
+	Region = os.Getenv("NODE_REGION")
+	if Node != "" && Zone != "" && Region != "" {
+		return nil
+	}
+	if Client == nil {
+		if err := BuildClient(); err != nil {
+			if errors.Is(err, rest.ErrNotInCluster) && Node != "" {
+				// zone and region are a nice to have, there is nothing to ask for them outside a cluster
+				return nil
+			}
+			return fmt.Errorf("%w: building kubernetes client: %v", UnknownPod, err)
+		}
+	}
+	if Node == "" {
+		if Namespace == "" {
+			return fmt.Errorf("%w: no namespace configured and POD_NAMESPACE isn't set", UnknownPod)
+		}
+		pod, err := Client.CoreV1().Pods(Namespace).Get(context.TODO(), Pod, v1.GetOptions{})
+		if err != nil {
+			sentry.CaptureException(err)
+			return fmt.Errorf("%w: fetching pod %s/%s: %v", UnknownPod, Namespace, Pod, err)
+		}
+		Node = pod.Spec.NodeName
+	}
+	node, err := Client.CoreV1().Nodes().Get(context.TODO(), Node, v1.GetOptions{})
 	if err != nil {
-		sentry.CaptureException(err)
-		logrus.Errorf("Failed fetching pod info: %v", err)
-		return UnknownPod
+		// reading nodes needs a cluster role, not having one shouldn't stop us from knowing the node name
+		logrus.Warnf("Failed to fetch labels of node %s: %v", Node, err)
+		return nil
+	}
+	if Zone == "" {
+		Zone = node.Labels[corev1.LabelTopologyZone]
+	}
+	if Region == "" {
+		Region = node.Labels[corev1.LabelTopologyRegion]
 	}
-	Node = pod.Spec.NodeName
 	return nil
 }
+
+// Replica adds headers identifying the pod, node, zone and region which served the request.
+func Replica(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers := w.Header()
+		for header, value := range map[string]string{
+			"X-Served-By": Pod,
+			"X-Node":      Node,
+			"X-Zone":      Zone,
+			"X-Region":    Region,
+		} {
+			if value != "" {
+				headers.Set(header, value)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
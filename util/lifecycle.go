@@ -0,0 +1,38 @@
+package util
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var (
+	// Context is cancelled once the server has stopped accepting requests, background workers should return when it is done.
+	Context, stop = context.WithCancel(context.Background())
+	workers       = &sync.WaitGroup{}
+)
+
+// Go runs worker in a goroutine which is waited on during shutdown.
+func Go(worker func(ctx context.Context)) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		worker(Context)
+	}()
+}
+
+// StopWorkers cancels Context and waits up to timeout for every worker started with Go to return.
+func StopWorkers(timeout time.Duration) bool {
+	stop()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
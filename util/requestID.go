@@ -0,0 +1,67 @@
+package util
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	requestIDKey       contextKey = "request_id"
+	maxRequestIDLength            = 128
+)
+
+var XRequestID = http.CanonicalHeaderKey("X-Request-ID")
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID propagates a valid incoming X-Request-ID or generates one and echoes it in the response.
+func RequestID(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(XRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(XRequestID, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Log returns a logger carrying the request and trace id of ctx, if any.
+func Log(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+	if id := RequestIDFrom(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+		entry = entry.WithField("trace_id", span.TraceID().String())
+	}
+	return entry
+}
@@ -1,21 +1,58 @@
 package util
 
 import (
+	"context"
+	"errors"
+	"github.com/discordextremelist/api/config"
 	"github.com/getsentry/sentry-go"
 	"github.com/sirupsen/logrus"
 	"net/url"
-	"os"
 )
 
-func InitSentry() {
-	uri, err := url.Parse(os.Getenv("SENTRY"))
+// InitSentry configures the sentry client, leaving the no-op default in place when no DSN is set.
+func InitSentry(cfg config.Sentry) {
+	if cfg.DSN == "" {
+		logrus.Info("No sentry DSN set, integration disabled!")
+		return
+	}
+	if cfg.SampleRate == 0 {
+		// the SDK treats a sample rate of 0 as 1, so don't initialise it at all
+		logrus.Info("Sentry sample rate is 0, integration disabled!")
+		return
+	}
+	uri, err := url.Parse(cfg.DSN)
 	if err != nil {
 		logrus.Errorf("Failed to parse sentry URL: %v, integration disabled!", err)
 		return
 	}
-	err = sentry.Init(sentry.ClientOptions{Dsn: uri.String()})
+	environment := cfg.Environment
+	if environment == "" {
+		environment = "production"
+		if Dev {
+			environment = "development"
+		}
+	}
+	err = sentry.Init(sentry.ClientOptions{
+		Dsn:         uri.String(),
+		Environment: environment,
+		SampleRate:  cfg.SampleRate,
+	})
 	if err != nil {
-		logrus.Errorf("Failed to initialise sentry: %v", err)
+		logrus.Errorf("Failed to initialise sentry: %v, integration disabled!", err)
+		return
+	}
+	logrus.Infof("Sentry configured for environment %s!", environment)
+}
+
+// CaptureException reports err on the request's hub when ctx carries one, so the event is tagged with its request id.
+// Cancellations, i.e. clients which went away, aren't reported.
+func CaptureException(ctx context.Context, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub()
 	}
-	logrus.Info("Sentry configured!")
+	hub.CaptureException(err)
 }
@@ -2,30 +2,36 @@ package util
 
 import (
 	"context"
+	"github.com/discordextremelist/api/config"
 	"github.com/discordextremelist/api/database"
-	"github.com/getsentry/sentry-go"
+	"github.com/discordextremelist/api/tracing"
 	"github.com/go-chi/chi"
-	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"k8s.io/apimachinery/pkg/util/json"
 )
 
 var (
 	Database = database.NewManager()
+	Config   = config.Defaults()
 	Router   chi.Router
 	Dev      bool
 )
 
-func Scan[T any](key string) map[string]T {
+// Scan decodes every entry of the hash at key, entries which can't be decoded are skipped. It stops at the first error
+// of redis, e.g. when ctx is cancelled.
+func Scan[T any](ctx context.Context, key string) (error, map[string]T) {
+	ctx, span := tracing.StartRedis(ctx, "HSCAN", key)
+	defer span.End()
 	m := make(map[string]T)
 	var cursor uint64 = 0
+	pages := 0
 	for {
-		res := Database.Redis.HScan(context.TODO(), key, cursor, "", 0)
-		if res.Err() != nil {
-			sentry.CaptureException(res.Err())
-			logrus.Errorf("Scan failed: %v", res.Err())
-			continue
+		pages++
+		keys, c, err := Database.Redis.HScan(ctx, key, cursor, "", 0).Result()
+		if err != nil {
+			tracing.Error(span, err)
+			return err, nil
 		}
-		keys, c, _ := res.Result()
 		l := len(keys)
 		for i := 0; i < l; i += 2 {
 			end := i + 2
@@ -45,5 +51,39 @@ func Scan[T any](key string) map[string]T {
 			break
 		}
 	}
-	return m
+	span.SetAttributes(attribute.Int("db.redis.pages", pages), attribute.Int("db.redis.entries", len(m)))
+	return nil, m
+}
+
+// scanPageSize is the amount of entries ScanEach asks redis for at once.
+const scanPageSize = 500
+
+// ScanEach calls fn with the field and raw value of every entry of the hash at key a page at a time, so the hash is
+// never held in memory as a whole. It stops at the first error of redis or fn.
+func ScanEach(ctx context.Context, key string, fn func(field, value string) error) error {
+	ctx, span := tracing.StartRedis(ctx, "HSCAN", key)
+	defer span.End()
+	var cursor uint64 = 0
+	pages, entries := 0, 0
+	defer func() {
+		span.SetAttributes(attribute.Int("db.redis.pages", pages), attribute.Int("db.redis.entries", entries))
+	}()
+	for {
+		pages++
+		keys, c, err := Database.Redis.HScan(ctx, key, cursor, "", scanPageSize).Result()
+		if err != nil {
+			tracing.Error(span, err)
+			return err
+		}
+		for i := 0; i+1 < len(keys); i += 2 {
+			entries++
+			if err = fn(keys[i], keys[i+1]); err != nil {
+				return err
+			}
+		}
+		cursor = c
+		if c == 0 {
+			return nil
+		}
+	}
 }
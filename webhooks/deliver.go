@@ -0,0 +1,209 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/discordextremelist/api/metrics"
+	"github.com/discordextremelist/api/util"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-DEL-Signature"
+	EventHeader     = "X-DEL-Event"
+	DeliveryHeader  = "X-DEL-Delivery"
+	WebhookHeader   = "X-DEL-Webhook"
+)
+
+var ForbiddenAddress = errors.New("webhooks may not be delivered to private addresses")
+
+// Sign returns the signature header of a delivery, "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Receivers
+// recompute it with their secret and should reject old timestamps to prevent replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// guard refuses to connect to loopback, private and link-local addresses unless they are allowed. It runs after DNS
+// was resolved, so names pointing at them are refused too.
+func guard(_, address string, _ syscall.RawConn) error {
+	if util.Config.Webhooks.AllowPrivateNetworks {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return ForbiddenAddress
+	}
+	return nil
+}
+
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: util.Config.Webhooks.Timeout.Duration, Control: guard}
+	return &http.Client{
+		Timeout: util.Config.Webhooks.Timeout.Duration,
+		// Receivers are expected to answer themselves, redirects count as failures.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: util.Config.Webhooks.Timeout.Duration,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// backoff is the wait before the attempt after attempts failed ones.
+func backoff(attempts int) time.Duration {
+	opts := util.Config.Webhooks
+	wait := opts.Backoff.Duration
+	for i := 1; i < attempts && wait < opts.MaxBackoff.Duration; i++ {
+		wait *= 2
+	}
+	return min(wait, opts.MaxBackoff.Duration)
+}
+
+func parseRetryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// send posts a delivery to webhook, it returns the receiver's status and how long it asks to wait before a retry.
+func send(ctx context.Context, client *http.Client, webhook *Webhook, delivery Delivery) (int, time.Duration, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DEL-Webhooks/1.0")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, time.Now().Unix(), body))
+	req.Header.Set(EventHeader, delivery.Event.Type)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(WebhookHeader, webhook.ID)
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, parseRetryAfter(res.Header.Get("Retry-After")), fmt.Errorf("receiver answered %s", res.Status)
+	}
+	return res.StatusCode, 0, nil
+}
+
+// deliver tries a delivery once and records the attempt, failed ones are queued again or dead-lettered.
+func deliver(ctx context.Context, client *http.Client, delivery Delivery) {
+	err, webhook := Get(ctx, "", delivery.WebhookID)
+	if err == mongo.ErrNoDocuments {
+		if err := done(ctx, delivery); err != nil {
+			util.CaptureException(ctx, err)
+		}
+		return
+	} else if err != nil {
+		// Left claimed, it is tried again once the lease runs out.
+		util.CaptureException(ctx, err)
+		return
+	}
+	deliverTo(ctx, client, webhook, delivery)
+}
+
+// deliverTo sends a delivery to webhook once and records the attempt.
+func deliverTo(ctx context.Context, client *http.Client, webhook *Webhook, delivery Delivery) {
+	start := time.Now()
+	status, retryAfter, err := send(ctx, client, webhook, delivery)
+	delivery.Attempts++
+	attempt := Attempt{
+		DeliveryID: delivery.ID,
+		EventID:    delivery.Event.ID,
+		EventType:  delivery.Event.Type,
+		Attempt:    delivery.Attempts,
+		Time:       start.UnixMilli(),
+		Duration:   time.Since(start).Milliseconds(),
+		Status:     status,
+	}
+	switch {
+	case err == nil:
+		attempt.Outcome = "delivered"
+		err = done(ctx, delivery)
+	case delivery.Attempts >= util.Config.Webhooks.MaxAttempts:
+		attempt.Outcome, attempt.Error = "dead", err.Error()
+		if err = push(ctx, deadKey(webhook.ID), delivery); err == nil {
+			err = done(ctx, delivery)
+		}
+	default:
+		attempt.Outcome, attempt.Error = "retrying", err.Error()
+		next := start.Add(max(backoff(delivery.Attempts), min(retryAfter, util.Config.Webhooks.MaxBackoff.Duration)))
+		attempt.NextAttempt = next.UnixMilli()
+		err = enqueue(ctx, delivery, next)
+	}
+	metrics.WebhookDeliveries.WithLabelValues(attempt.Outcome).Inc()
+	if err != nil {
+		util.CaptureException(ctx, err)
+	}
+	if err := push(ctx, logKey(webhook.ID), attempt); err != nil {
+		util.CaptureException(ctx, err)
+	}
+}
+
+// Deliver sends the deliveries which are due from the queue shared by every replica until ctx is cancelled, each is
+// sent by one replica at a time.
+func Deliver(ctx context.Context) {
+	client := newClient()
+	workers := util.Config.Webhooks.Workers
+	// Long enough for a slow receiver and recording the attempt, after which another replica may take over.
+	lease := 2*util.Config.Webhooks.Timeout.Duration + 10*time.Second
+	log.WithField("workers", workers).Info("Delivering webhooks")
+	for {
+		err, deliveries := claim(ctx, workers, lease)
+		if err != nil && ctx.Err() == nil {
+			util.CaptureException(ctx, err)
+		}
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Not cut short by shutdown, a delivery which was sent gets recorded.
+				deliver(context.WithoutCancel(ctx), client, delivery)
+			}()
+		}
+		wg.Wait()
+		// A full batch means more are probably due.
+		if len(deliveries) == workers {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
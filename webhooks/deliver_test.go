@@ -0,0 +1,176 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"github.com/discordextremelist/api/events"
+	"github.com/discordextremelist/api/util"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// receiver serves webhook deliveries with handler, it is reachable as private networks are allowed.
+func receiver(t *testing.T, handler http.HandlerFunc) *Webhook {
+	t.Helper()
+	reset()
+	util.Config.Webhooks.AllowPrivateNetworks = true
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &Webhook{ID: "webhook", URL: server.URL, Secret: "DELWH_secret"}
+}
+
+func answer(status int, retryAfter string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+	}
+}
+
+func testDelivery(attempts int) Delivery {
+	return Delivery{
+		ID:        "delivery",
+		WebhookID: "webhook",
+		Event:     events.Event{ID: "event", Type: "bot.approved", EntityID: "1"},
+		Attempts:  attempts,
+	}
+}
+
+// outcome returns the outcome of the latest attempt.
+func outcome(t *testing.T) Attempt {
+	t.Helper()
+	err, attempts := Log(context.Background(), "webhook")
+	if err != nil || len(attempts) == 0 {
+		t.Fatalf("Log() = %v, %+v, want the attempt recorded", err, attempts)
+	}
+	return attempts[0]
+}
+
+// expectDue fails unless the delivery is queued again about wait from now.
+func expectDue(t *testing.T, wait time.Duration) {
+	t.Helper()
+	score, err := testRedis.ZScore(queueKey, "delivery")
+	if err != nil {
+		t.Fatalf("the delivery isn't queued: %v", err)
+	}
+	due := time.UnixMilli(int64(score))
+	if expected := time.Now().Add(wait); due.Before(expected.Add(-5*time.Second)) || due.After(expected.Add(time.Second)) {
+		t.Fatalf("due in %s, want %s", time.Until(due).Round(time.Second), wait)
+	}
+}
+
+func TestSign(t *testing.T) {
+	signature := Sign("secret", 1700000000, []byte(`{"id":"event"}`))
+	timestamp, mac, ok := strings.Cut(signature, ",v1=")
+	if !ok || timestamp != "t=1700000000" || len(mac) != 64 {
+		t.Fatalf("Sign() = %q, want t=<unix seconds>,v1=<hex sha256>", signature)
+	}
+	if Sign("secret", 1700000000, []byte(`{"id":"other"}`)) == signature {
+		t.Fatal("the signature doesn't cover the body")
+	}
+	if Sign("other", 1700000000, []byte(`{"id":"event"}`)) == signature {
+		t.Fatal("the signature doesn't depend on the secret")
+	}
+}
+
+func TestDeliverySignature(t *testing.T) {
+	verified := make(chan bool, 1)
+	webhook := receiver(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		header := r.Header.Get(SignatureHeader)
+		timestamp, _, _ := strings.Cut(strings.TrimPrefix(header, "t="), ",")
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		// What a receiver does: recompute the signature with its secret and compare in constant time.
+		verified <- err == nil && time.Since(time.Unix(unix, 0)) < time.Minute &&
+			hmac.Equal([]byte(header), []byte(Sign("DELWH_secret", unix, body))) &&
+			r.Header.Get(EventHeader) == "bot.approved" && r.Header.Get(DeliveryHeader) == "delivery" &&
+			r.Header.Get(WebhookHeader) == "webhook"
+	})
+	deliverTo(context.Background(), newClient(), webhook, testDelivery(0))
+	if !<-verified {
+		t.Fatal("the receiver couldn't verify the delivery")
+	}
+}
+
+func TestDelivered(t *testing.T) {
+	webhook := receiver(t, answer(http.StatusNoContent, ""))
+	ctx := context.Background()
+	if err := enqueue(ctx, testDelivery(0), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	deliverTo(ctx, newClient(), webhook, testDelivery(0))
+	if attempt := outcome(t); attempt.Outcome != "delivered" || attempt.Status != http.StatusNoContent {
+		t.Fatalf("attempt = %+v, want it delivered", attempt)
+	}
+	if testRedis.Exists(queueKey) || testRedis.Exists(deliveriesKey) {
+		t.Fatal("the delivery is still queued")
+	}
+}
+
+func TestRetryBacksOff(t *testing.T) {
+	webhook := receiver(t, answer(http.StatusInternalServerError, ""))
+	deliverTo(context.Background(), newClient(), webhook, testDelivery(2))
+	if attempt := outcome(t); attempt.Outcome != "retrying" || attempt.Attempt != 3 {
+		t.Fatalf("attempt = %+v, want the third retrying", attempt)
+	}
+	// Doubled for each of the three failed attempts but the first.
+	expectDue(t, 4*util.Config.Webhooks.Backoff.Duration)
+}
+
+func TestRetryAfter(t *testing.T) {
+	webhook := receiver(t, answer(http.StatusServiceUnavailable, "120"))
+	deliverTo(context.Background(), newClient(), webhook, testDelivery(0))
+	expectDue(t, 2*time.Minute)
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+	webhook := receiver(t, answer(http.StatusTooManyRequests, strconv.Itoa(7*24*60*60)))
+	deliverTo(context.Background(), newClient(), webhook, testDelivery(0))
+	expectDue(t, util.Config.Webhooks.MaxBackoff.Duration)
+}
+
+func TestDeadLetter(t *testing.T) {
+	webhook := receiver(t, answer(http.StatusBadGateway, ""))
+	ctx := context.Background()
+	deliverTo(ctx, newClient(), webhook, testDelivery(util.Config.Webhooks.MaxAttempts-1))
+	if attempt := outcome(t); attempt.Outcome != "dead" {
+		t.Fatalf("attempt = %+v, want it dead", attempt)
+	}
+	if testRedis.Exists(queueKey) {
+		t.Fatal("a dead delivery is still queued")
+	}
+	err, dead := DeadLetters(ctx, "webhook")
+	if err != nil || len(dead) != 1 || dead[0].Attempts != util.Config.Webhooks.MaxAttempts {
+		t.Fatalf("DeadLetters() = %v, %+v, want the delivery with every attempt", err, dead)
+	}
+}
+
+func TestGuard(t *testing.T) {
+	var reached atomic.Bool
+	webhook := receiver(t, func(w http.ResponseWriter, r *http.Request) { reached.Store(true) })
+	util.Config.Webhooks.AllowPrivateNetworks = false
+	_, _, err := send(context.Background(), newClient(), webhook, testDelivery(0))
+	if !errors.Is(err, ForbiddenAddress) || reached.Load() {
+		t.Fatalf("send() = %v, want loopback refused", err)
+	}
+	for _, address := range []string{"10.0.0.1:443", "169.254.169.254:80", "[::1]:443", "0.0.0.0:80"} {
+		if err := guard("tcp", address, nil); err != ForbiddenAddress {
+			t.Errorf("guard(%s) = %v, want it refused", address, err)
+		}
+	}
+	if err := guard("tcp", "192.0.2.1:443", nil); err != nil {
+		t.Errorf("guard(192.0.2.1) = %v, want a public address allowed", err)
+	}
+	util.Config.Webhooks.AllowPrivateNetworks = true
+	if _, _, err := send(context.Background(), newClient(), webhook, testDelivery(0)); err != nil || !reached.Load() {
+		t.Fatalf("send() = %v, want loopback allowed with private networks", err)
+	}
+}
@@ -0,0 +1,76 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"github.com/discordextremelist/api/events"
+	"github.com/discordextremelist/api/util"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	// claimPrefix keys mark deliveries already queued, every replica receives every event.
+	claimPrefix = "webhook_event:"
+	claimTTL    = 10 * time.Minute
+	// dispatchBuffer is how many events may wait for their webhooks to be looked up.
+	dispatchBuffer = 1024
+)
+
+// queue adds a delivery of event to every webhook it matches, unless another replica already did. Each webhook is
+// claimed on its own after matching, so a replica failing to look the webhooks up doesn't keep the others from
+// queueing them.
+func queue(ctx context.Context, event events.Event) error {
+	err, webhooks := matching(ctx, event)
+	if err != nil {
+		return err
+	}
+	return queueTo(ctx, event, webhooks)
+}
+
+func queueTo(ctx context.Context, event events.Event, webhooks []Webhook) error {
+	var errs []error
+	for _, webhook := range webhooks {
+		key := claimPrefix + event.ID + ":" + webhook.ID
+		claimed, err := util.Database.Redis.SetNX(ctx, key, util.Pod, claimTTL).Result()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		delivery := Delivery{ID: random(12), WebhookID: webhook.ID, Event: event}
+		if err := enqueue(ctx, delivery, time.Now()); err != nil {
+			// Released so a replica which gets to the event later still queues it.
+			util.Database.Redis.Del(ctx, key)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Dispatch queues deliveries for the events published by any replica until ctx is cancelled. It needs
+// events.Listen running.
+func Dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		sub := events.Subscribe(events.Filter{}, dispatchBuffer)
+		func() {
+			defer sub.Close()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event, ok := <-sub.Events:
+					if !ok {
+						log.Warn("Webhook dispatch was unsubscribed, events published meanwhile aren't delivered")
+						return
+					}
+					if err := queue(ctx, event); err != nil {
+						util.CaptureException(ctx, err)
+					}
+				}
+			}
+		}()
+	}
+}
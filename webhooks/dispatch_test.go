@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"context"
+	"github.com/discordextremelist/api/events"
+	"testing"
+	"time"
+)
+
+func TestQueueOncePerWebhook(t *testing.T) {
+	reset()
+	ctx := context.Background()
+	event := events.Event{ID: "event", Type: "bot.approved", EntityID: "1"}
+	first, second := Webhook{ID: "first"}, Webhook{ID: "second"}
+	if err := queueTo(ctx, event, []Webhook{first}); err != nil {
+		t.Fatal(err)
+	}
+	// Another replica matched one more webhook, only that one is still queued.
+	if err := queueTo(ctx, event, []Webhook{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	err, deliveries := claim(ctx, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[0].WebhookID == deliveries[1].WebhookID {
+		t.Fatalf("queued %+v, want one delivery for each webhook", deliveries)
+	}
+}
+
+func TestClaimReleasedWhenQueueingFails(t *testing.T) {
+	reset()
+	ctx := context.Background()
+	event := events.Event{ID: "event", Type: "bot.approved", EntityID: "1"}
+	// Deliveries can't be stored in a string.
+	testRedis.Set(deliveriesKey, "broken")
+	if err := queueTo(ctx, event, []Webhook{{ID: "webhook"}}); err == nil {
+		t.Fatal("queueing into a broken queue succeeded")
+	}
+	testRedis.Del(deliveriesKey)
+	if err := queueTo(ctx, event, []Webhook{{ID: "webhook"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err, deliveries := claim(ctx, 10, time.Minute); err != nil || len(deliveries) != 1 {
+		t.Fatalf("claim() = %v, %+v, want the delivery queued by the retry", err, deliveries)
+	}
+}
@@ -0,0 +1,32 @@
+package webhooks
+
+import (
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/discordextremelist/api/config"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-redis/redis/v8"
+	"os"
+	"testing"
+)
+
+var testRedis *miniredis.Miniredis
+
+func TestMain(m *testing.M) {
+	var err error
+	if testRedis, err = miniredis.Run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	util.Config = config.Defaults()
+	util.Database.Redis = redis.NewClient(&redis.Options{Addr: testRedis.Addr()})
+	code := m.Run()
+	testRedis.Close()
+	os.Exit(code)
+}
+
+// reset empties redis and the config between tests.
+func reset() {
+	testRedis.FlushAll()
+	util.Config = config.Defaults()
+}
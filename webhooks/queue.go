@@ -0,0 +1,176 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/discordextremelist/api/events"
+	"github.com/discordextremelist/api/util"
+	"github.com/go-redis/redis/v8"
+	"time"
+)
+
+const (
+	// queueKey is a sorted set of delivery ids scored by when they are due in unix milliseconds.
+	queueKey = "webhook_queue"
+	// deliveriesKey holds every queued delivery by id.
+	deliveriesKey = "webhook_deliveries"
+)
+
+func logKey(webhookID string) string {
+	return "webhook_log:" + webhookID
+}
+
+func deadKey(webhookID string) string {
+	return "webhook_dead:" + webhookID
+}
+
+// Delivery is an event on its way to a webhook, it stays queued until the webhook accepted it or it is dead-lettered.
+type Delivery struct {
+	ID        string       `json:"id"`
+	WebhookID string       `json:"webhookId"`
+	Event     events.Event `json:"event"`
+	// Attempts is how often the delivery was tried so far.
+	Attempts int `json:"attempts"`
+}
+
+// Attempt is an entry of a webhook's delivery log.
+type Attempt struct {
+	DeliveryID string `json:"deliveryId"`
+	EventID    string `json:"eventId"`
+	EventType  string `json:"eventType"`
+	Attempt    int    `json:"attempt"`
+	Time       int64  `json:"time"`
+	// Duration is how long the receiver took to answer in milliseconds.
+	Duration int64 `json:"duration"`
+	// Status is the receiver's status code, 0 when it couldn't be reached.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Outcome is delivered, retrying or dead.
+	Outcome string `json:"outcome"`
+	// NextAttempt is when a delivery which is retrying is tried again.
+	NextAttempt int64 `json:"nextAttempt,omitempty"`
+}
+
+// claimScript hands due deliveries to one replica, pushing them back by a lease so they are retried if it dies
+// before it is done with them.
+var claimScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, id in ipairs(due) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return due
+`)
+
+func enqueue(ctx context.Context, delivery Delivery, due time.Time) error {
+	payload, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	_, err = util.Database.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, deliveriesKey, delivery.ID, payload)
+		pipe.ZAdd(ctx, queueKey, &redis.Z{Score: float64(due.UnixMilli()), Member: delivery.ID})
+		return nil
+	})
+	return err
+}
+
+// claim returns up to n due deliveries, leased for lease.
+func claim(ctx context.Context, n int, lease time.Duration) (error, []Delivery) {
+	now := time.Now()
+	ids, err := claimScript.Run(ctx, util.Database.Redis, []string{queueKey},
+		now.UnixMilli(), now.Add(lease).UnixMilli(), n).StringSlice()
+	if err != nil || len(ids) == 0 {
+		return err, nil
+	}
+	payloads, err := util.Database.Redis.HMGet(ctx, deliveriesKey, ids...).Result()
+	if err != nil {
+		return err, nil
+	}
+	var deliveries []Delivery
+	for i, payload := range payloads {
+		var delivery Delivery
+		if s, ok := payload.(string); !ok || json.Unmarshal([]byte(s), &delivery) != nil {
+			// Nothing to deliver, don't keep claiming it.
+			util.Database.Redis.ZRem(ctx, queueKey, ids[i])
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return nil, deliveries
+}
+
+// done removes a delivery from the queue, whether it was delivered, dead-lettered or its webhook is gone.
+func done(ctx context.Context, delivery Delivery) error {
+	_, err := util.Database.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, queueKey, delivery.ID)
+		pipe.HDel(ctx, deliveriesKey, delivery.ID)
+		return nil
+	})
+	return err
+}
+
+// push prepends value to the capped list at key.
+func push(ctx context.Context, key string, value interface{}) error {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = util.Database.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, payload)
+		pipe.LTrim(ctx, key, 0, int64(util.Config.Webhooks.LogSize-1))
+		return nil
+	})
+	return err
+}
+
+func list[T any](ctx context.Context, key string) (error, []T) {
+	payloads, err := util.Database.Redis.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return err, nil
+	}
+	values := make([]T, 0, len(payloads))
+	for _, payload := range payloads {
+		var value T
+		if err := json.Unmarshal([]byte(payload), &value); err != nil {
+			return err, nil
+		}
+		values = append(values, value)
+	}
+	return nil, values
+}
+
+// Log returns the latest delivery attempts to a webhook, newest first.
+func Log(ctx context.Context, webhookID string) (error, []Attempt) {
+	return list[Attempt](ctx, logKey(webhookID))
+}
+
+// DeadLetters returns the deliveries to a webhook which ran out of attempts, newest first.
+func DeadLetters(ctx context.Context, webhookID string) (error, []Delivery) {
+	return list[Delivery](ctx, deadKey(webhookID))
+}
+
+// Redeliver queues every dead letter of a webhook again with a fresh set of attempts, it returns how many were.
+func Redeliver(ctx context.Context, webhookID string) (error, int) {
+	key := deadKey(webhookID)
+	n := 0
+	for {
+		payload, err := util.Database.Redis.RPop(ctx, key).Result()
+		if err == redis.Nil {
+			return nil, n
+		}
+		if err != nil {
+			return err, n
+		}
+		var delivery Delivery
+		if json.Unmarshal([]byte(payload), &delivery) != nil {
+			continue
+		}
+		delivery.Attempts = 0
+		if err := enqueue(ctx, delivery, time.Now()); err != nil {
+			// Put it back rather than lose it.
+			util.Database.Redis.RPush(ctx, key, payload)
+			return err, n
+		}
+		n++
+	}
+}
@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/discordextremelist/api/events"
+	"github.com/discordextremelist/api/tracing"
+	"github.com/discordextremelist/api/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"strings"
+	"time"
+)
+
+const collection = "webhooks"
+
+// Webhook is a URL the events matching Types and IDs are delivered to, like ?types= and ?ids= of /events. It belongs
+// to the bot whose token registered it.
+type Webhook struct {
+	ID    string   `bson:"_id" json:"id"`
+	Owner string   `json:"owner"`
+	URL   string   `json:"url"`
+	Types []string `json:"types"`
+	IDs   []string `json:"ids"`
+	// Secret signs the deliveries, it is only returned when the webhook is created.
+	Secret  string `json:"secret,omitempty"`
+	Created int64  `json:"created"`
+}
+
+// Cleanup returns a copy of webhook without its secret.
+func Cleanup(webhook *Webhook) *Webhook {
+	copied := *webhook
+	copied.Secret = ""
+	return &copied
+}
+
+func (w *Webhook) Filter() events.Filter {
+	filter, _ := events.ParseFilter(strings.Join(w.Types, ","), strings.Join(w.IDs, ","))
+	return filter
+}
+
+func random(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// New returns a webhook with a fresh id and secret, it isn't stored until Create.
+func New(owner, url string, types, ids []string) *Webhook {
+	if types == nil {
+		types = []string{}
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return &Webhook{
+		ID:      random(12),
+		Owner:   owner,
+		URL:     url,
+		Types:   types,
+		IDs:     ids,
+		Secret:  "DELWH_" + random(24),
+		Created: time.Now().UnixMilli(),
+	}
+}
+
+func Create(ctx context.Context, webhook *Webhook) error {
+	ctx, span := tracing.StartMongo(ctx, "InsertOne", collection)
+	defer span.End()
+	_, err := util.Database.Mongo.Collection(collection).InsertOne(ctx, webhook)
+	tracing.Error(span, err)
+	return err
+}
+
+func Count(ctx context.Context, owner string) (error, int) {
+	ctx, span := tracing.StartMongo(ctx, "CountDocuments", collection)
+	defer span.End()
+	n, err := util.Database.Mongo.Collection(collection).CountDocuments(ctx, bson.M{"owner": owner})
+	tracing.Error(span, err)
+	return err, int(n)
+}
+
+func find(ctx context.Context, filter bson.M) (error, []Webhook) {
+	ctx, span := tracing.StartMongo(ctx, "Find", collection)
+	defer span.End()
+	cursor, err := util.Database.Mongo.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		tracing.Error(span, err)
+		return err, nil
+	}
+	webhooks := []Webhook{}
+	err = cursor.All(ctx, &webhooks)
+	tracing.Error(span, err)
+	return err, webhooks
+}
+
+// List returns the webhooks of owner, oldest first.
+func List(ctx context.Context, owner string) (error, []Webhook) {
+	err, webhooks := find(ctx, bson.M{"owner": owner})
+	if err != nil {
+		return err, nil
+	}
+	for i := range webhooks {
+		webhooks[i] = *Cleanup(&webhooks[i])
+	}
+	return nil, webhooks
+}
+
+// Get returns the webhook called id, mongo.ErrNoDocuments when it doesn't exist or belongs to someone else. An
+// empty owner matches any.
+func Get(ctx context.Context, owner, id string) (error, *Webhook) {
+	filter := bson.M{"_id": id}
+	if owner != "" {
+		filter["owner"] = owner
+	}
+	ctx, span := tracing.StartMongo(ctx, "FindOne", collection)
+	defer span.End()
+	var webhook Webhook
+	err := util.Database.Mongo.Collection(collection).FindOne(ctx, filter).Decode(&webhook)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			tracing.Error(span, err)
+		}
+		return err, nil
+	}
+	return nil, &webhook
+}
+
+// Delete removes a webhook of owner with its delivery log and dead letters, deliveries still queued are dropped
+// when they are due.
+func Delete(ctx context.Context, owner, id string) error {
+	mongoCtx, span := tracing.StartMongo(ctx, "DeleteOne", collection)
+	res, err := util.Database.Mongo.Collection(collection).DeleteOne(mongoCtx, bson.M{"_id": id, "owner": owner})
+	tracing.Error(span, err)
+	span.End()
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return util.Database.Redis.Del(ctx, logKey(id), deadKey(id)).Err()
+}
+
+// matching returns the webhooks an event has to be delivered to.
+func matching(ctx context.Context, event events.Event) (error, []Webhook) {
+	err, candidates := find(ctx, bson.M{"$or": bson.A{bson.M{"ids": bson.M{"$size": 0}}, bson.M{"ids": event.EntityID}}})
+	if err != nil {
+		return err, nil
+	}
+	var webhooks []Webhook
+	for _, webhook := range candidates {
+		if webhook.Filter().Matches(event) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return nil, webhooks
+}